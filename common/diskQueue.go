@@ -0,0 +1,494 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 记录头: 长度(4) + CRC32(4) + 写入时间纳秒(8)
+const diskRecordHeaderSize = 16
+
+const (
+	diskSegmentSuffix = ".seg"
+	diskCursorFile    = "cursor"
+)
+
+var ErrDiskQueueClosed = errors.New("磁盘队列已关闭")
+
+// DiskQueue 基于分段文件的持久化先进先出队列
+// 写入追加到当前段文件，读取游标定期落盘，段文件读完后删除；
+// 进程崩溃时最多重放最近一个落盘周期内已读取的记录（至少一次）
+type DiskQueue struct {
+	dir             string
+	maxSegmentBytes int64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	writeSeg    int64
+	writeOffset int64
+	writeFile   *os.File
+
+	readSeg    int64
+	readOffset int64
+	readFile   *os.File
+	// 已读取但尚未提交的记录长度
+	pendingSize int64
+
+	depth       int64 // 未提交记录数
+	dirty       bool  // 写入数据未同步
+	cursorDirty bool  // 游标未落盘
+	closed      bool
+	stopCh      chan struct{}
+}
+
+// NewDiskQueue 打开（或创建）目录下的磁盘队列，并恢复上次的读写位置
+func NewDiskQueue(dir string, maxSegmentBytes int64) (*DiskQueue, error) {
+	if maxSegmentBytes <= 0 {
+		maxSegmentBytes = 64 * 1024 * 1024
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建队列目录失败: %v", err)
+	}
+
+	q := &DiskQueue{
+		dir:             dir,
+		maxSegmentBytes: maxSegmentBytes,
+		stopCh:          make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+
+	go q.syncLoop()
+	return q, nil
+}
+
+// recover 扫描段文件，截断损坏的尾部记录并统计积压数量
+func (q *DiskQueue) recover() error {
+	segments, err := q.listSegments()
+	if err != nil {
+		return err
+	}
+
+	q.readSeg, q.readOffset = q.loadCursor()
+	if len(segments) == 0 {
+		q.readSeg, q.readOffset = 0, 0
+		return q.openWriteSegment(0)
+	}
+
+	// 游标指向的段已被删除时，从最早的段开始读
+	if q.readSeg < segments[0] {
+		q.readSeg, q.readOffset = segments[0], 0
+	}
+
+	for _, seg := range segments {
+		if seg < q.readSeg {
+			// 已经读完但未来得及删除的段
+			_ = os.Remove(q.segmentPath(seg))
+			continue
+		}
+		start := int64(0)
+		if seg == q.readSeg {
+			start = q.readOffset
+		}
+		count, validSize, err := q.scanSegment(seg, start)
+		if err != nil {
+			return err
+		}
+		q.depth += count
+		if fi, err := os.Stat(q.segmentPath(seg)); err == nil && fi.Size() > validSize {
+			log.Printf("磁盘队列段 %d 尾部存在不完整记录，截断至 %d", seg, validSize)
+			if err := os.Truncate(q.segmentPath(seg), validSize); err != nil {
+				return fmt.Errorf("截断队列段失败: %v", err)
+			}
+		}
+	}
+
+	last := segments[len(segments)-1]
+	if last < q.readSeg {
+		last = q.readSeg
+	}
+	return q.openWriteSegment(last)
+}
+
+// scanSegment 从 start 开始校验段内记录，返回记录数和有效长度
+// 中间的损坏内容计为一条记录，由 Peek 读取时隔离；末尾的不完整记录不计入有效长度
+func (q *DiskQueue) scanSegment(seg, start int64) (int64, int64, error) {
+	f, err := os.Open(q.segmentPath(seg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("打开队列段失败: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("读取队列段信息失败: %v", err)
+	}
+
+	var count int64
+	offset, valid := start, start
+	corrupt := false
+	for offset < fi.Size() {
+		_, size, err := readRecordAt(f, offset)
+		if err != nil {
+			corrupt = true
+			offset++
+			continue
+		}
+		if corrupt {
+			count++
+			corrupt = false
+		}
+		offset += size
+		valid = offset
+		count++
+	}
+	return count, valid, nil
+}
+
+// Put 追加一条记录
+func (q *DiskQueue) Put(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrDiskQueueClosed
+	}
+
+	if q.writeOffset >= q.maxSegmentBytes {
+		if err := q.openWriteSegment(q.writeSeg + 1); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, diskRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(time.Now().UnixNano()))
+	copy(buf[diskRecordHeaderSize:], data)
+
+	n, err := q.writeFile.Write(buf)
+	if err != nil {
+		// 写入不完整时截断到写入前的位置，截断失败则切换到新段，避免残缺记录阻塞读取
+		if n > 0 {
+			if terr := q.writeFile.Truncate(q.writeOffset); terr != nil {
+				log.Printf("磁盘队列段 %d 截断残缺记录失败: %v", q.writeSeg, terr)
+				if serr := q.openWriteSegment(q.writeSeg + 1); serr != nil {
+					log.Printf("磁盘队列切换新段失败: %v", serr)
+				}
+			}
+		}
+		return fmt.Errorf("写入队列段失败: %v", err)
+	}
+	q.writeOffset += int64(n)
+
+	q.depth++
+	q.dirty = true
+	q.cond.Signal()
+	return nil
+}
+
+// Peek 阻塞直到有可读记录，返回记录内容及写入时间；读取后需调用 Commit 才会出队
+// 遇到损坏的记录时将其隔离到 .bad 文件并跳到下一条有效记录
+func (q *DiskQueue) Peek() ([]byte, time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for q.depth == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			return nil, time.Time{}, ErrDiskQueueClosed
+		}
+
+		if q.readFile == nil {
+			f, err := os.Open(q.segmentPath(q.readSeg))
+			if err != nil {
+				return nil, time.Time{}, fmt.Errorf("打开队列段失败: %v", err)
+			}
+			q.readFile = f
+		}
+
+		data, size, ts, err := readRecordWithTime(q.readFile, q.readOffset)
+		if err == nil {
+			q.pendingSize = size
+			return data, ts, nil
+		}
+		if q.readOffset < q.segmentSize(q.readSeg) {
+			q.quarantine(err)
+			continue
+		}
+		// 当前段已读完，切换到下一段
+		if q.readSeg < q.writeSeg {
+			q.advanceSegment()
+			continue
+		}
+		// 计数与文件内容不一致（损坏的记录跨越多条），以文件为准
+		log.Printf("磁盘队列已无可读记录，重置积压计数 %d", q.depth)
+		q.depth = 0
+	}
+}
+
+// quarantine 将读取位置处的损坏记录直到下一条有效记录之间的内容另存为 .bad 文件并跳过，按一条记录出队，调用方需持有锁
+func (q *DiskQueue) quarantine(cause error) {
+	end := q.segmentSize(q.readSeg)
+	next := end
+	for offset := q.readOffset + 1; offset < end; offset++ {
+		if _, _, err := readRecordAt(q.readFile, offset); err == nil {
+			next = offset
+			break
+		}
+	}
+
+	bad := make([]byte, next-q.readOffset)
+	name := filepath.Join(q.dir, fmt.Sprintf("%020d-%d.bad", q.readSeg, q.readOffset))
+	if _, err := q.readFile.ReadAt(bad, q.readOffset); err != nil && err != io.EOF {
+		log.Printf("读取损坏记录失败: %v", err)
+	} else if err := os.WriteFile(name, bad, 0644); err != nil {
+		log.Printf("保存损坏记录失败: %v", err)
+	}
+	log.Printf("磁盘队列段 %d 偏移 %d 记录损坏(%v)，已隔离 %d 字节到 %s", q.readSeg, q.readOffset, cause, len(bad), name)
+
+	q.readOffset = next
+	q.pendingSize = 0
+	if q.depth > 0 {
+		q.depth--
+	}
+	q.cursorDirty = true
+}
+
+// Commit 确认最近一次 Peek 的记录已处理
+func (q *DiskQueue) Commit() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pendingSize == 0 {
+		return
+	}
+	q.readOffset += q.pendingSize
+	q.pendingSize = 0
+	q.depth--
+	q.cursorDirty = true
+
+	if q.readSeg < q.writeSeg && q.readOffset >= q.segmentSize(q.readSeg) {
+		q.advanceSegment()
+	}
+}
+
+// advanceSegment 删除读完的段并移动到下一段，调用方需持有锁
+func (q *DiskQueue) advanceSegment() {
+	if q.readFile != nil {
+		q.readFile.Close()
+		q.readFile = nil
+	}
+	_ = os.Remove(q.segmentPath(q.readSeg))
+	q.readSeg++
+	q.readOffset = 0
+	q.saveCursor()
+}
+
+// Depth 未出队的记录数
+func (q *DiskQueue) Depth() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth
+}
+
+// OldestTime 队首记录的写入时间，队列为空时返回零值
+func (q *DiskQueue) OldestTime() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.depth == 0 {
+		return time.Time{}
+	}
+	seg, offset := q.readSeg, q.readOffset
+	for seg <= q.writeSeg {
+		f, err := os.Open(q.segmentPath(seg))
+		if err != nil {
+			return time.Time{}
+		}
+		_, _, ts, err := readRecordWithTime(f, offset)
+		f.Close()
+		if err == nil {
+			return ts
+		}
+		seg++
+		offset = 0
+	}
+	return time.Time{}
+}
+
+// Close 同步数据并关闭队列
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.stopCh)
+	q.cond.Broadcast()
+
+	q.saveCursor()
+	if q.readFile != nil {
+		q.readFile.Close()
+	}
+	if q.writeFile != nil {
+		_ = q.writeFile.Sync()
+		return q.writeFile.Close()
+	}
+	return nil
+}
+
+// syncLoop 定期将写入数据和读取游标落盘
+func (q *DiskQueue) syncLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stopCh:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.dirty && q.writeFile != nil {
+				if err := q.writeFile.Sync(); err != nil {
+					log.Printf("磁盘队列同步失败: %v", err)
+				}
+				q.dirty = false
+			}
+			if q.cursorDirty {
+				q.saveCursor()
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+func (q *DiskQueue) openWriteSegment(seg int64) error {
+	if q.writeFile != nil {
+		_ = q.writeFile.Sync()
+		q.writeFile.Close()
+	}
+	f, err := os.OpenFile(q.segmentPath(seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开队列段失败: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("读取队列段信息失败: %v", err)
+	}
+	q.writeFile = f
+	q.writeSeg = seg
+	q.writeOffset = fi.Size()
+	return nil
+}
+
+func (q *DiskQueue) segmentPath(seg int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seg, diskSegmentSuffix))
+}
+
+func (q *DiskQueue) segmentSize(seg int64) int64 {
+	fi, err := os.Stat(q.segmentPath(seg))
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+func (q *DiskQueue) listSegments() ([]int64, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取队列目录失败: %v", err)
+	}
+	var segments []int64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, diskSegmentSuffix) {
+			continue
+		}
+		seg, err := strconv.ParseInt(strings.TrimSuffix(name, diskSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// loadCursor 读取游标文件，格式为 "段号 偏移"
+func (q *DiskQueue) loadCursor() (int64, int64) {
+	data, err := os.ReadFile(filepath.Join(q.dir, diskCursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var seg, offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seg, &offset); err != nil {
+		return 0, 0
+	}
+	return seg, offset
+}
+
+// saveCursor 先写临时文件再重命名，避免游标文件写坏，调用方需持有锁
+func (q *DiskQueue) saveCursor() {
+	path := filepath.Join(q.dir, diskCursorFile)
+	tmp := path + ".tmp"
+	content := fmt.Sprintf("%d %d", q.readSeg, q.readOffset)
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		log.Printf("磁盘队列游标保存失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("磁盘队列游标保存失败: %v", err)
+		return
+	}
+	q.cursorDirty = false
+}
+
+func readRecordAt(f *os.File, offset int64) ([]byte, int64, error) {
+	data, size, _, err := readRecordWithTime(f, offset)
+	return data, size, err
+}
+
+// readRecordWithTime 读取 offset 处的一条记录，返回内容、记录总长度和写入时间
+func readRecordWithTime(f *os.File, offset int64) ([]byte, int64, time.Time, error) {
+	header := make([]byte, diskRecordHeaderSize)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+	// 长度字段损坏时不按其分配内存
+	if fi, err := f.Stat(); err == nil && offset+diskRecordHeaderSize+int64(length) > fi.Size() {
+		return nil, 0, time.Time{}, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, offset+diskRecordHeaderSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, time.Time{}, err
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, 0, time.Time{}, fmt.Errorf("记录校验失败")
+	}
+	return data, int64(diskRecordHeaderSize) + int64(length), ts, nil
+}
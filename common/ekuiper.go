@@ -14,6 +14,35 @@ import (
 	"time"
 )
 
+// 流规则引擎类型
+const (
+	StreamEngineEkuiper = "ekuiper"
+	StreamEngineBuiltin = "builtin"
+)
+
+// StreamEvaluator 内置流规则计算，由 services 启动时注册
+type StreamEvaluator interface {
+	Reload()
+	RuleStats(ruleId string) (map[string]interface{}, bool)
+	AllRuleStats() map[string]interface{}
+}
+
+// BuiltinStream 已注册的内置流规则计算
+var BuiltinStream StreamEvaluator
+
+// UseBuiltinStream 是否使用内置流规则计算代替 eKuiper
+func UseBuiltinStream() bool {
+	return StreamEngine == StreamEngineBuiltin
+}
+
+// reloadBuiltin 内置模式下规则配置以数据库为准，规则变更只需通知重新加载
+func reloadBuiltin() error {
+	if BuiltinStream != nil {
+		BuiltinStream.Reload()
+	}
+	return nil
+}
+
 // EkuiperClient eKuiper客户端
 type EkuiperClient struct {
 	baseURL string
@@ -128,6 +157,9 @@ func InitEuiper() {
 
 // RuleExist 检查规则是否存在，如果不存在或发生错误返回 error，否则返回 nil
 func (c *EkuiperClient) RuleExist(ctx context.Context, ruleId string) error {
+	if UseBuiltinStream() {
+		return nil
+	}
 	url := fmt.Sprintf("%s/rules/%s", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -174,6 +206,9 @@ func (c *EkuiperClient) RuleExist(ctx context.Context, ruleId string) error {
 
 // CreateRule 创建规则
 func (c *EkuiperClient) CreateRule(ctx context.Context, actions []Actions, ruleId string, sql string) error {
+	if UseBuiltinStream() {
+		return reloadBuiltin()
+	}
 	url := fmt.Sprintf("%s/rules", c.baseURL)
 
 	createRule := CreateRule{
@@ -211,6 +246,9 @@ func (c *EkuiperClient) CreateRule(ctx context.Context, actions []Actions, ruleI
 
 // UpdateRule 更新规则
 func (c *EkuiperClient) UpdateRule(ctx context.Context, actions []Actions, ruleId string, sql string) error {
+	if UseBuiltinStream() {
+		return reloadBuiltin()
+	}
 	url := fmt.Sprintf("%s/rules/%s", c.baseURL, ruleId)
 
 	createRule := CreateRule{
@@ -248,6 +286,9 @@ func (c *EkuiperClient) UpdateRule(ctx context.Context, actions []Actions, ruleI
 
 // DeleteRule 删除规则
 func (c *EkuiperClient) DeleteRule(ctx context.Context, ruleId string) error {
+	if UseBuiltinStream() {
+		return reloadBuiltin()
+	}
 	url := fmt.Sprintf("%s/rules/%s", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
@@ -270,6 +311,9 @@ func (c *EkuiperClient) DeleteRule(ctx context.Context, ruleId string) error {
 
 // StartRule 启动规则
 func (c *EkuiperClient) StartRule(ctx context.Context, ruleId string) error {
+	if UseBuiltinStream() {
+		return reloadBuiltin()
+	}
 	url := fmt.Sprintf("%s/rules/%s/start", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
@@ -292,6 +336,9 @@ func (c *EkuiperClient) StartRule(ctx context.Context, ruleId string) error {
 
 // StopRule 停止规则
 func (c *EkuiperClient) StopRule(ctx context.Context, ruleId string) error {
+	if UseBuiltinStream() {
+		return reloadBuiltin()
+	}
 	url := fmt.Sprintf("%s/rules/%s/stop", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
@@ -314,6 +361,9 @@ func (c *EkuiperClient) StopRule(ctx context.Context, ruleId string) error {
 
 // RestartRule 重启规则
 func (c *EkuiperClient) RestartRule(ctx context.Context, ruleId string) error {
+	if UseBuiltinStream() {
+		return reloadBuiltin()
+	}
 	url := fmt.Sprintf("%s/rules/%s/restart", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
@@ -336,6 +386,16 @@ func (c *EkuiperClient) RestartRule(ctx context.Context, ruleId string) error {
 
 // GetAllRules 获取所有规则摘要信息
 func (c *EkuiperClient) GetAllRules(ctx context.Context) ([]dtos.RuleResponse, error) {
+	if UseBuiltinStream() {
+		var ruleList []dtos.RuleResponse
+		if BuiltinStream != nil {
+			for id, stats := range BuiltinStream.AllRuleStats() {
+				status, _ := stats.(map[string]interface{})["status"].(string)
+				ruleList = append(ruleList, dtos.RuleResponse{Id: id, Name: id, Status: status})
+			}
+		}
+		return ruleList, nil
+	}
 	url := fmt.Sprintf("%s/rules", c.baseURL)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -367,6 +427,14 @@ func (c *EkuiperClient) GetAllRules(ctx context.Context) ([]dtos.RuleResponse, e
 
 // GetRule 获取指定规则的详细信息
 func (c *EkuiperClient) GetRule(ctx context.Context, ruleId string) (map[string]interface{}, error) {
+	if UseBuiltinStream() {
+		if BuiltinStream != nil {
+			if stats, ok := BuiltinStream.RuleStats(ruleId); ok {
+				return stats, nil
+			}
+		}
+		return nil, fmt.Errorf("rule not found")
+	}
 	url := fmt.Sprintf("%s/rules/%s", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -398,6 +466,14 @@ func (c *EkuiperClient) GetRule(ctx context.Context, ruleId string) (map[string]
 
 // GetRuleStats 获取规则状态
 func (c *EkuiperClient) GetRuleStats(ctx context.Context, ruleId string) (map[string]interface{}, error) {
+	if UseBuiltinStream() {
+		if BuiltinStream != nil {
+			if stats, ok := BuiltinStream.RuleStats(ruleId); ok {
+				return stats, nil
+			}
+		}
+		return nil, fmt.Errorf("rule not found")
+	}
 	url := fmt.Sprintf("%s/rules/%s/status", c.baseURL, ruleId)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -423,6 +499,12 @@ func (c *EkuiperClient) GetRuleStats(ctx context.Context, ruleId string) (map[st
 
 // GetAllRuleStats 获取所有规则状态
 func (c *EkuiperClient) GetAllRuleStats(ctx context.Context) (map[string]interface{}, error) {
+	if UseBuiltinStream() {
+		if BuiltinStream == nil {
+			return map[string]interface{}{}, nil
+		}
+		return BuiltinStream.AllRuleStats(), nil
+	}
 	url := fmt.Sprintf("%s/rules/status/all", c.baseURL)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
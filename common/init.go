@@ -29,6 +29,9 @@ var CallBackUrl = "http://" + GetIPByHostname() + ":" + Port
 var EkuiperServer, _ = beego.AppConfig.String("ekuiperServer")
 var Ekuiper = NewEkuiperClient(EkuiperServer)
 
+// StreamEngine 流规则引擎：ekuiper 使用外部 eKuiper，builtin 使用服务内置计算
+var StreamEngine = beego.AppConfig.DefaultString("streamEngine", StreamEngineEkuiper)
+
 func GetIPByHostname() string {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -4,13 +4,18 @@ import (
 	"encoding/json"
 	"github.com/beego/beego/v2/client/orm"
 	"iotServer/models"
+	"iotServer/models/constants"
 	"iotServer/models/dtos"
+	"iotServer/services"
 	"iotServer/utils"
 	"time"
 )
 
 type AlertController struct {
 	BaseController
+	lifecycle services.AlertLifecycleService
+	incident  services.AlertIncidentService
+	delivery  services.NotifyDeliveryService
 }
 
 // GetAlarmRecord @Title 获取Scada告警记录
@@ -44,6 +49,12 @@ func (c *AlertController) GetAlarmRecord() {
 	if req.Status != "" {
 		qs = qs.Filter("Status", req.Status)
 	}
+	if req.State != "" {
+		qs = qs.Filter("State", req.State)
+	}
+	if req.IncidentId > 0 {
+		qs = qs.Filter("IncidentId", req.IncidentId)
+	}
 	if req.IsSystem != "" {
 		var IsSystem bool
 		if req.IsSystem == "true" {
@@ -93,6 +104,18 @@ func (c *AlertController) GetAlarmRecord() {
 		alertContent["id"] = alert.Id
 		alertContent["handler"] = alert.Status
 		alertContent["treated_time"] = alert.TreatedTime
+		alertContent["state"] = alert.State
+		alertContent["ack_by"] = alert.AckBy
+		alertContent["ack_time"] = alert.AckTime
+		alertContent["recover_time"] = alert.RecoverTime
+		alertContent["close_by"] = alert.CloseBy
+		alertContent["close_time"] = alert.CloseTime
+		alertContent["escalated"] = alert.Escalated
+		alertContent["occurrences"] = alert.Occurrences
+		alertContent["first_seen"] = alert.TriggerTime
+		alertContent["last_seen"] = alert.LastSeen
+		alertContent["peak_value"] = alert.PeakValue
+		alertContent["incident_id"] = alert.IncidentId
 		resultList = append(resultList, alertContent)
 	}
 
@@ -149,10 +172,188 @@ func (c *AlertController) UpdateStatus() {
 	if _, err := o.Update(&alert); err != nil {
 		c.Error(500, "更新失败")
 	}
+	// 已处理或忽略的告警同时关闭
+	if status == string(constants.Treated) || status == string(constants.Ignore) {
+		userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+		tenantId, _ := models.GetUserTenantId(userId)
+		if err := c.lifecycle.Close(tenantId, userId, []int64{id}, ""); err != nil {
+			c.Error(400, err.Error())
+		}
+	}
+
+	c.SuccessMsg()
+}
+
+// Ack @Title 确认告警
+// @Description 确认后告警不再升级，条件解除时仍会自动恢复
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "告警记录ID列表，逗号分隔"
+// @Param   message        query    string  false  "处理意见"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "请求出错"
+// @router /ack [post]
+func (c *AlertController) Ack() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.lifecycle.Acknowledge(tenantId, userId, ids, c.GetString("message")); err != nil {
+		c.Error(400, err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// Close @Title 关闭告警
+// @Description 手动关闭告警，未处理的告警同时标记为已处理
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "告警记录ID列表，逗号分隔"
+// @Param   message        query    string  false  "处理意见"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "请求出错"
+// @router /close [post]
+func (c *AlertController) Close() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.lifecycle.Close(tenantId, userId, ids, c.GetString("message")); err != nil {
+		c.Error(400, err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// History @Title 告警状态记录
+// @Description 查询告警触发、确认、升级、恢复、关闭的时间及操作人
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "告警记录ID"
+// @Success 200 {object} []models.AlertTransition
+// @Failure 400 "请求出错"
+// @router /history [post]
+func (c *AlertController) History() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	list, err := c.lifecycle.History(tenantId, id)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(list)
+}
+
+// IncidentList @Title 告警事件列表
+// @Description 同一网关或位置下的相关告警归并为一个事件，事件下全部告警恢复或关闭后事件关闭
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Param   state          query    string  false  "事件状态：open/closed"
+// @Param   groupBy        query    string  false  "归并方式：sn/position"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "请求出错"
+// @router /incident/list [post]
+func (c *AlertController) IncidentList() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.incident.List(tenantId, c.GetString("state"), c.GetString("groupBy"), page, size)
+	if err != nil {
+		c.Error(400, "查询告警事件失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// IncidentDetail @Title 告警事件详情
+// @Description 查询事件及其归并的告警记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "事件ID"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "请求出错"
+// @router /incident/detail [post]
+func (c *AlertController) IncidentDetail() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	detail, err := c.incident.Detail(tenantId, id)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(detail)
+}
+
+// IncidentClose @Title 关闭告警事件
+// @Description 关闭事件及其下全部未关闭的告警
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "事件ID"
+// @Param   message        query    string  false  "处理意见"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "请求出错"
+// @router /incident/close [post]
+func (c *AlertController) IncidentClose() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
 
+	if err := c.incident.Close(tenantId, userId, id, c.GetString("message")); err != nil {
+		c.Error(400, err.Error())
+	}
 	c.SuccessMsg()
 }
 
+// DeliveryList @Title 通知投递记录
+// @Description 查询告警各通知方式的发送次数、状态、响应及耗时
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   alertId        query    int64   false  "告警记录ID"
+// @Param   status         query    string  false  "投递状态：pending/success/failed"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "请求出错"
+// @router /delivery/list [post]
+func (c *AlertController) DeliveryList() {
+	alertId, _ := c.GetInt64("alertId")
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.delivery.List(tenantId, alertId, c.GetString("status"), page, size)
+	if err != nil {
+		c.Error(400, "查询投递记录失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// DeliveryResend @Title 重新发送通知
+// @Description 按投递记录保存的通知配置立即重新发送，返回发送后的记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "投递记录ID列表，逗号分隔"
+// @Success 200 {object} []models.NotifyDelivery
+// @Failure 400 "请求出错"
+// @router /delivery/resend [post]
+func (c *AlertController) DeliveryResend() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	list, err := c.delivery.Resend(tenantId, ids)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(list)
+}
+
 // Delete @Title 删除告警记录
 // @Description 删除单个告警记录
 // @Param id query int64 true "告警记录ID"
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"encoding/json"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/services"
+)
+
+// BatchController 批量控制
+type BatchController struct {
+	BaseController
+	service services.BatchService
+}
+
+// Create @Title 创建批量控制
+// @Description 向分组、位置子树、部门或筛选出的设备批量写入，支持并发数、灰度比例和失败率阈值，任务在后台执行
+// @Param   Authorization  header   string                    true   "Bearer YourToken"
+// @Param   body           body     dtos.BatchCommandRequest  true   "批量控制参数"
+// @Success 200 {object} models.BatchCommand
+// @Failure 400 "错误信息"
+// @router /create [post]
+func (c *BatchController) Create() {
+	var req dtos.BatchCommandRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	batch, err := c.service.Create(tenantId, userId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(batch)
+}
+
+// List @Title 批量控制列表
+// @Description 分页查询批量控制任务
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Param   status         query    string  false  "状态：running/completed/aborted/canceled/interrupted"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /list [post]
+func (c *BatchController) List() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.List(tenantId, c.GetString("status"), page, size)
+	if err != nil {
+		c.Error(400, "查询批量任务失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// Report @Title 批量控制报告
+// @Description 返回任务统计及每台设备的下发结果
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "任务ID"
+// @Success 200 {object} services.BatchReport
+// @Failure 400 "错误信息"
+// @router /report [post]
+func (c *BatchController) Report() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	report, err := c.service.Report(tenantId, id)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(report)
+}
+
+// Cancel @Title 取消批量控制
+// @Description 停止下发剩余设备，已下发的命令不受影响
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "任务ID"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /cancel [post]
+func (c *BatchController) Cancel() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.Cancel(tenantId, id); err != nil {
+		c.Error(400, err.Error())
+	}
+	c.SuccessMsg()
+}
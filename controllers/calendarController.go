@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/services"
+	"iotServer/utils"
+	"path/filepath"
+	"strings"
+)
+
+// CalendarController 工作日历与租户时区
+type CalendarController struct {
+	BaseController
+	service services.CalendarService
+}
+
+// Save @Title 保存工作日历
+// @Description 按星期或轮班周期排班，节假日、调休上班按日期单独配置
+// @Param   Authorization  header   string                true   "Bearer YourToken"
+// @Param   body           body     dtos.CalendarRequest  true   "工作日历"
+// @Success 200 {object} models.WorkCalendar
+// @Failure 400 "错误信息"
+// @router /save [post]
+func (c *CalendarController) Save() {
+	var req dtos.CalendarRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	calendar, err := c.service.SaveCalendar(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(calendar)
+}
+
+// List @Title 工作日历列表
+// @Description 分页查询工作日历
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /list [post]
+func (c *CalendarController) List() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.ListCalendars(tenantId, page, size)
+	if err != nil {
+		c.Error(400, "查询日历失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// Delete @Title 删除工作日历
+// @Description 删除工作日历及其配置的日期，引用该日历的场景、通知将不再满足日历条件
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "日历ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /delete [post]
+func (c *CalendarController) Delete() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.DeleteCalendars(tenantId, ids); err != nil {
+		c.Error(400, "删除日历失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// SaveDays @Title 保存节假日/调休
+// @Description 批量保存日历中的节假日和调休上班日期，同一日期已存在时覆盖
+// @Param   Authorization  header   string                    true   "Bearer YourToken"
+// @Param   body           body     dtos.CalendarDaysRequest  true   "日期列表"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /day/save [post]
+func (c *CalendarController) SaveDays() {
+	var req dtos.CalendarDaysRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	count, err := c.service.SaveDays(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(map[string]interface{}{"count": count})
+}
+
+// ImportDays @Title 导入节假日/调休
+// @Description 从 Excel 导入日期，首行为表头，列依次为 日期、类型(节假日/调休上班 或 holiday/workday)、名称
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   calendarId     formData int64   true   "日历ID"
+// @Param   file           formData file    true   "Excel文件"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /day/import [post]
+func (c *CalendarController) ImportDays() {
+	calendarId, _ := c.GetInt64("calendarId")
+	if calendarId <= 0 {
+		c.Error(400, "calendarId不能为空")
+	}
+	file, header, err := c.GetFile("file")
+	if err != nil {
+		c.Error(400, "获取文件失败: "+err.Error())
+	}
+	defer file.Close()
+	if strings.ToLower(filepath.Ext(header.Filename)) != ".xlsx" {
+		c.Error(400, "文件格式不支持，请上传Excel文件(.xlsx)")
+	}
+	fileBytes, err := io.ReadAll(file)
+	if err != nil {
+		c.Error(400, "读取文件内容失败: "+err.Error())
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(fileBytes))
+	if err != nil {
+		c.Error(400, "打开Excel文件失败: "+err.Error())
+	}
+	defer f.Close()
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	count, err := c.service.ImportDays(tenantId, calendarId, f)
+	if err != nil {
+		c.Error(400, "导入失败: "+err.Error())
+	}
+	c.Success(map[string]interface{}{"count": count})
+}
+
+// ListDays @Title 节假日/调休列表
+// @Description 查询日历中单独配置的日期
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   calendarId     query    int64   true   "日历ID"
+// @Param   year           query    string  false  "年份，如 2026，为空查询全部"
+// @Success 200 {object} []models.CalendarDay
+// @Failure 400 "错误信息"
+// @router /day/list [post]
+func (c *CalendarController) ListDays() {
+	calendarId, _ := c.GetInt64("calendarId")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	list, err := c.service.ListDays(tenantId, calendarId, c.GetString("year"))
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(list)
+}
+
+// DeleteDays @Title 删除节假日/调休
+// @Description 删除日历中单独配置的日期，删除后按排班方式计算
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   calendarId     query    int64   true   "日历ID"
+// @Param   ids            query    string  true   "日期记录ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /day/delete [post]
+func (c *CalendarController) DeleteDays() {
+	calendarId, _ := c.GetInt64("calendarId")
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.DeleteDays(tenantId, calendarId, ids); err != nil {
+		c.Error(400, err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// Check @Title 查询日期类型
+// @Description 查询日期在日历中为工作日还是休息日
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   calendarId     query    int64   true   "日历ID"
+// @Param   date           query    string  false  "日期 2006-01-02，为空取租户时区的今天"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /check [get]
+func (c *CalendarController) Check() {
+	calendarId, _ := c.GetInt64("calendarId")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.Check(tenantId, calendarId, c.GetString("date"))
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(result)
+}
+
+// TimeZone @Title 查询租户时区
+// @Description 场景定时、限制条件及通知生效时间按租户时区计算，未配置使用服务器时区
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Success 200 {object} controllers.SimpleResult
+// @router /timezone [get]
+func (c *CalendarController) TimeZone() {
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+	c.Success(c.service.GetTimeZone(tenantId))
+}
+
+// SetTimeZone @Title 设置租户时区
+// @Description 设置后运行中的定时场景按新时区重新加载
+// @Param   Authorization  header   string                      true   "Bearer YourToken"
+// @Param   body           body     dtos.TenantTimeZoneRequest  true   "时区"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /timezone/save [post]
+func (c *CalendarController) SetTimeZone() {
+	var req dtos.TenantTimeZoneRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.SetTimeZone(tenantId, req.TimeZone); err != nil {
+		c.Error(400, err.Error())
+	}
+	c.SuccessMsg()
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"iotServer/models"
+	"iotServer/services"
+	"iotServer/utils"
+)
+
+// CredentialController 设备/网关接入凭证管理
+type CredentialController struct {
+	BaseController
+	service services.CredentialService
+}
+
+// List @Title 凭证列表
+// @Description 分页查询设备与网关的接入凭证，不返回密钥
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Param   kind           query    string  false  "凭证类型：device/gateway"
+// @Param   name           query    string  false  "设备名称或网关SN(模糊查询)"
+// @Param   status         query    string  false  "状态：active/revoked"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /list [post]
+func (c *CredentialController) List() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.List(tenantId, c.GetString("kind"), c.GetString("name"), c.GetString("status"), page, size)
+	if err != nil {
+		c.Error(400, "查询凭证失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// Issue @Title 签发凭证
+// @Description 为设备或网关签发独立密钥并返回签名三元组，密钥仅返回一次
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   kind           query    string  true   "凭证类型：device/gateway"
+// @Param   name           query    string  true   "设备名称或网关SN"
+// @Param   checkTimestamp query    bool    false  "校验签名时间戳防重放，开启后设备须按当前时间重新签名，返回的三元组仅在 mqttSignWindow 内有效"
+// @Success 200 {object} services.CredentialResult
+// @Failure 400 "错误信息"
+// @router /issue [post]
+func (c *CredentialController) Issue() {
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	checkTimestamp, _ := c.GetBool("checkTimestamp")
+	result, err := c.service.Issue(tenantId, c.GetString("kind"), c.GetString("name"), checkTimestamp)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(result)
+}
+
+// Triplet @Title 生成三元组
+// @Description 使用当前密钥按当前时间戳重新生成 ClientId/Username/Password，开启时间戳校验的凭证超出 mqttSignWindow 后需重新生成
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "凭证ID"
+// @Success 200 {object} services.MqttTriplet
+// @Failure 400 "错误信息"
+// @router /triplet [post]
+func (c *CredentialController) Triplet() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	triplet, err := c.service.Triplet(tenantId, id)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(triplet)
+}
+
+// Rotate @Title 轮换密钥
+// @Description 生成新密钥，旧密钥在宽限期内仍可认证，便于设备平滑切换
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   true   "凭证ID"
+// @Param   grace          query    int64   false  "旧密钥宽限期(秒)，默认0立即失效"
+// @Success 200 {object} services.CredentialResult
+// @Failure 400 "错误信息"
+// @router /rotate [post]
+func (c *CredentialController) Rotate() {
+	id, _ := c.GetInt64("id")
+	grace, _ := c.GetInt64("grace")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.Rotate(tenantId, id, grace)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(result)
+}
+
+// Revoke @Title 吊销凭证
+// @Description 吊销后设备无法再连接及发布订阅，可通过轮换重新启用
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "凭证ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /revoke [post]
+func (c *CredentialController) Revoke() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.Revoke(tenantId, ids); err != nil {
+		c.Error(400, "吊销失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
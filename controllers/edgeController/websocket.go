@@ -3,7 +3,6 @@ package edgeController
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/beego/beego/v2/client/orm"
 	beego "github.com/beego/beego/v2/server/web"
 	"github.com/gorilla/websocket"
 	"iotServer/iotp"
@@ -64,6 +63,12 @@ func ReadWsMsg(ws *websocket.Conn) {
 			} else if o.Type == "write" {
 				log.Println("写入数据")
 				go writeData(o.Id, ws, o.Token, o.Val)
+			} else if o.Type == "shadow" {
+				log.Println("订阅设备影子")
+				go subscribeShadow(o.Ids, ws, o.Token)
+			} else if o.Type == "shadowPatch" {
+				log.Println("修改设备影子")
+				go patchShadow(o.Id, ws, o.Token, o.Val)
 			}
 		}
 	}
@@ -97,14 +102,15 @@ func writeData(id string, ws *websocket.Conn, token string, val string) error {
 	deviceCode, tagCode := parts[0], parts[1]
 
 	// 4. 准备响应模板
-	o := orm.NewOrm()
 	success := response{Code: 200, Message: "写入成功", Val: val}
 	fail := response{Code: 400, Message: "写入失败", Val: val}
 
 	// 5. 执行控制命令
+	// 等待结果期间不占用连接锁
 	mx.Lock()
-	defer mx.Unlock()
-	if _, ok := Clients[ws]; !ok {
+	_, ok = Clients[ws]
+	mx.Unlock()
+	if !ok {
 		return fmt.Errorf("连接已断开")
 	}
 
@@ -117,18 +123,21 @@ func writeData(id string, ws *websocket.Conn, token string, val string) error {
 		return nil
 	}
 
-	// 检查执行结果
-	time.Sleep(time.Second)
-	var logs models.WriteLog
-	if err := o.QueryTable(new(models.WriteLog)).Filter("seq", seq).One(&logs); err != nil {
+	// 等待命令结果（含超时重试）
+	logs, err := services.WaitCommand(seq, 60*time.Second)
+	if err != nil {
 		fail.Data = tagID
 		fail.Message = "写入失败"
 		ws.WriteJSON(fail)
-	} else if logs.Status != "SUCCESS" {
+	} else if logs.Status == models.WriteLogTimeout || logs.Status == models.WriteLogWait {
 		fail.Data = tagID
 		fail.Message = "写入超时"
 		log.Println("写入超时")
 		ws.WriteJSON(fail)
+	} else if logs.Status != models.WriteLogSuccess {
+		fail.Data = tagID
+		fail.Message = "写入失败"
+		ws.WriteJSON(fail)
 	} else {
 		success.Data = tagID
 		ws.WriteJSON(success)
@@ -182,6 +191,74 @@ func getRealData(ids []string, ws *websocket.Conn) {
 	}
 }
 
+var shadowService = services.ShadowService{}
+
+// tokenTenant 解析token获取租户
+func tokenTenant(token string) (int64, error) {
+	claims, ok := utils.ParseToken(token)
+	if !ok {
+		return 0, fmt.Errorf("token过期")
+	}
+	userId, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("无效的用户ID")
+	}
+	return models.GetUserTenantId(int64(userId))
+}
+
+// subscribeShadow 推送设备影子，版本变化时推送最新文档
+func subscribeShadow(ids []string, ws *websocket.Conn, token string) {
+	tenantId, err := tokenTenant(token)
+	if err != nil {
+		ws.WriteJSON(response{Code: 401, Message: err.Error()})
+		return
+	}
+	versions := make(map[string]int64)
+	for {
+		mx.Lock()
+		if _, ok := Clients[ws]; !ok {
+			mx.Unlock()
+			return
+		}
+		mx.Unlock()
+		for _, id := range ids {
+			if last, ok := versions[id]; ok && shadowService.Version(id) == last {
+				continue
+			}
+			doc, err := shadowService.Get(tenantId, id)
+			if err != nil {
+				ws.WriteJSON(response{Code: 400, Data: id, Message: err.Error()})
+				versions[id] = -1
+				continue
+			}
+			versions[id] = doc.Version
+			ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			ws.WriteJSON(response{Code: 200, Data: doc, Message: "shadow"})
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// patchShadow 修改设备影子期望状态，val 为期望状态JSON
+func patchShadow(id string, ws *websocket.Conn, token string, val string) {
+	tenantId, err := tokenTenant(token)
+	if err != nil {
+		ws.WriteJSON(response{Code: 401, Message: err.Error()})
+		return
+	}
+	var desired map[string]interface{}
+	if err := json.Unmarshal([]byte(val), &desired); err != nil || len(desired) == 0 {
+		ws.WriteJSON(response{Code: 400, Data: id, Message: "期望状态格式错误", Val: val})
+		return
+	}
+	doc, err := shadowService.PatchDesired(tenantId, id, desired, 0)
+	if err != nil {
+		ws.WriteJSON(response{Code: 400, Data: id, Message: err.Error(), Val: val})
+		return
+	}
+	ws.WriteJSON(response{Code: 200, Data: doc, Message: "shadow", Val: val})
+}
+
 // Get @Title WebSocket连接
 // @Description 建立WebSocket连接用于设备实时数据推送
 // @Success 101 {string} string "Switching Protocols (WebSocket连接升级成功)"
@@ -139,6 +139,41 @@ func (c *EkuiperController) GetRule() {
 
 }
 
+// Drift @Title 规则漂移
+// @Description 查看本地告警规则、场景、规则引擎与 eKuiper 规则的不一致，refresh 为 true 时立即核对（不修复）
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Param   refresh        query   bool    false "是否立即核对，默认返回最近一次结果"
+// @Success 200 {object} services.ReconcileReport
+// @Failure 400 "请求出错"
+// @router /drift [get]
+func (c *EkuiperController) Drift() {
+	refresh, _ := c.GetBool("refresh")
+	service := services.RuleReconcileService{}
+	report := service.LastReport()
+	if refresh || report == nil {
+		var err error
+		if report, err = service.Reconcile(false); err != nil {
+			c.Error(400, "规则核对失败: "+err.Error())
+		}
+	}
+	c.Success(report)
+}
+
+// Reconcile @Title 修复规则漂移
+// @Description 立即核对并重建缺失规则、同步运行状态、删除孤立规则
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Success 200 {object} services.ReconcileReport
+// @Failure 400 "请求出错"
+// @router /reconcile [post]
+func (c *EkuiperController) Reconcile() {
+	service := services.RuleReconcileService{}
+	report, err := service.Reconcile(true)
+	if err != nil {
+		c.Error(400, "规则核对失败: "+err.Error())
+	}
+	c.Success(report)
+}
+
 // AlertCallback
 // @Title 告警回调接口
 // @Description 接收Ekuiper规则触发的告警回调，参数为动态JSON
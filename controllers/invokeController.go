@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/services"
+)
+
+// InvokeController 物模型服务调用
+type InvokeController struct {
+	BaseController
+	service services.InvokeService
+}
+
+// Call @Title 调用设备服务
+// @Description 按服务定义的InputParams校验参数后下发到网关；SYNC服务等待设备返回并按OutputParams校验输出，ASYNC服务立即返回调用记录，结果通过回调地址或查询接口获取
+// @Param   Authorization  header   string              true   "Bearer YourToken"
+// @Param   body           body     dtos.InvokeRequest  true   "调用参数"
+// @Success 200 {object} models.ServiceInvoke
+// @Failure 400 "错误信息"
+// @router /call [post]
+func (c *InvokeController) Call() {
+	var req dtos.InvokeRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	record, err := c.service.Invoke(tenantId, userId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(record)
+}
+
+// Result @Title 调用结果
+// @Description 查询服务调用状态及输出：WAIT/SUCCESS/FAIL/TIMEOUT/EXPIRED
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   seq            query    string  true   "调用seq"
+// @Success 200 {object} models.ServiceInvoke
+// @Failure 400 "错误信息"
+// @router /result [post]
+func (c *InvokeController) Result() {
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	record, err := c.service.Result(tenantId, c.GetString("seq"))
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(record)
+}
+
+// List @Title 调用记录
+// @Description 分页查询服务调用记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Param   name           query    string  false  "设备名称"
+// @Param   service        query    string  false  "服务标识"
+// @Param   status         query    string  false  "调用状态"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /list [post]
+func (c *InvokeController) List() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.List(tenantId, c.GetString("name"), c.GetString("service"), c.GetString("status"), page, size)
+	if err != nil {
+		c.Error(400, "查询调用记录失败: "+err.Error())
+	}
+	c.Success(result)
+}
@@ -6,6 +6,7 @@ import (
 	"iotServer/models"
 	"iotServer/models/constants"
 	"iotServer/models/dtos"
+	"iotServer/services"
 	"iotServer/utils"
 	"strconv"
 	"strings"
@@ -83,6 +84,7 @@ func (c *ModelController) Delete() {
 	if err != nil {
 		c.Error(400, "删除失败")
 	}
+	services.InvalidateProductRule(productId)
 	c.SuccessMsg()
 }
 
@@ -154,6 +156,7 @@ func (c *ModelController) Create() {
 				c.Error(500, "保存属性失败: "+err.Error())
 			}
 		}
+		services.InvalidateProductRule(product.Id)
 
 		c.Success(property.Id)
 
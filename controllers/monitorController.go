@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"iotServer/services"
+)
+
+// MonitorController 运行状态监控
+type MonitorController struct {
+	BaseController
+}
+
+// QueueStats @Title 任务队列状态
+// @Description 查询MQTT任务内存队列与磁盘溢出队列的积压、延迟及累计计数
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Success 200 {object} services.JobQueueStats
+// @Failure 400 "请求出错"
+// @router /queue [get]
+func (c *MonitorController) QueueStats() {
+	c.Success(services.GetJobQueueStats())
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/services"
+	"log"
+)
+
+// MqttHookController MQTT Broker 认证/鉴权回调
+type MqttHookController struct {
+	BaseController
+}
+
+// mqttHookRequest Broker 回调参数，兼容JSON与表单
+type mqttHookRequest struct {
+	ClientId string `json:"clientid"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Topic    string `json:"topic"`
+	Action   string `json:"action"`
+}
+
+func (c *MqttHookController) parseRequest() mqttHookRequest {
+	// 校验 Broker 回调请求头，未配置 mqttHookToken 时拒绝全部回调，避免未认证调用方放行设备
+	token := beego.AppConfig.DefaultString("mqttHookToken", "")
+	if token == "" {
+		log.Printf("未配置 mqttHookToken，拒绝 MQTT Broker 认证/鉴权回调")
+		c.reply(false, false)
+	}
+	if c.Ctx.Input.Header("X-Hook-Token") != token {
+		c.reply(false, false)
+	}
+	var req mqttHookRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		req.ClientId = c.GetString("clientid")
+		req.Username = c.GetString("username")
+		req.Password = c.GetString("password")
+		req.Topic = c.GetString("topic")
+		req.Action = c.GetString("action")
+	}
+	return req
+}
+
+// reply 按 Broker HTTP 认证约定返回 allow/deny
+func (c *MqttHookController) reply(allow, superuser bool) {
+	result := "deny"
+	if allow {
+		result = "allow"
+	}
+	c.Data["json"] = map[string]interface{}{
+		"result":       result,
+		"is_superuser": superuser,
+	}
+	c.ServeJSON()
+	c.StopRun()
+}
+
+// Auth @Title MQTT连接认证
+// @Description Broker 在设备连接时回调，校验签名三元组
+// @Param   body  body  object  true  "{clientid, username, password}"
+// @Success 200 {object} map[string]interface{} "{result: allow/deny, is_superuser}"
+// @router /auth [post]
+func (c *MqttHookController) Auth() {
+	req := c.parseRequest()
+	allow, superuser := services.AuthenticateMqtt(req.ClientId, req.Username, req.Password)
+	c.reply(allow, superuser)
+}
+
+// Acl @Title MQTT发布订阅鉴权
+// @Description Broker 在发布/订阅时回调，设备只能访问自身SN的 /edge 主题及控制请求/响应主题
+// @Param   body  body  object  true  "{clientid, username, topic, action}"
+// @Success 200 {object} map[string]interface{} "{result: allow/deny}"
+// @router /acl [post]
+func (c *MqttHookController) Acl() {
+	req := c.parseRequest()
+	c.reply(services.AuthorizeMqtt(req.Username, req.Topic, req.Action), false)
+}
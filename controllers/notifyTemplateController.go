@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"encoding/json"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/services"
+	"iotServer/utils"
+)
+
+// NotifyTemplateController 通知模板
+type NotifyTemplateController struct {
+	BaseController
+	service services.NotifyTemplateService
+}
+
+// Save @Title 保存通知模板
+// @Description 新增或修改通知模板，按规则、通知方式、告警类型匹配，均为空时作为租户默认模板。模板使用 Go text/template 语法，可用变量：Rule、Level、Trigger、Device、DeviceDesc、Property、Code、Value、Type、Cycle、Event、WindowStart、WindowEnd、Time、Position、Department、Occurrences、Escalated、Text
+// @Param   Authorization  header   string                      true   "Bearer YourToken"
+// @Param   body           body     dtos.NotifyTemplateRequest  true   "模板内容"
+// @Success 200 {object} models.NotifyTemplate
+// @Failure 400 "错误信息"
+// @router /template/save [post]
+func (c *NotifyTemplateController) Save() {
+	var req dtos.NotifyTemplateRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	t, err := c.service.Save(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(t)
+}
+
+// List @Title 通知模板列表
+// @Description 分页查询通知模板
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Param   ruleId         query    int64   false  "规则ID"
+// @Param   channel        query    string  false  "通知方式"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /template/list [post]
+func (c *NotifyTemplateController) List() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	ruleId, _ := c.GetInt64("ruleId")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.List(tenantId, ruleId, c.GetString("channel"), page, size)
+	if err != nil {
+		c.Error(400, "查询通知模板失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// Delete @Title 删除通知模板
+// @Description 删除后匹配不到模板的通知使用内置文本
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "模板ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /template/delete [post]
+func (c *NotifyTemplateController) Delete() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.Delete(tenantId, ids); err != nil {
+		c.Error(400, "删除通知模板失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// Preview @Title 预览通知模板
+// @Description 以示例告警或指定告警渲染模板，返回渲染后的标题、内容及对应通知方式实际发送的消息体
+// @Param   Authorization  header   string                             true   "Bearer YourToken"
+// @Param   body           body     dtos.NotifyTemplatePreviewRequest  true   "模板内容"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /template/preview [post]
+func (c *NotifyTemplateController) Preview() {
+	var req dtos.NotifyTemplatePreviewRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.Preview(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(result)
+}
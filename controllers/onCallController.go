@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"encoding/json"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/services"
+	"iotServer/utils"
+)
+
+// OnCallController 通知接收人联系方式与值班表
+type OnCallController struct {
+	BaseController
+	service services.OnCallService
+}
+
+// SaveContact @Title 保存联系方式
+// @Description 保存用户的邮箱、手机号及企业微信、钉钉、飞书账号，告警按接收人通知时使用
+// @Param   Authorization  header   string                      true   "Bearer YourToken"
+// @Param   body           body     dtos.ContactProfileRequest  true   "联系方式"
+// @Success 200 {object} models.ContactProfile
+// @Failure 400 "错误信息"
+// @router /contact/save [post]
+func (c *OnCallController) SaveContact() {
+	var req dtos.ContactProfileRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	profile, err := c.service.SaveContact(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(profile)
+}
+
+// ListContacts @Title 联系方式列表
+// @Description 分页查询用户联系方式
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /contact/list [post]
+func (c *OnCallController) ListContacts() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.ListContacts(tenantId, page, size)
+	if err != nil {
+		c.Error(400, "查询联系方式失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// SaveSchedule @Title 保存值班表
+// @Description 成员按顺序按天、按周或按固定时长轮换，交接时间及生效时间段按值班表时区计算
+// @Param   Authorization  header   string                      true   "Bearer YourToken"
+// @Param   body           body     dtos.OnCallScheduleRequest  true   "值班表"
+// @Success 200 {object} models.OnCallSchedule
+// @Failure 400 "错误信息"
+// @router /oncall/save [post]
+func (c *OnCallController) SaveSchedule() {
+	var req dtos.OnCallScheduleRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	schedule, err := c.service.SaveSchedule(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(schedule)
+}
+
+// ListSchedules @Title 值班表列表
+// @Description 分页查询值班表
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /oncall/list [post]
+func (c *OnCallController) ListSchedules() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.ListSchedules(tenantId, page, size)
+	if err != nil {
+		c.Error(400, "查询值班表失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// DeleteSchedules @Title 删除值班表
+// @Description 删除值班表及其替换记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "值班表ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /oncall/delete [post]
+func (c *OnCallController) DeleteSchedules() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.DeleteSchedules(tenantId, ids); err != nil {
+		c.Error(400, "删除值班表失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// AddOverride @Title 新增值班替换
+// @Description 时间段内由指定用户代替轮换值班人
+// @Param   Authorization  header   string                      true   "Bearer YourToken"
+// @Param   body           body     dtos.OnCallOverrideRequest  true   "值班替换"
+// @Success 200 {object} models.OnCallOverride
+// @Failure 400 "错误信息"
+// @router /oncall/override/add [post]
+func (c *OnCallController) AddOverride() {
+	var req dtos.OnCallOverrideRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	override, err := c.service.AddOverride(tenantId, req)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(override)
+}
+
+// ListOverrides @Title 值班替换列表
+// @Description 查询值班表的替换记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   scheduleId     query    int64   true   "值班表ID"
+// @Success 200 {object} []models.OnCallOverride
+// @Failure 400 "错误信息"
+// @router /oncall/override/list [post]
+func (c *OnCallController) ListOverrides() {
+	scheduleId, _ := c.GetInt64("scheduleId")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	list, err := c.service.ListOverrides(tenantId, scheduleId)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(list)
+}
+
+// DeleteOverrides @Title 删除值班替换
+// @Description 删除值班替换记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "替换记录ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /oncall/override/delete [post]
+func (c *OnCallController) DeleteOverrides() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.DeleteOverrides(tenantId, ids); err != nil {
+		c.Error(400, "删除值班替换失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// Current @Title 当前值班人
+// @Description 查询值班表在指定时间的值班人，生效时间段外无值班人
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   scheduleId     query    int64   true   "值班表ID"
+// @Param   time           query    int64   false  "时间(秒)，默认当前时间"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /oncall/current [post]
+func (c *OnCallController) Current() {
+	scheduleId, _ := c.GetInt64("scheduleId")
+	at, _ := c.GetInt64("time")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.Current(tenantId, scheduleId, at)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(result)
+}
+
+// Resolve @Title 解析通知接收人
+// @Description 预览接收人(用户、角色、部门、值班表)在当前时间解析出的联系方式
+// @Param   Authorization  header   string                    true   "Bearer YourToken"
+// @Param   body           body     []models.NotifyRecipient  true   "接收人"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /recipient/resolve [post]
+func (c *OnCallController) Resolve() {
+	var recipients []models.NotifyRecipient
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &recipients); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	c.Success(c.service.Resolve(tenantId, recipients))
+}
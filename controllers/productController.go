@@ -256,6 +256,9 @@ func (c *ProductController) Create() {
 // @Param   status      query    bool   true  "是否启用"
 // @Param	description	query	string	false	"描述"
 // @Param   categoryId  query   int64   false "内置标准物模型品类"
+// @Param   validatePolicy query string false "上报数据校验策略:none不校验/reject丢弃/clamp裁剪/mark标记质量Bad，不传则不修改"
+// @Param   cmdTimeout  query   int     false "控制命令响应超时(秒)，0使用全局配置，不传则不修改"
+// @Param   cmdRetries  query   int     false "控制命令超时重试次数，0使用全局配置，-1不重试，不传则不修改"
 // @Success 200 {object} controllers.SimpleResult "操作成功"
 // @Failure 400 参数错误 / 无权限
 // @router /update [post]
@@ -281,6 +284,21 @@ func (c *ProductController) Update() {
 	if description := c.GetString("description"); description != "" {
 		product.Description = description
 	}
+	if policy := c.GetString("validatePolicy"); policy != "" {
+		if policy == "none" {
+			policy = models.ValidatePolicyNone
+		}
+		if !models.IsValidValidatePolicy(policy) {
+			c.Error(400, "不支持的校验策略: "+policy)
+		}
+		product.ValidatePolicy = policy
+	}
+	if cmdTimeout, err := c.GetInt("cmdTimeout"); err == nil && c.GetString("cmdTimeout") != "" {
+		product.CmdTimeout = cmdTimeout
+	}
+	if cmdRetries, err := c.GetInt("cmdRetries"); err == nil && c.GetString("cmdRetries") != "" {
+		product.CmdRetries = cmdRetries
+	}
 	status, _ := c.GetBool("status")
 	product.Status = convertStatus(status)
 
@@ -350,6 +368,7 @@ func (c *ProductController) Update() {
 	if err != nil {
 		c.Error(400, "更新失败")
 	}
+	services.InvalidateProductRule(product.Id)
 
 	// 同步生成超级表 1、创建产品时生成对应的超级表 2、上传的设备找到对应的超级表 3、产品标签打上分组
 	service, err := services.NewTDengineService()
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"iotServer/models"
+	"iotServer/services"
+	"iotServer/utils"
+)
+
+// ProvisionController 未注册设备审批与自动注册规则
+type ProvisionController struct {
+	BaseController
+	service services.ProvisionService
+}
+
+// PendingList @Title 待审批设备列表
+// @Description 查询上报数据但尚未注册的设备，包含网关SN及观测到的属性
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   page           query    int     false  "当前页码，默认1"
+// @Param   size           query    int     false  "每页数量，默认10"
+// @Param   sn             query    string  false  "网关SN"
+// @Param   name           query    string  false  "设备名称(模糊查询)"
+// @Param   status         query    string  false  "状态：pending/approved/ignored"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /pending/list [post]
+func (c *ProvisionController) PendingList() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	result, err := c.service.ListPending(tenantId, c.GetString("sn"), c.GetString("name"), c.GetString("status"), page, size)
+	if err != nil {
+		c.Error(400, "查询待审批设备失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// PendingApprove @Title 审批设备
+// @Description 将待审批设备注册到产品，走设备绑定流程创建子表
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "待审批记录ID列表，逗号分隔"
+// @Param   productId      query    int64   true   "产品ID"
+// @Param   positionId     query    int64   false  "位置ID"
+// @Param   groupId        query    int64   false  "分组ID"
+// @Success 200 {object} map[string]interface{} "审批结果"
+// @Failure 400 "错误信息"
+// @router /pending/approve [post]
+func (c *ProvisionController) PendingApprove() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	productId, _ := c.GetInt64("productId")
+	if productId <= 0 {
+		c.Error(400, "产品ID必须大于0")
+	}
+	positionId, _ := c.GetInt64("positionId")
+	groupId, _ := c.GetInt64("groupId")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	succeeded, failed, err := c.service.Approve(tenantId, ids, productId, positionId, groupId)
+	if err != nil {
+		c.Error(400, "审批失败: "+err.Error())
+	}
+	c.Success(map[string]interface{}{
+		"succeeded": succeeded,
+		"failed":    failed,
+	})
+}
+
+// PendingIgnore @Title 忽略设备
+// @Description 忽略待审批设备，之后的上报不再记录
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "待审批记录ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /pending/ignore [post]
+func (c *ProvisionController) PendingIgnore() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.Ignore(tenantId, ids); err != nil {
+		c.Error(400, "操作失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// PendingDelete @Title 删除待审批记录
+// @Description 删除待审批记录，设备再次上报时会重新出现
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "待审批记录ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /pending/delete [post]
+func (c *ProvisionController) PendingDelete() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.DeletePending(tenantId, ids); err != nil {
+		c.Error(400, "删除失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
+
+// RuleList @Title 自动注册规则列表
+// @Description 查询网关自动注册规则
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   sn             query    string  false  "网关SN"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /rule/list [post]
+func (c *ProvisionController) RuleList() {
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	rules, err := c.service.ListRules(tenantId, c.GetString("sn"))
+	if err != nil {
+		c.Error(400, "查询规则失败: "+err.Error())
+	}
+	c.Success(rules)
+}
+
+// RuleSave @Title 保存自动注册规则
+// @Description 网关下设备名称匹配通配符时自动注册到产品，保存后对现有待审批设备立即生效
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   id             query    int64   false  "规则ID,(新增/修改)"
+// @Param   sn             query    string  true   "网关SN，* 表示本租户所有网关"
+// @Param   pattern        query    string  true   "设备名称通配符，如 meter_*"
+// @Param   productId      query    int64   true   "产品ID"
+// @Param   positionId     query    int64   false  "位置ID"
+// @Param   groupId        query    int64   false  "分组ID"
+// @Param   priority       query    int     false  "优先级，越大越先匹配"
+// @Param   enabled        query    bool    false  "是否启用，默认启用"
+// @Param   description    query    string  false  "描述"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /rule/save [post]
+func (c *ProvisionController) RuleSave() {
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	var rule models.ProvisionRule
+	rule.Id, _ = c.GetInt64("id")
+	rule.GWSN = c.GetString("sn")
+	rule.Pattern = c.GetString("pattern")
+	rule.ProductId, _ = c.GetInt64("productId")
+	rule.PositionId, _ = c.GetInt64("positionId")
+	rule.GroupId, _ = c.GetInt64("groupId")
+	rule.Priority, _ = c.GetInt("priority")
+	rule.Enabled, _ = c.GetBool("enabled", true)
+	rule.Description = c.GetString("description")
+
+	if err := c.service.SaveRule(tenantId, &rule); err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(rule.Id)
+}
+
+// RuleDelete @Title 删除自动注册规则
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "规则ID列表，逗号分隔"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /rule/delete [post]
+func (c *ProvisionController) RuleDelete() {
+	ids, err := utils.GetResourceIds(c.GetString("ids"))
+	if err != nil || len(ids) == 0 {
+		c.Error(400, "ids不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if err := c.service.DeleteRule(tenantId, ids); err != nil {
+		c.Error(400, "删除失败: "+err.Error())
+	}
+	c.SuccessMsg()
+}
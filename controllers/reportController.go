@@ -8,6 +8,7 @@ import (
 	"io"
 	"iotServer/models"
 	"iotServer/services"
+	"iotServer/utils"
 	"path/filepath"
 	"strings"
 )
@@ -401,3 +402,98 @@ func (c *ReportController) SinglePointInsert() {
 		"message": "单点补录成功",
 	})
 }
+
+// DeadLetterList @Title 死信列表
+// @Description 查询写入TDengine失败的上报数据
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   dn             query    string  false  "设备名称"
+// @Param   status         query    string  false  "状态(pending/replayed/discarded)"
+// @Param   page           query    int     false  "页码，默认1"
+// @Param   size           query    int     false  "每页大小，默认10"
+// @Success 200 {object} utils.PageResult "死信数据"
+// @Failure 400 "错误信息"
+// @router /deadLetter/list [post]
+func (c *ReportController) DeadLetterList() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	dn := c.GetString("dn")
+	status := c.GetString("status")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	service := services.DeadLetterService{}
+	result, err := service.List(tenantId, dn, status, page, size)
+	if err != nil {
+		c.Error(400, "查询死信失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
+// DeadLetterReplay @Title 死信重放
+// @Description 修复表结构或TDengine后重新写入死信数据，不传ids则重放全部待处理死信
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  false  "死信ID列表，逗号分隔"
+// @Success 200 {object} map[string]interface{} "重放结果"
+// @Failure 400 "错误信息"
+// @router /deadLetter/replay [post]
+func (c *ReportController) DeadLetterReplay() {
+	// 不传ids时重放全部，传入时须全部为合法ID，避免格式错误退化为重放全部
+	var ids []int64
+	if raw := strings.TrimSpace(c.GetString("ids")); raw != "" {
+		var ok bool
+		if ids, ok = parseDeadLetterIds(raw); !ok {
+			c.Error(400, "ids格式错误")
+		}
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	service := services.DeadLetterService{}
+	succeeded, failed, err := service.Replay(tenantId, ids)
+	if err != nil {
+		c.Error(400, "重放失败: "+err.Error())
+	}
+	c.Success(map[string]interface{}{
+		"succeeded": succeeded,
+		"failed":    failed,
+	})
+}
+
+// DeadLetterDelete @Title 删除死信
+// @Description 删除不再需要重放的死信数据
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   ids            query    string  true   "死信ID列表，逗号分隔"
+// @Success 200 {object} map[string]interface{} "删除结果"
+// @Failure 400 "错误信息"
+// @router /deadLetter/delete [post]
+func (c *ReportController) DeadLetterDelete() {
+	ids, ok := parseDeadLetterIds(strings.TrimSpace(c.GetString("ids")))
+	if !ok {
+		c.Error(400, "ids格式错误")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	service := services.DeadLetterService{}
+	count, err := service.Delete(tenantId, ids)
+	if err != nil {
+		c.Error(400, "删除死信失败: "+err.Error())
+	}
+	c.Success(map[string]interface{}{
+		"deleted": count,
+	})
+}
+
+// parseDeadLetterIds 解析逗号分隔的死信ID，须非空且每一项都是正整数
+func parseDeadLetterIds(raw string) ([]int64, bool) {
+	ids, _ := utils.GetResourceIds(raw)
+	if len(ids) == 0 || len(ids) != len(strings.Split(raw, ",")) {
+		return nil, false
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, false
+		}
+	}
+	return ids, true
+}
@@ -9,6 +9,7 @@ import (
 	"iotServer/models"
 	"iotServer/models/constants"
 	"iotServer/models/dtos"
+	"iotServer/services"
 	"iotServer/utils"
 	"strings"
 	"time"
@@ -69,43 +70,55 @@ func (c *RuleController) Edit() {
 func (c *RuleController) Update() {
 	// 1. 初步解析请求参数
 	var req dtos.RuleUpdateRequest
-	var typeStyle string
 	if err := json.NewDecoder(c.Ctx.Request.Body).Decode(&req); err != nil {
 		c.Error(400, "参数解析失败: "+err.Error())
 	}
+	if len(req.SubRule) == 0 {
+		c.Error(400, "子规则不能为空")
+	}
 	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
 	tenantId, _ := models.GetUserTenantId(userId)
-	// 2. 取出设备及属性类型
+	// 2. 取出各子规则的设备及属性类型
 	o := orm.NewOrm()
-	ids := req.SubRule[0].DeviceId
-
-	if req.SubRule[0].Trigger == string(constants.DeviceDataTrigger) {
-		code := req.SubRule[0].Option["code"]
-		productId := req.SubRule[0].ProductId
+	var ids []string
+	seen := make(map[string]bool)
+	typeStyles := make([]string, len(req.SubRule))
+	for i, subRule := range req.SubRule {
+		for _, id := range subRule.DeviceId {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if subRule.Trigger != string(constants.DeviceDataTrigger) {
+			continue
+		}
 		var property models.Properties
-		err := o.QueryTable(new(models.Properties)).Filter("code", code).Filter("product_id", productId).One(&property)
+		err := o.QueryTable(new(models.Properties)).Filter("code", subRule.Option["code"]).Filter("product_id", subRule.ProductId).One(&property)
 		if err != nil {
-			c.Error(400, "属性类型不存在")
+			c.Error(400, fmt.Sprintf("子规则%d属性类型不存在", i+1))
 		}
 
 		var specs map[string]string
 		err = json.Unmarshal([]byte(property.TypeSpec), &specs)
 		if err != nil {
-			c.Error(400, "属性类型有误")
+			c.Error(400, fmt.Sprintf("子规则%d属性类型有误", i+1))
 		}
-		typeStyle = specs["type"] // int float text ..
+		typeStyles[i] = specs["type"] // int float text ..
 	}
 
 	// 3. 校验参数结构
-	err := dtos.ValidateRuleUpdateRequest(&req, typeStyle)
+	err := dtos.ValidateRuleUpdateRequest(&req, typeStyles)
 	if err != nil {
 		c.Error(400, "参数有误："+err.Error())
 	}
 
-	// 4. 构建 SQL 语句
-	sql := req.BuildEkuiperSql(ids, typeStyle)
-	if sql == "" {
-		c.Error(400, "SQL 生成失败")
+	// 4. 每个子规则构建一条 SQL，多个子规则的 all/anyone 关系在告警回调中按关联窗口判断
+	sqls := make([]string, len(req.SubRule))
+	for i := range req.SubRule {
+		if sqls[i] = req.BuildSubRuleSql(i, typeStyles[i]); sqls[i] == "" {
+			c.Error(400, fmt.Sprintf("子规则%d SQL 生成失败", i+1))
+		}
 	}
 
 	// 5. 构建上下文
@@ -125,36 +138,52 @@ func (c *RuleController) Update() {
 		c.Error(400, "规则不存在，请创建后配置")
 	}
 
-	if err := common.Ekuiper.RuleExist(ctx, req.Name+"__Rule"); err == nil {
-		err = common.Ekuiper.UpdateRule(ctx, actions, req.Name+"__Rule", sql)
-		if err != nil {
-			c.Error(400, "更新规则失败: "+err.Error())
+	// 子规则减少时删除多余的 eKuiper 规则
+	oldRuleIds := alertRule.EkuiperRuleIds()
+	for i := len(req.SubRule); i < len(oldRuleIds); i++ {
+		if err := common.Ekuiper.DeleteRule(ctx, oldRuleIds[i]); err != nil && !strings.Contains(err.Error(), "not found") {
+			c.Error(400, "删除多余子规则失败: "+err.Error())
 		}
-	} else {
-		err = common.Ekuiper.CreateRule(ctx, actions, req.Name+"__Rule", sql)
-		if err != nil {
-			c.Error(400, "更新规则失败: "+err.Error())
+	}
+	for i, sql := range sqls {
+		ruleId := models.AlertEkuiperRuleId(req.Name, i)
+		if err := common.Ekuiper.RuleExist(ctx, ruleId); err == nil {
+			err = common.Ekuiper.UpdateRule(ctx, actions, ruleId, sql)
+			if err != nil {
+				c.Error(400, "更新规则失败: "+err.Error())
+			}
+		} else {
+			err = common.Ekuiper.CreateRule(ctx, actions, ruleId, sql)
+			if err != nil {
+				c.Error(400, "更新规则失败: "+err.Error())
+			}
+			alertRule.Status = string(constants.RuleStart)
+			alertRule.Department = &models.Department{Id: tenantId}
 		}
-		alertRule.Condition = string(constants.WorkerConditionAnyone)
-		alertRule.Status = string(constants.RuleStart)
-		alertRule.Department = &models.Department{Id: tenantId}
 	}
 
 	// 7 . 全部操作完成写盘保存
+	alertRule.Condition = string(req.Condition)
+	alertRule.Window = req.Window
 	alertRule.SilenceTime = req.SilenceTime
 	idsJson, _ := json.Marshal(ids)
 	subRuleJson, _ := json.Marshal(req.SubRule)
 	subNotifyJson, _ := json.Marshal(req.Notify)
+	escalationJson, _ := json.Marshal(req.Escalation)
+	alertRule.Escalation = string(escalationJson)
+	alertRule.GroupBy = req.GroupBy
 	alertRule.DeviceId = string(idsJson)
 	alertRule.SubRule = string(subRuleJson)
 	alertRule.Notify = string(subNotifyJson)
 	//更新规则后，规则需要启动后restart
 	if alertRule.Status == string(constants.RuleStart) {
-		err = common.Ekuiper.StartRule(ctx, req.Name+"__Rule")
-		err = common.Ekuiper.RestartRule(ctx, req.Name+"__Rule")
-		if err != nil {
-			c.Error(400, "规则启动失败"+err.Error())
-			alertRule.Status = string(constants.RuleStop)
+		for _, ruleId := range alertRule.EkuiperRuleIds() {
+			err = common.Ekuiper.StartRule(ctx, ruleId)
+			err = common.Ekuiper.RestartRule(ctx, ruleId)
+			if err != nil {
+				c.Error(400, "规则启动失败"+err.Error())
+				alertRule.Status = string(constants.RuleStop)
+			}
 		}
 	}
 
@@ -169,8 +198,30 @@ func (c *RuleController) Update() {
 	})
 }
 
+// Backtest @Title 回测告警规则
+// @Description 用历史数据回测设备数据触发子规则，返回时间范围内会产生的告警（考虑静默时间）
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Param   body    		body    dtos.RuleBacktestRequest  true  "子规则及时间范围"
+// @Success 200 {object} services.BacktestResult
+// @Failure 400 "请求出错"
+// @router /backtest [post]
+func (c *RuleController) Backtest() {
+	var req dtos.RuleBacktestRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+	service := services.RuleBacktestService{}
+	result, err := service.Backtest(tenantId, req)
+	if err != nil {
+		c.Error(400, "回测失败: "+err.Error())
+	}
+	c.Success(result)
+}
+
 // GetRuleStatus @Title 获取规则状态详情
-// @Description 获取指定规则或全部规则的状态信息
+// @Description 获取指定规则或全部规则的状态信息，多子规则的告警规则全部子规则运行时为 running，subRules 为各子规则状态
 // @Param   Authorization  header  string  true  "Bearer YourToken"
 // @Param   ruleId     	   query    string  false  "规则ID,不填默认查询全部"
 // @Success 200 {object} controllers.SimpleResult
@@ -191,21 +242,56 @@ func (c *RuleController) GetRuleStatus() {
 		}
 
 	} else {
-		// 检查规则是否存在
-		err = common.Ekuiper.RuleExist(ctx, ruleID+"__Rule")
-		if err != nil {
-			c.Error(400, "检查规则存在性失败: "+err.Error())
+		userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+		tenantId, _ := models.GetUserTenantId(userId)
+		rule := models.AlertRule{Name: ruleID}
+		if err := orm.NewOrm().Read(&rule, "Name"); err != nil || rule.Department == nil || rule.Department.Id != tenantId {
+			c.Error(400, "rule not found or no permission")
 		}
 
-		// 获取规则状态
-		stats, err = common.Ekuiper.GetRuleStats(ctx, ruleID+"__Rule")
-		if err != nil {
-			c.Error(400, "获取规则状态失败: "+err.Error())
+		// 多子规则的告警规则对应多条 eKuiper 规则，逐条查询状态
+		ruleIds := rule.EkuiperRuleIds()
+		subStats := make(map[string]interface{}, len(ruleIds))
+		for _, ruleId := range ruleIds {
+			// 检查规则是否存在
+			if err = common.Ekuiper.RuleExist(ctx, ruleId); err != nil {
+				c.Error(400, "检查规则存在性失败: "+err.Error())
+			}
+
+			// 获取规则状态
+			ruleStats, err := common.Ekuiper.GetRuleStats(ctx, ruleId)
+			if err != nil {
+				c.Error(400, "获取规则状态失败: "+err.Error())
+			}
+			subStats[ruleId] = ruleStats
+		}
+		if len(ruleIds) == 1 {
+			stats = subStats[ruleIds[0]].(map[string]interface{})
+		} else {
+			stats = combineRuleStats(subStats)
 		}
 	}
 	c.Success(stats)
 }
 
+// combineRuleStats 汇总多条子规则的状态，全部运行时为 running，否则为 stopped，subRules 为各子规则的状态
+func combineRuleStats(subStats map[string]interface{}) map[string]interface{} {
+	status := "running"
+	subStatus := make(map[string]interface{}, len(subStats))
+	for ruleId, stats := range subStats {
+		s, _ := stats.(map[string]interface{})["status"].(string)
+		if s != "running" {
+			status = "stopped"
+		}
+		subStatus[ruleId] = s
+	}
+	return map[string]interface{}{
+		"status":   status,
+		"subRules": subStatus,
+		"details":  subStats,
+	}
+}
+
 // OperateRule @Title 启动/停止/重启/删除规则
 // @Description 操作指定的Ekuiper规则
 // @Param   Authorization  header  string  true  "Bearer YourToken"
@@ -238,29 +324,33 @@ func (c *RuleController) OperateRule() {
 	var message string
 	flag := false
 
+	var operate func(context.Context, string) error
 	switch req.Action {
 	case "start":
-		err = common.Ekuiper.StartRule(ctx, req.RuleID+"__Rule")
+		operate = common.Ekuiper.StartRule
 		message = "规则已启动"
 		rule.Status = string(constants.RuleStart)
 	case "stop":
-		err = common.Ekuiper.StopRule(ctx, req.RuleID+"__Rule")
+		operate = common.Ekuiper.StopRule
 		message = "规则已停止"
 		rule.Status = string(constants.RuleStop)
 	case "delete":
-		err = common.Ekuiper.DeleteRule(ctx, req.RuleID+"__Rule")
+		operate = common.Ekuiper.DeleteRule
 		message = "规则已删除"
 		flag = true
 	case "restart":
-		err = common.Ekuiper.RestartRule(ctx, req.RuleID+"__Rule")
+		operate = common.Ekuiper.RestartRule
 		message = "规则已重启"
 		rule.Status = string(constants.RuleStart)
 	default:
 		c.Error(400, "无效的操作类型，仅支持 start、stop、restart、delete")
 	}
 
-	if err != nil && !strings.Contains(err.Error(), "not found") {
-		c.Error(400, fmt.Sprintf("%s失败: %v", message, err))
+	// 多子规则的告警规则对应多条 eKuiper 规则，逐条操作
+	for _, ruleId := range rule.EkuiperRuleIds() {
+		if err = operate(ctx, ruleId); err != nil && !strings.Contains(err.Error(), "not found") {
+			c.Error(400, fmt.Sprintf("%s失败: %v", message, err))
+		}
 	}
 
 	// 更新数据库规则状态
@@ -13,7 +13,7 @@ import (
 	"time"
 )
 
-var GlobalSceneService = services.NewSceneService()
+var GlobalSceneService = services.GlobalSceneService
 
 // SceneController 场景管理
 type SceneController struct {
@@ -121,10 +121,18 @@ func (c *SceneController) Update() {
 		c.Error(400, "scene not found or no permission")
 	}
 
+	if err := services.ValidateSceneConditions(req.Condition); err != nil {
+		c.Error(400, err.Error())
+	}
+	if err := services.ValidateSceneActions(req.Action); err != nil {
+		c.Error(400, err.Error())
+	}
+
 	ActionMarshal, _ := json.Marshal(req.Action)
 	ConditionMarshal, _ := json.Marshal(req.Condition)
 	scene.Action = string(ActionMarshal)
 	scene.Condition = string(ConditionMarshal)
+	scene.ContinueOnError = req.ContinueOnError
 
 	// 先更新场景数据
 	if _, err := o.Update(&scene); err != nil {
@@ -134,10 +142,11 @@ func (c *SceneController) Update() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	//生成场景联动
-	if req.Condition[0].ConditionType == "notify" && req.Id != 0 {
+	//生成场景联动，限制条件在触发时校验
+	trigger, _ := dtos.SceneTrigger(req.Condition)
+	if trigger.ConditionType == string(constants.ConditionTypeNotify) && req.Id != 0 {
 		services.BuildEkuiperRule(ctx, req, scene.Name)
-	} else if req.Condition[0].ConditionType == "timer" && req.Id != 0 {
+	} else if trigger.ConditionType == string(constants.ConditionTypeTimer) && req.Id != 0 {
 		if err := c.sceneService.StopScene(req.Id, userId); err != nil {
 			c.Error(400, fmt.Sprintf(err.Error()))
 		}
@@ -190,6 +199,69 @@ func (c *SceneController) OperateScene() {
 	c.SuccessMsg()
 }
 
+// LogList @Title 查询场景执行记录
+// @Description 分页查询场景的执行记录，包含触发来源与执行结果
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Param   sceneId        query   int     false "场景ID"
+// @Param   status         query   string  false "执行结果 running/success/partial/failed"
+// @Param   source         query   string  false "触发来源 cron/callback/manual"
+// @Param   page           query   int     false "当前页码，默认1"
+// @Param   size           query   int     false "每页数量，默认10"
+// @Success 200 {object} controllers.Result
+// @Failure 400 "请求出错"
+// @router /log/list [post]
+func (c *SceneController) LogList() {
+	page, _ := c.GetInt("page", 1)
+	size, _ := c.GetInt("size", 10)
+	sceneId, _ := c.GetInt64("sceneId")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	paginate, err := c.sceneService.SceneLogList(tenantId, sceneId, c.GetString("status"), c.GetString("source"), page, size)
+	if err != nil {
+		c.Error(400, "查询失败")
+	}
+	c.Success(paginate)
+}
+
+// LogDetail @Title 场景执行详情
+// @Description 查看一次场景执行中各动作的控制命令序号及最新状态
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Param   id             query   int     true  "执行记录ID"
+// @Success 200 {object} dtos.SceneLogDetailResponse
+// @Failure 400 "请求出错"
+// @router /log/detail [get]
+func (c *SceneController) LogDetail() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	detail, err := c.sceneService.SceneLogDetail(tenantId, id)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(detail)
+}
+
+// Analyze @Title 场景冲突及循环检测
+// @Description 分析场景启动后与租户内运行中场景的循环触发及冲突写入，启动场景时按相同规则拒绝或提示
+// @Param   Authorization  header  string  true  "Bearer YourToken"
+// @Param   id             query   int     true  "场景ID"
+// @Success 200 {object} services.SceneAnalysis
+// @Failure 400 "请求出错"
+// @router /analyze [get]
+func (c *SceneController) Analyze() {
+	id, _ := c.GetInt64("id")
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	analysis, err := c.sceneService.AnalyzeScene(tenantId, id)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(analysis)
+}
+
 // GetSceneStatus @Title 获取场景状态详情
 // @Description 获取指定场景或全部场景的状态信息,仅查询已启动的场景
 // @Param   Authorization  header  string  true  "Bearer YourToken"
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/services"
+)
+
+// ShadowController 设备影子
+type ShadowController struct {
+	BaseController
+	service services.ShadowService
+}
+
+// Get @Title 获取设备影子
+// @Description 返回设备的上报状态、期望状态、差异及版本号
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   name           query    string  true   "设备名称"
+// @Success 200 {object} services.ShadowDocument
+// @Failure 400 "错误信息"
+// @router /get [post]
+func (c *ShadowController) Get() {
+	name := c.GetString("name")
+	if name == "" {
+		c.Error(400, "设备名称不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	doc, err := c.service.Get(tenantId, name)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(doc)
+}
+
+// Desired @Title 修改期望状态
+// @Description 合并修改设备影子的期望状态，值为null时删除该属性，差异会立即下发到网关，设备离线时在重新上线后下发
+// @Param   Authorization  header   string                   true   "Bearer YourToken"
+// @Param   body           body     dtos.ShadowPatchRequest  true   "期望状态"
+// @Success 200 {object} services.ShadowDocument
+// @Failure 400 "错误信息"
+// @Failure 409 "版本冲突"
+// @router /desired [post]
+func (c *ShadowController) Desired() {
+	var req dtos.ShadowPatchRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Error(400, "参数解析失败: "+err.Error())
+	}
+	if req.Name == "" || len(req.Desired) == 0 {
+		c.Error(400, "设备名称和期望状态不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	doc, err := c.service.PatchDesired(tenantId, req.Name, req.Desired, req.Version)
+	if errors.Is(err, services.ErrShadowVersionConflict) {
+		c.Error(409, err.Error())
+	}
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(doc)
+}
+
+// Sync @Title 下发影子差异
+// @Description 手动将期望与上报不一致的属性重新下发到网关
+// @Param   Authorization  header   string  true   "Bearer YourToken"
+// @Param   name           query    string  true   "设备名称"
+// @Success 200 {object} controllers.SimpleResult
+// @Failure 400 "错误信息"
+// @router /sync [post]
+func (c *ShadowController) Sync() {
+	name := c.GetString("name")
+	if name == "" {
+		c.Error(400, "设备名称不能为空")
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	sent, err := c.service.Sync(tenantId, name)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(map[string]interface{}{"sent": sent})
+}
@@ -5,6 +5,7 @@ import (
 	"iotServer/models"
 	"iotServer/services"
 	"iotServer/utils"
+	"time"
 )
 
 type WriteController struct {
@@ -17,24 +18,70 @@ type WriteController struct {
 // @Param deviceCode query  string true "设备"
 // @Param tagCode    query  string true "tag点"
 // @Param val        query  string true "值"
-// @Success 200 {string} string "控制命令发送成功"
+// @Success 200 {string} string "控制命令发送成功，返回命令seq"
 // @Failure 500 {object} map[string]interface{} "控制命令发送失败"
 // @router /command [post]
 func (c *WriteController) Command(deviceCode, tagCode, val string) {
 	userId := c.Ctx.Input.GetData("user_id").(int64)
 	tenantId, _ := models.GetUserTenantId(userId)
 	// 发布控制命令
-	if _, err := services.Processor.Deal(deviceCode, tagCode, val, "手动控制", userId, tenantId); err != nil {
+	seq, err := services.Processor.Deal(deviceCode, tagCode, val, "手动控制", userId, tenantId)
+	if err != nil {
 		c.Error(400, "控制命令发送失败:"+err.Error())
 	}
-	c.SuccessMsg()
+	c.Success(seq)
+}
+
+// Result @Title 命令结果
+// @Description 查询控制命令当前状态：WAIT/SUCCESS/FAIL/TIMEOUT/EXPIRED
+// @Param Authorization    header   string  true   "Bearer YourToken"
+// @Param seq              query    string  true   "命令seq"
+// @Success 200 {object} models.WriteLog
+// @Failure 400 "请求出错"
+// @router /result [post]
+func (c *WriteController) Result() {
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	writeLog, err := services.GetCommand(tenantId, c.GetString("seq"))
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(writeLog)
+}
+
+// Wait @Title 等待命令结果
+// @Description 阻塞等待控制命令进入终态，超过等待时间返回当前状态
+// @Param Authorization    header   string  true   "Bearer YourToken"
+// @Param seq              query    string  true   "命令seq"
+// @Param timeout          query    int     false  "最长等待秒数，默认10，最大60"
+// @Success 200 {object} models.WriteLog
+// @Failure 400 "请求出错"
+// @router /wait [post]
+func (c *WriteController) Wait() {
+	seq := c.GetString("seq")
+	timeout, _ := c.GetInt("timeout", 10)
+	if timeout <= 0 || timeout > 60 {
+		timeout = 60
+	}
+	userId, _ := c.Ctx.Input.GetData("user_id").(int64)
+	tenantId, _ := models.GetUserTenantId(userId)
+
+	if _, err := services.GetCommand(tenantId, seq); err != nil {
+		c.Error(400, err.Error())
+	}
+	writeLog, err := services.WaitCommand(seq, time.Duration(timeout)*time.Second)
+	if err != nil {
+		c.Error(400, err.Error())
+	}
+	c.Success(writeLog)
 }
 
 // Log @Title 控制日志
 // @Description 场景控制下userId = 场景控制,手动控制userId = 操作用户
 // @Param Authorization    header   string  true   "Bearer YourToken"
 // @Param   id      	   query   id      false "筛选ID"
-// @Param   type 		   query   string  false "查询类型：场景控制/手动控制/组态下发"
+// @Param   type 		   query   string  false "查询类型：场景控制/手动控制/组态下发/批量控制"
 // @Param   page           query   int     false "当前页码，默认1"
 // @Param   size           query   int     false "每页数量，默认10"
 // @Success 200 {object} controllers.Result
@@ -51,7 +98,7 @@ func (c *WriteController) Log() {
 	var logs []*models.WriteLog
 	o := orm.NewOrm()
 	qs := o.QueryTable(new(models.WriteLog)).Filter("department_id", tenantId)
-	if logType == "手动控制" || logType == "组态下发" {
+	if logType == "手动控制" || logType == "组态下发" || logType == "批量控制" {
 		qs = qs.Filter("channel", logType)
 	}
 
@@ -91,6 +138,8 @@ func (c *WriteController) Log() {
 					"status":   log.Status,
 					"channel":  log.Channel,
 					"respTime": log.RespTime,
+					"attempts": log.Attempts,
+					"batchId":  log.BatchId,
 					"created":  log.Created,
 					"name":     sceneName, // 添加场景名称字段
 				}
@@ -14,8 +14,10 @@ import (
 	"iotServer/utils"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -94,6 +96,8 @@ func validateToken(ctx *context.Context) bool {
 		"/api/ws",
 		"/ws",
 		"/api/ekuiper/callback",
+		"/api/mqtt/auth",
+		"/api/mqtt/acl",
 	}
 	for _, path := range skipPaths {
 		if strings.HasPrefix(ctx.Request.URL.Path, path) {
@@ -161,10 +165,18 @@ func main() {
 
 // 开发模式
 func runDev() {
+	// 退出前同步并关闭MQTT任务磁盘队列
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		<-ch
+		services.CloseJobQueues()
+		os.Exit(0)
+	}()
 	common.InitDB()
 	go services.InitMQTT()
 	initSwagger()
-	common.InitEuiper()
+	initStreamEngine()
 	controllers.GlobalSceneService.LoadScenesFromDatabase() // 加载场景数据
 	services.LoadAllDeviceCategoryKeys()                    //加载超级表缓存
 	beego.Run()
@@ -208,7 +220,7 @@ func (p *program) run() {
 	initSwagger()
 
 	log.Println("【Service】启动 流数据 服务...")
-	common.InitEuiper()
+	initStreamEngine()
 
 	log.Println("【Service】启动 CRON 服务...")
 	controllers.GlobalSceneService.LoadScenesFromDatabase() // 加载场景数据
@@ -221,6 +233,16 @@ func (p *program) run() {
 	<-p.exitCh // 阻塞直到收到 Stop 信号
 }
 
+// initStreamEngine 按 streamEngine 配置初始化 eKuiper 或内置流规则计算，使用 eKuiper 时启动规则核对
+func initStreamEngine() {
+	if common.UseBuiltinStream() {
+		services.StartStreamEvaluator()
+		return
+	}
+	common.InitEuiper()
+	go services.StartRuleReconciler()
+}
+
 func setWorkingDirectoryToExecPath() {
 	exePath, err := os.Executable()
 	if err != nil {
@@ -233,6 +255,7 @@ func setWorkingDirectoryToExecPath() {
 	}
 }
 func (p *program) Stop(s service.Service) error {
+	services.CloseJobQueues() // 同步并关闭MQTT任务磁盘队列
 	close(p.exitCh)
 	return nil
 }
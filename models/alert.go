@@ -1,10 +1,17 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/beego/beego/v2/client/orm"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// 告警规则在 eKuiper 中的规则ID后缀，第一个子规则为 {name}__Rule，其余为 {name}__Rule_{序号}
+const alertEkuiperSuffix = "__Rule"
+
 // AlertRule 告警规则
 type AlertRule struct {
 	Id          int64       `orm:"auto;pk" json:"id"`
@@ -12,13 +19,16 @@ type AlertRule struct {
 	Modified    int64       `orm:"column(modified);null" json:"modified"`
 	Name        string      `orm:"size(255);null;unique" json:"name"`
 	DeviceId    string      `orm:"size(255);null;index" json:"device_id"`
-	AlertType   string      `orm:"size(64);null" json:"alert_type"`               // 告警类型
-	AlertLevel  string      `orm:"size(64);null" json:"alert_level"`              // 告警级别
-	Status      string      `orm:"size(64);null" json:"status"`                   // 状态：running/stopped
-	Condition   string      `orm:"type(text);null" json:"condition"`              // 执行条件：anyone/all
-	SubRule     string      `orm:"type(text);null" json:"sub_rule"`               // 子规则配置(JSON字符串)
-	Notify      string      `orm:"type(text);null" json:"notify"`                 // 通知配置(JSON字符串)
-	SilenceTime string      `orm:"column(silence_time);null" json:"silence_time"` // 静默时间
+	AlertType   string      `orm:"size(64);null" json:"alert_type"`                     // 告警类型
+	AlertLevel  string      `orm:"size(64);null" json:"alert_level"`                    // 告警级别
+	Status      string      `orm:"size(64);null" json:"status"`                         // 状态：running/stopped
+	Condition   string      `orm:"type(text);null" json:"condition"`                    // 执行条件：anyone/all
+	SubRule     string      `orm:"type(text);null" json:"sub_rule"`                     // 子规则配置(JSON字符串)
+	Notify      string      `orm:"type(text);null" json:"notify"`                       // 通知配置(JSON字符串)
+	SilenceTime string      `orm:"column(silence_time);null" json:"silence_time"`       // 静默时间
+	Window      int64       `orm:"column(correlation_window);default(0)" json:"window"` // 条件为all时子规则命中的关联窗口(秒)，0使用默认值
+	Escalation  string      `orm:"type(text);null" json:"escalation"`                   // 升级策略(JSON字符串)
+	GroupBy     string      `orm:"column(group_by);size(32);null" json:"group_by"`      // 事件归并方式：空不归并/sn同网关/position同位置
 	Description string      `orm:"type(text);null" json:"description"`
 	Department  *Department `orm:"rel(fk);on_delete(cascade);null" json:"-"`
 
@@ -31,17 +41,76 @@ type AlertList struct {
 	Id          int64       `orm:"auto;pk" json:"id"`
 	Created     int64       `orm:"column(created);null" json:"created"`
 	Modified    int64       `orm:"column(modified);null" json:"modified"`
-	TriggerTime int64       `orm:"column(trigger_time);null" json:"trigger_time"` // 触发时间
-	AlertResult string      `orm:"type(text);null" json:"alert_result"`           // 告警内容(JSON)
-	Status      string      `orm:"size(64);null" json:"status"`                   // 状态：未处理/已处理/忽略
-	TreatedTime int64       `orm:"column(treated_time);null" json:"treated_time"` // 处理时间
-	Message     string      `orm:"type(text);null" json:"message"`                // 处理意见
-	IsSend      bool        `orm:"column(is_send);null" json:"is_send"`           // 是否发送通知
+	TriggerTime int64       `orm:"column(trigger_time);null" json:"trigger_time"`       // 触发时间
+	AlertResult string      `orm:"type(text);null" json:"alert_result"`                 // 告警内容(JSON)
+	Status      string      `orm:"size(64);null" json:"status"`                         // 状态：未处理/已处理/忽略
+	TreatedTime int64       `orm:"column(treated_time);null" json:"treated_time"`       // 处理时间
+	Message     string      `orm:"type(text);null" json:"message"`                      // 处理意见
+	IsSend      bool        `orm:"column(is_send);null" json:"is_send"`                 // 是否发送通知
+	State       string      `orm:"size(32);null;index" json:"state"`                    // 生命周期状态：triggered/acknowledged/recovered/closed
+	Dn          string      `orm:"size(255);null;index" json:"dn"`                      // 触发设备
+	AckBy       int64       `orm:"column(ack_by);null" json:"ack_by"`                   // 确认人
+	AckTime     int64       `orm:"column(ack_time);null" json:"ack_time"`               // 确认时间
+	RecoverTime int64       `orm:"column(recover_time);null" json:"recover_time"`       // 恢复时间
+	CloseBy     int64       `orm:"column(close_by);null" json:"close_by"`               // 关闭人，0为系统自动关闭
+	CloseTime   int64       `orm:"column(close_time);null" json:"close_time"`           // 关闭时间
+	Escalated   int         `orm:"default(0)" json:"escalated"`                         // 已执行的升级级数
+	Fingerprint string      `orm:"size(512);null;index" json:"fingerprint"`             // 去重键：规则|设备|属性
+	Occurrences int         `orm:"default(1)" json:"occurrences"`                       // 未恢复期间的触发次数
+	LastSeen    int64       `orm:"column(last_seen);null" json:"last_seen"`             // 最近一次触发时间，首次触发时间为 TriggerTime
+	PeakValue   string      `orm:"column(peak_value);size(255);null" json:"peak_value"` // 未恢复期间的峰值
+	IncidentId  int64       `orm:"column(incident_id);null;index" json:"incident_id"`   // 所属事件
 	Department  *Department `orm:"rel(fk);on_delete(cascade);null" json:"-"`
 
 	AlertRule *AlertRule `orm:"rel(fk);column(alert_rule_id);on_delete(do_nothing);on_update(do_nothing);null" json:"alert_rule,omitempty"`
 }
 
+// 事件状态
+const (
+	IncidentOpen   = "open"   // 仍有未恢复的告警
+	IncidentClosed = "closed" // 所有告警已恢复或关闭
+)
+
+// 事件归并方式
+const (
+	IncidentGroupNone     = ""         // 不归并
+	IncidentGroupSn       = "sn"       // 同一网关
+	IncidentGroupPosition = "position" // 同一位置
+)
+
+// AlertIncident 告警事件，同一网关或位置的相关告警归并为一个事件
+type AlertIncident struct {
+	Id         int64       `orm:"auto;pk" json:"id"`
+	GroupBy    string      `orm:"column(group_by);size(32)" json:"group_by"`              // 归并方式
+	GroupValue string      `orm:"column(group_value);size(255);index" json:"group_value"` // 网关SN或位置ID
+	Title      string      `orm:"size(255);null" json:"title"`
+	AlertLevel string      `orm:"size(64);null" json:"alert_level"` // 首条告警的级别
+	Count      int         `orm:"default(0)" json:"count"`          // 归并的告警数
+	FirstSeen  int64       `orm:"column(first_seen);null" json:"first_seen"`
+	LastSeen   int64       `orm:"column(last_seen);null" json:"last_seen"`
+	State      string      `orm:"size(32);index" json:"state"`
+	CloseTime  int64       `orm:"column(close_time);null" json:"close_time"`
+	Department *Department `orm:"rel(fk);on_delete(cascade);null" json:"-"`
+}
+
+// AlertTransition 告警状态变更记录
+type AlertTransition struct {
+	Id       int64      `orm:"auto;pk" json:"id"`
+	Alert    *AlertList `orm:"rel(fk);column(alert_id);on_delete(cascade)" json:"-"`
+	Action   string     `orm:"size(32)" json:"action"`        // trigger/ack/recover/close/escalate
+	From     string     `orm:"size(32);null" json:"from"`     // 变更前状态
+	To       string     `orm:"size(32);null" json:"to"`       // 变更后状态
+	Operator int64      `orm:"null" json:"operator"`          // 操作人，0为系统
+	Remark   string     `orm:"type(text);null" json:"remark"` // 说明
+	Created  int64      `orm:"column(created);null" json:"created"`
+}
+
+// Escalation 升级策略：告警超过 After 秒未确认时按 Notify 重新通知
+type Escalation struct {
+	After  int64    `json:"after" example:"600"` // 触发后未确认的秒数
+	Notify []Notify `json:"notify"`              // 升级通知配置
+}
+
 // SubRule 规则
 type SubRule struct {
 	Trigger   string            `json:"trigger"   example:"设备数据触发"`                                                                                                                                     //触发方式：设备数据触发/设备事件触发/设备状态触发
@@ -56,6 +125,57 @@ type Notify struct {
 	Option          map[string]string `json:"option" example:"{\"webhook\": \"https://big-exabyte-28.webhook.cool\"}"` // 通知参数
 	StartEffectTime string            `json:"start_effect_time" example:"00:00:00"`                                    // 生效开始时间
 	EndEffectTime   string            `json:"end_effect_time" example:"23:59:59"`                                      // 生效结束时间
+	Recipients      []NotifyRecipient `json:"recipients"`                                                              // 接收人，按联系方式补充收件人、手机号或群消息 @ 对象
+	CalendarId      int64             `json:"calendar_id" example:"0"`                                                 // 引用的工作日历，0为不限日期
+	DayType         string            `json:"day_type" example:"workday"`                                              // 引用日历时仅在该类型日期发送：workday/holiday，默认 workday
+}
+
+// AlertEkuiperRuleId 子规则对应的 eKuiper 规则ID
+func AlertEkuiperRuleId(name string, index int) string {
+	if index == 0 {
+		return name + alertEkuiperSuffix
+	}
+	return fmt.Sprintf("%s%s_%d", name, alertEkuiperSuffix, index)
+}
+
+// ParseAlertEkuiperRuleId 从 eKuiper 规则ID解析告警规则名称及子规则序号
+func ParseAlertEkuiperRuleId(ruleId string) (string, int) {
+	index := strings.LastIndex(ruleId, "__")
+	if index <= 0 {
+		return ruleId, 0
+	}
+	name, suffix := ruleId[:index], ruleId[index:]
+	if n, err := strconv.Atoi(strings.TrimPrefix(suffix, alertEkuiperSuffix+"_")); err == nil {
+		return name, n
+	}
+	return name, 0
+}
+
+// SubRules 解析子规则配置
+func (a *AlertRule) SubRules() []SubRule {
+	var subRules []SubRule
+	_ = json.Unmarshal([]byte(a.SubRule), &subRules)
+	return subRules
+}
+
+// EkuiperRuleIds 规则下所有子规则对应的 eKuiper 规则ID，未配置子规则时返回第一个
+func (a *AlertRule) EkuiperRuleIds() []string {
+	n := len(a.SubRules())
+	if n == 0 {
+		n = 1
+	}
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, AlertEkuiperRuleId(a.Name, i))
+	}
+	return ids
+}
+
+// Escalations 解析升级策略
+func (a *AlertRule) Escalations() []Escalation {
+	var escalations []Escalation
+	_ = json.Unmarshal([]byte(a.Escalation), &escalations)
+	return escalations
 }
 
 // BeforeInsert 插入前钩子
@@ -94,4 +214,6 @@ func init() {
 	// 注册模型
 	orm.RegisterModel(new(AlertRule))
 	orm.RegisterModel(new(AlertList))
+	orm.RegisterModel(new(AlertTransition))
+	orm.RegisterModel(new(AlertIncident))
 }
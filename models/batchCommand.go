@@ -0,0 +1,61 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 批量控制目标类型
+const (
+	BatchTargetGroup      = "group"      // 设备分组
+	BatchTargetPosition   = "position"   // 位置及其所有子位置
+	BatchTargetDepartment = "department" // 部门及其所有子部门
+	BatchTargetFilter     = "filter"     // 按产品/名称筛选
+)
+
+// 批量控制任务状态
+const (
+	BatchRunning     = "running"     // 执行中
+	BatchCompleted   = "completed"   // 全部下发完成
+	BatchAborted     = "aborted"     // 失败率超过阈值而终止
+	BatchCanceled    = "canceled"    // 手动取消
+	BatchInterrupted = "interrupted" // 服务重启导致中断
+)
+
+// BatchCommand 批量控制任务，单设备结果记录在 WriteLog 中(batch_id 关联)
+type BatchCommand struct {
+	Id          int64  `orm:"pk;auto" json:"id"`
+	Name        string `orm:"size(255);null" json:"name"`
+	Target      string `orm:"size(32)" json:"target"`                              // 目标类型
+	TargetId    int64  `orm:"column(target_id);null" json:"targetId"`              // 分组/位置/部门ID
+	ProductId   int64  `orm:"column(product_id);null" json:"productId"`            // 按产品筛选，0不限
+	Keyword     string `orm:"size(255);null" json:"keyword"`                       // 按设备名称模糊筛选
+	Tag         string `orm:"size(255)" json:"tag"`                                // 写入的点
+	Val         string `orm:"size(255)" json:"val"`                                // 写入的值
+	Concurrency int    `orm:"default(1)" json:"concurrency"`                       // 并发下发数
+	Canary      int    `orm:"default(0)" json:"canary"`                            // 灰度比例(%)，先下发该比例设备并评估结果
+	MaxFailRate int    `orm:"column(max_fail_rate);default(0)" json:"maxFailRate"` // 失败率阈值(%)，超过后终止，0不限制
+	Devices     string `orm:"type(text);null" json:"-"`                            // 目标设备名称JSON数组
+	Total       int    `orm:"default(0)" json:"total"`
+	Success     int    `orm:"default(0)" json:"success"`
+	Fail        int    `orm:"default(0)" json:"fail"`
+	Status      string `orm:"size(32);index" json:"status"`
+	Error       string `orm:"type(text);null" json:"error"`
+	UserId      int64  `orm:"column(user_id);null" json:"userId"`
+	Tenant      int64  `orm:"column(tenant_id);index" json:"-"`
+	Created     int64  `orm:"null" json:"created"`
+	Finished    int64  `orm:"null" json:"finished"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(BatchCommand))
+}
+
+// BeforeInsert 插入前钩子
+func (b *BatchCommand) BeforeInsert() error {
+	if b.Created == 0 {
+		b.Created = time.Now().Unix()
+	}
+	return nil
+}
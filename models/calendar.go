@@ -0,0 +1,82 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 工作日历排班方式
+const (
+	CalendarModeWeekly = "weekly" // 按星期，Workdays 为上班的星期
+	CalendarModeCycle  = "cycle"  // 按轮班周期，Cycle 从 CycleStart 起循环
+)
+
+// 日历日期类型
+const (
+	CalendarHoliday = "holiday" // 节假日(不上班)
+	CalendarWorkday = "workday" // 工作日(含调休上班)
+)
+
+// WorkCalendar 工作日历，节假日与调休按日期单独配置，其余日期按排班方式计算
+type WorkCalendar struct {
+	Id         int64  `orm:"pk;auto" json:"id"`
+	Name       string `orm:"size(255)" json:"name"`
+	Mode       string `orm:"size(16)" json:"mode"`                                // weekly/cycle
+	Workdays   string `orm:"size(32);null" json:"workdays"`                       // weekly: 上班的星期，0为周日，如 1,2,3,4,5
+	CycleStart string `orm:"column(cycle_start);size(10);null" json:"cycleStart"` // cycle: 周期首日 2006-01-02
+	Cycle      string `orm:"size(255);null" json:"cycle"`                         // cycle: 每天是否上班，1上班0休息，如 1,1,1,1,0,0
+	Remark     string `orm:"size(255);null" json:"remark"`
+	Tenant     int64  `orm:"column(tenant_id);index" json:"-"` // 租户ID
+	Created    int64  `orm:"null" json:"created"`
+	Modified   int64  `orm:"null" json:"modified"`
+}
+
+// CalendarDay 日历中单独配置的日期(节假日、调休上班)
+type CalendarDay struct {
+	Id       int64         `orm:"pk;auto" json:"id"`
+	Calendar *WorkCalendar `orm:"rel(fk);on_delete(cascade)" json:"-"`
+	Date     string        `orm:"size(10);index" json:"date"` // 2006-01-02
+	Type     string        `orm:"size(16)" json:"type"`       // holiday/workday
+	Name     string        `orm:"size(128);null" json:"name"` // 如 国庆节、国庆调休
+	Created  int64         `orm:"null" json:"created"`
+}
+
+// TenantTimeZone 租户时区，场景定时、限制条件及通知生效时间按该时区计算，未配置使用服务器时区
+type TenantTimeZone struct {
+	Id       int64  `orm:"pk;auto" json:"id"`
+	Tenant   int64  `orm:"column(tenant_id);unique" json:"-"`
+	TimeZone string `orm:"column(time_zone);size(64)" json:"timeZone"`
+	Modified int64  `orm:"null" json:"modified"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(WorkCalendar), new(CalendarDay), new(TenantTimeZone))
+}
+
+// TableUnique 同一日历的日期唯一
+func (d *CalendarDay) TableUnique() [][]string {
+	return [][]string{{"Calendar", "Date"}}
+}
+
+// BeforeInsert 插入前钩子
+func (c *WorkCalendar) BeforeInsert() error {
+	now := time.Now().Unix()
+	c.Created = now
+	c.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (c *WorkCalendar) BeforeUpdate() error {
+	c.Modified = time.Now().Unix()
+	return nil
+}
+
+// BeforeInsert 插入前钩子
+func (d *CalendarDay) BeforeInsert() error {
+	if d.Created == 0 {
+		d.Created = time.Now().Unix()
+	}
+	return nil
+}
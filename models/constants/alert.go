@@ -57,6 +57,16 @@ const (
 	Untreated AlertListStatus = "未处理"
 )
 
+// 告警生命周期状态
+type AlertState string
+
+const (
+	AlertTriggered    AlertState = "triggered"    // 已触发
+	AlertAcknowledged AlertState = "acknowledged" // 已确认
+	AlertRecovered    AlertState = "recovered"    // 已恢复
+	AlertClosed       AlertState = "closed"       // 已关闭
+)
+
 // 执行条件
 type WorkerCondition string
 
@@ -75,10 +85,11 @@ const (
 	DingDing AlertWay = "钉钉机器人"
 	FeiShu   AlertWay = "飞书机器人"
 	WEBAPI   AlertWay = "API接口"
+	EMAIL    AlertWay = "email"
 )
 
 func IsValidAlertWay(value string) bool {
-	return value == string(SMS) || value == string(PHONE) || value == string(QYweixin) || value == string(DingDing) || value == string(FeiShu) || value == string(WEBAPI)
+	return value == string(SMS) || value == string(PHONE) || value == string(QYweixin) || value == string(DingDing) || value == string(FeiShu) || value == string(WEBAPI) || value == string(EMAIL)
 }
 
 // 数值类型用于取值类型 IsValidValueType 判断是否是合法的 valueType
@@ -214,11 +225,18 @@ func IsSpecsType(value string) bool {
 type ConditionType string
 
 const (
-	ConditionTypeTimer  ConditionType = "timer"
-	ConditionTypeNotify ConditionType = "notify"
+	ConditionTypeTimer       ConditionType = "timer"        // 定时触发
+	ConditionTypeNotify      ConditionType = "notify"       // 设备触发
+	ConditionTypeTimeRange   ConditionType = "time_range"   // 限制条件：生效时间段
+	ConditionTypeDeviceState ConditionType = "device_state" // 限制条件：设备属性当前值
 )
 
 func isValidConditionType(value string) bool {
+	return IsSceneTrigger(value) || value == string(ConditionTypeTimeRange) || value == string(ConditionTypeDeviceState)
+}
+
+// IsSceneTrigger 是否为场景触发条件，其余条件只在触发时校验
+func IsSceneTrigger(value string) bool {
 	return value == string(ConditionTypeTimer) || value == string(ConditionTypeNotify)
 }
 
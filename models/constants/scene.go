@@ -0,0 +1,25 @@
+package constants
+
+// SceneActionType 场景动作类型
+type SceneActionType string
+
+const (
+	SceneActionProperty  SceneActionType = "property"   // 写设备属性(类型为空时的默认动作)
+	SceneActionDelay     SceneActionType = "delay"      // 等待指定秒数
+	SceneActionNotify    SceneActionType = "notify"     // 通过告警通知方式发送通知
+	SceneActionWebhook   SceneActionType = "webhook"    // 调用 HTTP 接口
+	SceneActionScene     SceneActionType = "scene"      // 启动/停止其他场景
+	SceneActionAlertRule SceneActionType = "alert_rule" // 启动/停止告警规则
+	SceneActionService   SceneActionType = "service"    // 调用物模型服务
+	SceneActionParallel  SceneActionType = "parallel"   // 并行执行多个分支
+)
+
+// IsSceneActionTypeValid 判断是否是合法的场景动作类型
+func IsSceneActionTypeValid(value string) bool {
+	switch SceneActionType(value) {
+	case "", SceneActionProperty, SceneActionDelay, SceneActionNotify, SceneActionWebhook,
+		SceneActionScene, SceneActionAlertRule, SceneActionService, SceneActionParallel:
+		return true
+	}
+	return false
+}
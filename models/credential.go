@@ -0,0 +1,62 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 凭证类型
+const (
+	CredentialDevice  = "device"  // 直连设备，Name 为设备名称
+	CredentialGateway = "gateway" // 网关，Name 为网关SN
+)
+
+// 凭证状态
+const (
+	CredentialActive  = "active"  // 有效
+	CredentialRevoked = "revoked" // 已吊销
+)
+
+// DeviceCredential 设备/网关的MQTT接入密钥
+type DeviceCredential struct {
+	Id         int64  `orm:"pk;auto" json:"id"`
+	Kind       string `orm:"size(16)" json:"kind"`                       // 凭证类型：device/gateway
+	Name       string `orm:"size(255)" json:"name"`                      // 设备名称或网关SN
+	Scope      string `orm:"size(255)" json:"scope"`                     // 设备为产品Key，网关为SN
+	Secret     string `orm:"size(64)" json:"-"`                          // 当前密钥
+	PrevSecret string `orm:"column(prev_secret);size(64);null" json:"-"` // 轮换前的密钥，宽限期内仍可认证
+	PrevExpire int64  `orm:"column(prev_expire);null" json:"prevExpire"` // 旧密钥失效时间
+	Status     string `orm:"size(32);index" json:"status"`               // 状态：active/revoked
+	Tenant     int64  `orm:"column(tenant_id);index" json:"-"`           // 租户ID
+	LastAuth   int64  `orm:"column(last_auth);null" json:"lastAuth"`     // 最近认证成功时间
+	// 是否校验签名时间戳，开启后设备须按当前时间重新签名，平台返回的三元组仅在 mqttSignWindow 内有效
+	CheckTimestamp bool  `orm:"column(check_timestamp);default(false)" json:"checkTimestamp"`
+	Created        int64 `orm:"null" json:"created"`
+	Modified       int64 `orm:"null" json:"modified"`
+}
+
+// TableUnique 同类型下名称唯一
+func (d *DeviceCredential) TableUnique() [][]string {
+	return [][]string{{"Kind", "Name"}}
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(DeviceCredential))
+}
+
+// BeforeInsert 插入前钩子
+func (d *DeviceCredential) BeforeInsert() error {
+	now := time.Now().Unix()
+	if d.Created == 0 {
+		d.Created = now
+	}
+	d.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (d *DeviceCredential) BeforeUpdate() error {
+	d.Modified = time.Now().Unix()
+	return nil
+}
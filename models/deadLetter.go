@@ -0,0 +1,48 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 死信状态
+const (
+	DeadLetterPending   = "pending"   // 待重放
+	DeadLetterReplayed  = "replayed"  // 已重放成功
+	DeadLetterDiscarded = "discarded" // 已放弃
+)
+
+// DeadLetter 写入TDengine失败的上报数据
+type DeadLetter struct {
+	Id         int64  `orm:"pk;auto" json:"id"`
+	Dn         string `orm:"size(255);index" json:"dn"`                   // 设备名称（子表名）
+	Message    string `orm:"type(text)" json:"message"`                   // 原始上报内容(JSON)
+	Error      string `orm:"type(text);null" json:"error"`                // 最近一次失败原因
+	Attempts   int    `orm:"default(0)" json:"attempts"`                  // 累计写入次数
+	Status     string `orm:"size(32);index" json:"status"`                // 状态：pending/replayed/discarded
+	Tenant     int64  `orm:"column(tenant_id);null;index" json:"-"`       // 租户ID
+	LastReplay int64  `orm:"column(last_replay);null" json:"last_replay"` // 最近重放时间
+	Created    int64  `orm:"null" json:"created"`
+	Modified   int64  `orm:"null" json:"modified"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(DeadLetter))
+}
+
+// BeforeInsert 插入前钩子
+func (d *DeadLetter) BeforeInsert() error {
+	now := time.Now().Unix()
+	if d.Created == 0 {
+		d.Created = now
+	}
+	d.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (d *DeadLetter) BeforeUpdate() error {
+	d.Modified = time.Now().Unix()
+	return nil
+}
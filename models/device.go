@@ -21,6 +21,7 @@ type Device struct {
 	Group       *Group      `orm:"rel(fk);column(group_id);on_delete(set_null);null" json:"-"`      // 分组ID
 	Department  *Department `orm:"rel(fk);column(department_id);on_delete(set_null);null" json:"-"` // 部门ID
 	Tenant      int64       `orm:"column(tenant_id);null" json:"tenantId"`                          // 租户ID
+	Rejected    int64       `orm:"column(rejected_points);default(0)" json:"rejectedPoints"`        // 校验不合规的点数
 
 	ProjectId    int64  `orm:"-" json:"project_id"`    // 项目Id
 	ProductId    int64  `orm:"-" json:"product_id"`    // 产品Id
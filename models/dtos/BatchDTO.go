@@ -0,0 +1,15 @@
+package dtos
+
+// BatchCommandRequest 批量控制
+type BatchCommandRequest struct {
+	Name        string `json:"name" example:"夜间关灯" description:"任务名称"`
+	Target      string `json:"target" example:"group" description:"目标类型：group/position/department/filter"`
+	TargetId    int64  `json:"targetId" example:"1" description:"分组/位置/部门ID，filter时忽略"`
+	ProductId   int64  `json:"productId" example:"0" description:"按产品筛选，0不限"`
+	Keyword     string `json:"keyword" example:"light" description:"按设备名称模糊筛选"`
+	Tag         string `json:"tag" example:"switch" description:"写入的点"`
+	Val         string `json:"val" example:"0" description:"写入的值"`
+	Concurrency int    `json:"concurrency" example:"5" description:"并发下发数，默认1，最大50"`
+	Canary      int    `json:"canary" example:"10" description:"灰度比例(%)，先下发该比例设备，失败率未超阈值再继续"`
+	MaxFailRate int    `json:"maxFailRate" example:"20" description:"失败率阈值(%)，超过后终止剩余设备，0不限制"`
+}
@@ -0,0 +1,30 @@
+package dtos
+
+// CalendarRequest 工作日历，Id 为0时新增
+type CalendarRequest struct {
+	Id         int64  `json:"id"`
+	Name       string `json:"name" example:"园区工作日历"`
+	Mode       string `json:"mode" example:"weekly" description:"weekly 按星期/cycle 按轮班周期"`
+	Workdays   string `json:"workdays" example:"1,2,3,4,5" description:"weekly: 上班的星期，0为周日"`
+	CycleStart string `json:"cycleStart" example:"2026-01-01" description:"cycle: 周期首日"`
+	Cycle      string `json:"cycle" example:"1,1,1,1,0,0" description:"cycle: 每天是否上班，1上班0休息"`
+	Remark     string `json:"remark"`
+}
+
+// CalendarDayItem 单独配置的日期
+type CalendarDayItem struct {
+	Date string `json:"date" example:"2026-10-01"`
+	Type string `json:"type" example:"holiday" description:"holiday 节假日/workday 调休上班"`
+	Name string `json:"name" example:"国庆节"`
+}
+
+// CalendarDaysRequest 批量保存日历日期，同一日期已存在时覆盖
+type CalendarDaysRequest struct {
+	CalendarId int64             `json:"calendarId" example:"1"`
+	Days       []CalendarDayItem `json:"days"`
+}
+
+// TenantTimeZoneRequest 租户时区
+type TenantTimeZoneRequest struct {
+	TimeZone string `json:"timeZone" example:"Asia/Shanghai" description:"IANA 时区名，为空恢复使用服务器时区"`
+}
@@ -0,0 +1,10 @@
+package dtos
+
+// InvokeRequest 调用设备物模型服务
+type InvokeRequest struct {
+	Name     string                 `json:"name" example:"meter_01" description:"设备名称"`
+	Service  string                 `json:"service" example:"reboot" description:"服务标识"`
+	Params   map[string]interface{} `json:"params" example:"{\"delay\":5}" description:"输入参数，按服务定义的InputParams校验"`
+	Timeout  int                    `json:"timeout" example:"10" description:"同步调用最长等待秒数，0使用产品或全局配置，最大60"`
+	Callback string                 `json:"callback" example:"http://127.0.0.1:8080/hook" description:"异步调用完成后回调的地址，可选"`
+}
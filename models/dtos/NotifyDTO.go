@@ -0,0 +1,52 @@
+package dtos
+
+// NotifyTemplateRequest 通知模板，Id 为0时新增
+type NotifyTemplateRequest struct {
+	Id      int64  `json:"id"`
+	Name    string `json:"name" example:"电表告警"`
+	RuleId  int64  `json:"ruleId" example:"0" description:"适用规则，0为全部规则"`
+	Channel string `json:"channel" example:"钉钉机器人" description:"适用通知方式，空为全部"`
+	Kind    string `json:"kind" example:"property" description:"适用告警类型：空/property/status/event/escalation"`
+	Format  string `json:"format" example:"markdown" description:"消息格式：text/markdown/card"`
+	Title   string `json:"title" example:"{{.Rule}} {{.Level}}" description:"标题模板，用于邮件主题及Markdown、卡片标题"`
+	Content string `json:"content" example:"设备 {{.Device}}({{.Position}}) {{.Property}} 当前值 {{.Value}}" description:"内容模板，Go text/template 语法"`
+}
+
+// NotifyTemplatePreviewRequest 模板预览，AlertId 为0时使用示例告警
+type NotifyTemplatePreviewRequest struct {
+	NotifyTemplateRequest
+	AlertId int64 `json:"alertId" example:"0"`
+}
+
+// ContactProfileRequest 用户联系方式
+type ContactProfileRequest struct {
+	UserId   int64  `json:"userId" example:"1"`
+	Email    string `json:"email" example:"ops@example.com" description:"为空时使用账号邮箱"`
+	Phone    string `json:"phone" example:"13800000000"`
+	WeComId  string `json:"wecomId" example:"zhangsan" description:"企业微信 userid"`
+	DingId   string `json:"dingId" example:"manager1234" description:"钉钉 userId"`
+	FeishuId string `json:"feishuId" example:"ou_xxx" description:"飞书 open_id"`
+}
+
+// OnCallScheduleRequest 值班表，Id 为0时新增
+type OnCallScheduleRequest struct {
+	Id              int64   `json:"id"`
+	Name            string  `json:"name" example:"运维一组"`
+	TimeZone        string  `json:"timeZone" example:"Asia/Shanghai" description:"为空使用 Asia/Shanghai"`
+	Members         []int64 `json:"members" example:"1,2,3" description:"轮换成员用户ID，按顺序轮换"`
+	Rotation        string  `json:"rotation" example:"daily" description:"daily/weekly/custom"`
+	ShiftHours      int     `json:"shiftHours" example:"12" description:"custom 轮换的班次时长(小时)"`
+	StartDate       string  `json:"startDate" example:"2026-01-01" description:"首个班次日期"`
+	HandoffTime     string  `json:"handoffTime" example:"09:00:00" description:"交接时间"`
+	StartEffectTime string  `json:"start_effect_time" example:"00:00:00" description:"生效开始时间，为空全天"`
+	EndEffectTime   string  `json:"end_effect_time" example:"23:59:59" description:"生效结束时间，为空全天"`
+}
+
+// OnCallOverrideRequest 值班替换
+type OnCallOverrideRequest struct {
+	ScheduleId int64  `json:"scheduleId" example:"1"`
+	UserId     int64  `json:"userId" example:"2"`
+	Start      int64  `json:"start" example:"1767225600" description:"开始时间(秒)"`
+	End        int64  `json:"end" example:"1767312000" description:"结束时间(秒)"`
+	Remark     string `json:"remark" example:"调休"`
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"iotServer/models"
 	"iotServer/models/constants"
+	"net/mail"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -43,6 +46,18 @@ type RuleUpdateRequest struct {
 	SubRule     []models.SubRule          `json:"sub_rule"`                   // 子规则列
 	Notify      []models.Notify           `json:"notify"`                     // 通知配置
 	SilenceTime string                    `json:"silence_time" example:"0"`   // 静默时间
+	Window      int64                     `json:"window" example:"60"`        // 条件为all时的关联窗口(秒)，各子规则在窗口内均命中才告警
+	Escalation  []models.Escalation       `json:"escalation"`                 // 升级策略，按 after 升序
+	GroupBy     string                    `json:"group_by" example:"sn"`      // 事件归并方式：空不归并/sn同网关/position同位置
+}
+
+// RuleBacktestRequest 以历史数据回测单个设备数据触发子规则
+type RuleBacktestRequest struct {
+	SubRule     models.SubRule `json:"sub_rule"`                                 // 子规则，与规则配置相同
+	SilenceTime string         `json:"silence_time" example:"5分钟"`               // 静默时间
+	StartTime   string         `json:"start_time" example:"2026-01-01 00:00:00"` // 回测开始时间
+	EndTime     string         `json:"end_time" example:"2026-01-02 00:00:00"`   // 回测结束时间
+	Limit       int            `json:"limit" example:"100"`                      // 返回的告警明细条数，默认100
 }
 
 // 生成不同事件触发器
@@ -62,6 +77,12 @@ func (req *RuleUpdateRequest) BuildEkuiperSql(deviceIDs []string, dataType strin
 	return sql
 }
 
+// BuildSubRuleSql 生成第 index 个子规则的 SQL，每个子规则对应一条 eKuiper 规则
+func (req *RuleUpdateRequest) BuildSubRuleSql(index int, dataType string) string {
+	sub := RuleUpdateRequest{Name: req.Name, SubRule: []models.SubRule{req.SubRule[index]}}
+	return sub.BuildEkuiperSql(req.SubRule[index].DeviceId, dataType)
+}
+
 // 1. 创建设备数据触发
 func (req *RuleUpdateRequest) BuildMultiDeviceDataSql(deviceIDs []string, dataType string) string {
 	code := req.SubRule[0].Option["code"]
@@ -191,7 +212,8 @@ func buildDeviceCondition(deviceIDs []string) string {
 	return fmt.Sprintf(`dn IN (%s)`, strings.Join(quotedIDs, ", "))
 }
 
-func ValidateRuleUpdateRequest(req *RuleUpdateRequest, typeStyle string) error {
+// ValidateRuleUpdateRequest 校验规则配置，typeStyles 为各子规则属性的数据类型
+func ValidateRuleUpdateRequest(req *RuleUpdateRequest, typeStyles []string) error {
 	// 1. 校验规则ID
 	if req.Name == "" {
 		return errors.New("规则ID不能为空")
@@ -207,7 +229,15 @@ func ValidateRuleUpdateRequest(req *RuleUpdateRequest, typeStyle string) error {
 		return errors.New("子规则不能为空")
 	}
 
-	for _, subRule := range req.SubRule {
+	if req.Window < 0 {
+		return errors.New("关联窗口不能为负数")
+	}
+
+	for i, subRule := range req.SubRule {
+		typeStyle := ""
+		if i < len(typeStyles) {
+			typeStyle = typeStyles[i]
+		}
 		// 3.1 校验触发方式
 		if !constants.IsTriggerValid(subRule.Trigger) {
 			return fmt.Errorf("非法的触发方式: %s", subRule.Trigger)
@@ -268,17 +298,33 @@ func ValidateRuleUpdateRequest(req *RuleUpdateRequest, typeStyle string) error {
 
 	// 4. 校验通知配置（可选）
 	for _, notify := range req.Notify {
-		if notify.Name == "" || !constants.IsValidAlertWay(notify.Name) {
-			return errors.New("通知方式非法")
+		if err := validateNotify(notify); err != nil {
+			return err
+		}
+	}
+
+	// 4.1 校验升级策略（可选），after 需递增
+	var lastAfter int64
+	for i, escalation := range req.Escalation {
+		if escalation.After <= lastAfter {
+			return fmt.Errorf("第%d级升级时间必须大于上一级", i+1)
 		}
-		if notify.Option == nil || (notify.Option["webhook"] == "" && notify.Option["email"] == "" && notify.Option["phone"] == "") {
-			return errors.New("通知配置必须包含 webhook(包含url)、email、phone 任意方式")
+		lastAfter = escalation.After
+		if len(escalation.Notify) == 0 {
+			return fmt.Errorf("第%d级升级通知不能为空", i+1)
 		}
-		if err := ValidateTimeRange(notify.StartEffectTime, notify.EndEffectTime); err != nil {
-			return errors.New("时间非法" + err.Error())
+		for _, notify := range escalation.Notify {
+			if err := validateNotify(notify); err != nil {
+				return fmt.Errorf("第%d级升级%v", i+1, err)
+			}
 		}
 	}
 
+	// 4.2 校验事件归并方式（可选）
+	if req.GroupBy != models.IncidentGroupNone && req.GroupBy != models.IncidentGroupSn && req.GroupBy != models.IncidentGroupPosition {
+		return errors.New("归并方式必须为空、sn 或 position")
+	}
+
 	// 5. 校验静默时间（可选）
 	if constants.ReturnSilenceTimestamp(req.SilenceTime) == -1 {
 		return errors.New("静默时间配置有误")
@@ -287,6 +333,102 @@ func ValidateRuleUpdateRequest(req *RuleUpdateRequest, typeStyle string) error {
 	return nil
 }
 
+// validateNotify 校验单个通知配置
+func validateNotify(notify models.Notify) error {
+	if notify.Name == "" || !constants.IsValidAlertWay(notify.Name) {
+		return errors.New("通知方式非法")
+	}
+	for _, r := range notify.Recipients {
+		switch r.Type {
+		case models.RecipientUser, models.RecipientRole, models.RecipientDepartment, models.RecipientOnCall:
+		default:
+			return fmt.Errorf("接收人类型 %s 非法", r.Type)
+		}
+		if r.Id <= 0 {
+			return errors.New("接收人ID非法")
+		}
+	}
+	if err := validateNotifyOption(constants.AlertWay(notify.Name), notify.Option, len(notify.Recipients) > 0); err != nil {
+		return fmt.Errorf("%s配置有误: %v", notify.Name, err)
+	}
+	if err := ValidateTimeRange(notify.StartEffectTime, notify.EndEffectTime); err != nil {
+		return errors.New("时间非法" + err.Error())
+	}
+	if notify.CalendarId < 0 {
+		return errors.New("日历ID非法")
+	}
+	switch notify.DayType {
+	case "", models.CalendarWorkday, models.CalendarHoliday:
+	default:
+		return errors.New("日期类型必须为 workday 或 holiday")
+	}
+	return nil
+}
+
+// ValidateNotify 校验通知配置，场景通知动作与告警规则共用
+func ValidateNotify(notify models.Notify) error {
+	return validateNotify(notify)
+}
+
+// validateNotifyOption 按通知方式校验通知参数
+// email: email 收件人，多个以逗号或分号分隔，subject 邮件标题可选
+// 飞书机器人: webhook 机器人地址，secret 签名校验密钥可选
+// 企业微信机器人/钉钉机器人/API接口: webhook
+// sms/语音告警: phone 手机号，多个以逗号分隔
+// 配置了接收人时 email、phone 可为空，发送时按接收人联系方式补充
+func validateNotifyOption(way constants.AlertWay, option map[string]string, hasRecipients bool) error {
+	if option == nil {
+		if hasRecipients && (way == constants.EMAIL || way == constants.SMS || way == constants.PHONE) {
+			return nil
+		}
+		return errors.New("通知参数不能为空")
+	}
+	switch way {
+	case constants.EMAIL:
+		addrs := SplitNotifyTargets(option["email"])
+		if len(addrs) == 0 && !hasRecipients {
+			return errors.New("收件人不能为空")
+		}
+		for _, addr := range addrs {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("收件人 %s 格式错误", addr)
+			}
+		}
+	case constants.SMS, constants.PHONE:
+		phones := SplitNotifyTargets(option["phone"])
+		if len(phones) == 0 && !hasRecipients {
+			return errors.New("手机号不能为空")
+		}
+		for _, phone := range phones {
+			if !phonePattern.MatchString(phone) {
+				return fmt.Errorf("手机号 %s 格式错误", phone)
+			}
+		}
+	default:
+		u, err := url.Parse(strings.TrimSpace(option["webhook"]))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook 必须为 http(s) 地址")
+		}
+	}
+	return nil
+}
+
+// SplitNotifyTargets 拆分以逗号或分号分隔的收件人
+func SplitNotifyTargets(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == '，' || r == '；'
+	})
+	targets := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			targets = append(targets, f)
+		}
+	}
+	return targets
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{5,20}$`)
+
 // 聚合窗口时间
 func (req *RuleUpdateRequest) getWindowSize() int {
 	switch req.SubRule[0].Option["value_cycle"] {
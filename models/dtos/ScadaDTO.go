@@ -1,10 +1,12 @@
 package dtos
 
 type AlarmRecordReq struct {
-	Page      int    `json:"page"`
-	Size      int    `json:"size"`
-	Status    string `json:"status"`
-	StartTime string `json:"starttime"`
-	EndTime   string `json:"endtime"`
-	IsSystem  string `json:"isSystem"`
+	Page       int    `json:"page"`
+	Size       int    `json:"size"`
+	Status     string `json:"status"`
+	State      string `json:"state"`      // 生命周期状态：triggered/acknowledged/recovered/closed
+	IncidentId int64  `json:"incidentId"` // 所属事件
+	StartTime  string `json:"starttime"`
+	EndTime    string `json:"endtime"`
+	IsSystem   string `json:"isSystem"`
 }
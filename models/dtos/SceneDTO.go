@@ -1,6 +1,10 @@
 package dtos
 
-import "time"
+import (
+	"iotServer/models"
+	"iotServer/models/constants"
+	"time"
+)
 
 type SceneCreate struct {
 	Id          int64  `json:"id"`
@@ -9,26 +13,52 @@ type SceneCreate struct {
 }
 
 type SceneUpdateRequest struct {
-	Id        int64       `json:"Id" example:"48023899"` // 场景ID
-	Condition []Condition `json:"condition" `
-	Action    []Action    `json:"action" `
+	Id              int64       `json:"Id" example:"48023899"` // 场景ID
+	Condition       []Condition `json:"condition" `
+	Action          []Action    `json:"action" `
+	ContinueOnError bool        `json:"continue_on_error" example:"false"` // 动作失败时继续执行后续动作
 }
 
-// Condition 场景触发条件
+// Condition 场景条件，timer/notify 为触发条件，time_range/device_state 为触发时校验的限制条件
 type Condition struct {
-	ConditionType string            ` json:"condition_type" example:"timer / notify"`
+	ConditionType string            ` json:"condition_type" example:"timer / notify / time_range / device_state"`
 	Option        map[string]string `json:"option" example:"{\"cron_expression\":\"00 00 * * 0,1,2,3,4\",\"decide_condition\":\"= undefined\"}"` // 存储为JSON字符串
 }
 
-// Action 场景动作
+// SceneTrigger 场景的触发条件，取首个定时或设备触发条件
+func SceneTrigger(conditions []Condition) (Condition, bool) {
+	for _, condition := range conditions {
+		if constants.IsSceneTrigger(condition.ConditionType) {
+			return condition, true
+		}
+	}
+	return Condition{}, false
+}
+
+// Action 场景动作，按 Type 使用对应字段，Type 为空按写设备属性处理
 type Action struct {
+	Type        string `json:"type" example:"property"` // property/delay/notify/webhook/scene/alert_rule/service/parallel
 	ProductId   string `json:"product_id" example:"83114221"`
 	ProductName string `json:"product_name" example:"扭蛋机"`
 	DeviceId    string `json:"device_id" example:"73763730"`
-	DeviceName  string `json:"device_name" example:"1111"`
+	DeviceName  string `json:"device_name" example:"1111"` // property/service: 设备名称
 	Code        string `json:"code" example:"Count"`
 	DataType    string `json:"data_type" example:"int"`
 	Value       string `json:"value" example:"12"`
+
+	Delay     int                    `json:"delay,omitempty" example:"5"`                        // delay: 等待秒数
+	Notify    []models.Notify        `json:"notify,omitempty"`                                   // notify: 通知方式，与告警规则相同
+	Title     string                 `json:"title,omitempty" example:"场景通知"`                     // notify: 通知标题
+	Content   string                 `json:"content,omitempty" example:"已打开照明"`                  // notify: 通知内容
+	Url       string                 `json:"url,omitempty" example:"http://127.0.0.1:8080/hook"` // webhook: 请求地址
+	Method    string                 `json:"method,omitempty" example:"POST"`                    // webhook: 请求方法，默认 POST
+	Headers   map[string]string      `json:"headers,omitempty"`                                  // webhook: 请求头
+	Body      string                 `json:"body,omitempty"`                                     // webhook: 请求体
+	Target    string                 `json:"target,omitempty" example:"夜间模式"`                    // scene/alert_rule: 场景或告警规则名称
+	Operation string                 `json:"operation,omitempty" example:"start"`                // scene/alert_rule: start/stop
+	Service   string                 `json:"service,omitempty" example:"reboot"`                 // service: 服务标识
+	Params    map[string]interface{} `json:"params,omitempty"`                                   // service: 输入参数
+	Branches  [][]Action             `json:"branches,omitempty"`                                 // parallel: 并行分支，分支内按顺序执行
 }
 
 // SceneQueryRequest 查询场景请求
@@ -85,6 +115,29 @@ type SceneListResponse struct {
 	List  []SceneResponse `json:"list"`
 }
 
+// SceneActionResult 场景单个动作的执行结果
+type SceneActionResult struct {
+	Index      int    `json:"index"` // 动作序号，从0开始
+	Path       string `json:"path"`  // 动作位置，并行分支内为 动作.分支.动作，如 3.1.0
+	Type       string `json:"type"`
+	DeviceName string `json:"device_name"`
+	Code       string `json:"code"`
+	Value      string `json:"value"`
+	Seq        string `json:"seq"`             // 控制命令或服务调用序号，对应 WriteLog/ServiceInvoke
+	Status     string `json:"status"`          // 控制命令状态，未执行为 SKIPPED
+	Error      string `json:"error,omitempty"` // 执行失败原因
+}
+
+// SceneLogDetailResponse 场景日志详情
+type SceneLogDetailResponse struct {
+	SceneLogResponse
+	Source    string              `json:"source"`
+	Status    string              `json:"status"`
+	StartTime int64               `json:"start_time"`
+	EndTime   int64               `json:"end_time"`
+	Actions   []SceneActionResult `json:"actions"`
+}
+
 // SceneLogListResponse 场景日志列表响应
 type SceneLogListResponse struct {
 	Total int64              `json:"total"`
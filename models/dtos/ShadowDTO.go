@@ -0,0 +1,8 @@
+package dtos
+
+// ShadowPatchRequest 修改设备影子期望状态
+type ShadowPatchRequest struct {
+	Name    string                 `json:"name" example:"meter_01" description:"设备名称"`
+	Desired map[string]interface{} `json:"desired" example:"{\"switch\":1,\"temp\":null}" description:"期望状态，值为null时删除该属性"`
+	Version int64                  `json:"version" example:"12" description:"当前版本号，不为0时与影子版本不一致则拒绝修改"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 通知投递状态
+const (
+	DeliveryPending = "pending" // 待发送或等待重试
+	DeliverySuccess = "success" // 发送成功
+	DeliveryFailed  = "failed"  // 重试次数用尽或通道不可用
+)
+
+// NotifyDelivery 告警通知投递记录，每个通知方式一条，重试时累加 Attempt
+type NotifyDelivery struct {
+	Id        int64      `orm:"pk;auto" json:"id"`
+	Alert     *AlertList `orm:"rel(fk);on_delete(cascade)" json:"-"`
+	Channel   string     `orm:"size(64)" json:"channel"`                        // 通知方式
+	Target    string     `orm:"size(512);null" json:"target"`                   // webhook、收件人或手机号
+	Title     string     `orm:"size(255);null" json:"title"`                    // 通知标题
+	Content   string     `orm:"type(text);null" json:"content"`                 // 通知内容
+	Format    string     `orm:"size(16);null" json:"format"`                    // text/markdown/card
+	Option    string     `orm:"type(text);null" json:"-"`                       // 通知配置JSON，重试时使用
+	Attempt   int        `orm:"default(0)" json:"attempt"`                      // 已发送次数
+	Status    string     `orm:"size(16);index" json:"status"`                   // 投递状态
+	Response  string     `orm:"type(text);null" json:"response"`                // 最近一次响应或错误
+	Latency   int64      `orm:"default(0)" json:"latency"`                      // 最近一次发送耗时(毫秒)
+	NextRetry int64      `orm:"column(next_retry);null;index" json:"nextRetry"` // 下次重试时间(毫秒)
+	Tenant    int64      `orm:"column(tenant_id);index" json:"-"`               // 租户ID
+	Created   int64      `orm:"null" json:"created"`
+	Modified  int64      `orm:"null" json:"modified"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(NotifyDelivery))
+}
+
+// BeforeInsert 插入前钩子
+func (d *NotifyDelivery) BeforeInsert() error {
+	now := time.Now().Unix()
+	d.Created = now
+	d.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (d *NotifyDelivery) BeforeUpdate() error {
+	d.Modified = time.Now().Unix()
+	return nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 通知模板适用的告警类型
+const (
+	NotifyKindAll        = ""           // 全部类型
+	NotifyKindProperty   = "property"   // 设备数据触发
+	NotifyKindStatus     = "status"     // 设备状态触发
+	NotifyKindEvent      = "event"      // 设备事件触发
+	NotifyKindEscalation = "escalation" // 告警升级
+)
+
+// 通知消息格式，markdown/card 仅企业微信、钉钉、飞书机器人支持，其余通道按文本发送
+const (
+	NotifyFormatText     = "text"
+	NotifyFormatMarkdown = "markdown"
+	NotifyFormatCard     = "card"
+)
+
+// NotifyTemplate 通知模板，规则ID为0、通知方式为空时作为租户默认模板
+type NotifyTemplate struct {
+	Id       int64  `orm:"pk;auto" json:"id"`
+	Name     string `orm:"size(255)" json:"name"`
+	RuleId   int64  `orm:"column(rule_id);default(0);index" json:"ruleId"` // 适用规则，0为全部规则
+	Channel  string `orm:"size(64);null" json:"channel"`                   // 适用通知方式，空为全部
+	Kind     string `orm:"size(32);null" json:"kind"`                      // 适用告警类型，空为全部
+	Format   string `orm:"size(16)" json:"format"`                         // text/markdown/card
+	Title    string `orm:"size(255);null" json:"title"`                    // 标题模板，用于邮件主题、Markdown 及卡片标题
+	Content  string `orm:"type(text)" json:"content"`                      // 内容模板，Go text/template 语法
+	Tenant   int64  `orm:"column(tenant_id);index" json:"-"`               // 租户ID
+	Created  int64  `orm:"null" json:"created"`
+	Modified int64  `orm:"null" json:"modified"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(NotifyTemplate))
+}
+
+// BeforeInsert 插入前钩子
+func (t *NotifyTemplate) BeforeInsert() error {
+	now := time.Now().Unix()
+	t.Created = now
+	t.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (t *NotifyTemplate) BeforeUpdate() error {
+	t.Modified = time.Now().Unix()
+	return nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 通知接收人类型
+const (
+	RecipientUser       = "user"       // 指定用户
+	RecipientRole       = "role"       // 角色下全部用户
+	RecipientDepartment = "department" // 部门及子部门下全部用户
+	RecipientOnCall     = "oncall"     // 值班表当前值班人
+)
+
+// 值班轮换方式
+const (
+	RotationDaily  = "daily"  // 每天交接
+	RotationWeekly = "weekly" // 每周交接
+	RotationCustom = "custom" // 按 ShiftHours 小时交接
+)
+
+// NotifyRecipient 通知接收人，按类型在告警触发时解析为具体用户
+type NotifyRecipient struct {
+	Type string `json:"type" example:"user"` // user/role/department/oncall
+	Id   int64  `json:"id" example:"1"`      // 用户、角色、部门或值班表ID
+}
+
+// ContactProfile 用户联系方式，邮箱为空时使用账号邮箱
+type ContactProfile struct {
+	Id       int64  `orm:"pk;auto" json:"id"`
+	UserId   int64  `orm:"column(user_id);unique" json:"userId"`
+	Email    string `orm:"size(255);null" json:"email"`
+	Phone    string `orm:"size(32);null" json:"phone"`
+	WeComId  string `orm:"column(wecom_id);size(128);null" json:"wecomId"`   // 企业微信 userid，群机器人消息中 @ 使用
+	DingId   string `orm:"column(ding_id);size(128);null" json:"dingId"`     // 钉钉 userId
+	FeishuId string `orm:"column(feishu_id);size(128);null" json:"feishuId"` // 飞书 open_id
+	Tenant   int64  `orm:"column(tenant_id);index" json:"-"`                 // 租户ID
+	Created  int64  `orm:"null" json:"created"`
+	Modified int64  `orm:"null" json:"modified"`
+}
+
+// OnCallSchedule 值班表，成员按顺序轮换，生效时间段外不解析值班人
+type OnCallSchedule struct {
+	Id              int64  `orm:"pk;auto" json:"id"`
+	Name            string `orm:"size(255)" json:"name"`
+	TimeZone        string `orm:"column(time_zone);size(64)" json:"timeZone"`                      // 交接时间及生效时间段所在时区
+	Members         string `orm:"type(text)" json:"-"`                                             // 轮换成员用户ID，JSON数组
+	Rotation        string `orm:"size(16)" json:"rotation"`                                        // daily/weekly/custom
+	ShiftHours      int    `orm:"column(shift_hours);default(0)" json:"shiftHours"`                // custom 轮换的班次时长
+	StartDate       string `orm:"column(start_date);size(10)" json:"startDate"`                    // 首个班次日期 2006-01-02
+	HandoffTime     string `orm:"column(handoff_time);size(8)" json:"handoffTime"`                 // 交接时间 15:04:05
+	StartEffectTime string `orm:"column(start_effect_time);size(8);null" json:"start_effect_time"` // 生效开始时间
+	EndEffectTime   string `orm:"column(end_effect_time);size(8);null" json:"end_effect_time"`     // 生效结束时间
+	Tenant          int64  `orm:"column(tenant_id);index" json:"-"`                                // 租户ID
+	Created         int64  `orm:"null" json:"created"`
+	Modified        int64  `orm:"null" json:"modified"`
+
+	MemberIds []int64 `orm:"-" json:"members"`
+}
+
+// OnCallOverride 值班替换，时间段内由指定用户代替轮换值班人
+type OnCallOverride struct {
+	Id       int64           `orm:"pk;auto" json:"id"`
+	Schedule *OnCallSchedule `orm:"rel(fk);on_delete(cascade)" json:"-"`
+	UserId   int64           `orm:"column(user_id)" json:"userId"`
+	Start    int64           `orm:"index" json:"start"` // 开始时间(秒)
+	End      int64           `orm:"index" json:"end"`   // 结束时间(秒)
+	Remark   string          `orm:"size(255);null" json:"remark"`
+	Created  int64           `orm:"null" json:"created"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(ContactProfile), new(OnCallSchedule), new(OnCallOverride))
+}
+
+// BeforeInsert 插入前钩子
+func (c *ContactProfile) BeforeInsert() error {
+	now := time.Now().Unix()
+	c.Created = now
+	c.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (c *ContactProfile) BeforeUpdate() error {
+	c.Modified = time.Now().Unix()
+	return nil
+}
+
+// BeforeInsert 插入前钩子
+func (s *OnCallSchedule) BeforeInsert() error {
+	now := time.Now().Unix()
+	s.Created = now
+	s.Modified = now
+	return s.encodeMembers()
+}
+
+// BeforeUpdate 更新前钩子
+func (s *OnCallSchedule) BeforeUpdate() error {
+	s.Modified = time.Now().Unix()
+	return s.encodeMembers()
+}
+
+func (s *OnCallSchedule) encodeMembers() error {
+	b, err := json.Marshal(s.MemberIds)
+	if err != nil {
+		return err
+	}
+	s.Members = string(b)
+	return nil
+}
+
+// DecodeMembers 解析轮换成员
+func (s *OnCallSchedule) DecodeMembers() []int64 {
+	s.MemberIds = nil
+	_ = json.Unmarshal([]byte(s.Members), &s.MemberIds)
+	return s.MemberIds
+}
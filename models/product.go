@@ -25,12 +25,32 @@ type Product struct {
 	Extra           string      `orm:"column(extra);null;size(255)" json:"extra,omitempty"`
 	Department      *Department `orm:"rel(fk);on_delete(cascade);null" json:"-"`
 	CategoryId      int64       `orm:"default(0);" json:"categoryId"`
+	ValidatePolicy  string      `orm:"column(validate_policy);null;size(32)" json:"validatePolicy"` // 上报数据校验策略
+	CmdTimeout      int         `orm:"column(cmd_timeout);default(0)" json:"cmdTimeout"`            // 控制命令响应超时(秒)，0使用全局配置
+	CmdRetries      int         `orm:"column(cmd_retries);default(0)" json:"cmdRetries"`            // 控制命令超时重试次数，0使用全局配置，-1不重试
 
 	Properties []*Properties `orm:"reverse(many)" json:"properties"` // 一对多关联
 	Events     []*Events     `orm:"reverse(many)" json:"events"`
 	Actions    []*Actions    `orm:"reverse(many)" json:"actions"`
 }
 
+// 上报数据校验策略
+const (
+	ValidatePolicyNone   = ""       // 不校验
+	ValidatePolicyReject = "reject" // 丢弃不合规的点
+	ValidatePolicyClamp  = "clamp"  // 数值裁剪到范围内，无法修正的点丢弃
+	ValidatePolicyMark   = "mark"   // 原值入库并标记质量为Bad
+)
+
+// IsValidValidatePolicy 校验策略是否合法
+func IsValidValidatePolicy(policy string) bool {
+	switch policy {
+	case ValidatePolicyNone, ValidatePolicyReject, ValidatePolicyClamp, ValidatePolicyMark:
+		return true
+	}
+	return false
+}
+
 func (p *Product) BeforeInsert() error {
 	now := time.Now().Unix()
 	if p.Created == 0 {
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 待注册设备状态
+const (
+	PendingDeviceWaiting  = "pending"  // 待审批
+	PendingDeviceApproved = "approved" // 已注册
+	PendingDeviceIgnored  = "ignored"  // 已忽略，不再记录
+)
+
+// PendingDevice 未注册设备上报时进入的待审批收件箱
+type PendingDevice struct {
+	Id          int64  `orm:"pk;auto" json:"id"`
+	Name        string `orm:"size(255);unique" json:"name"`                   // 设备名称
+	GWSN        string `orm:"size(255);column(sn);index" json:"GWSN"`         // 所属网关SN
+	Description string `orm:"type(text);null" json:"description"`             // 上报的设备描述
+	Keys        string `orm:"type(text);null" json:"keys"`                    // 观测到的属性，逗号分隔
+	Reports     int64  `orm:"default(0)" json:"reports"`                      // 累计上报次数
+	FirstSeen   int64  `orm:"column(first_seen);null" json:"firstSeen"`       // 首次上报时间
+	LastSeen    int64  `orm:"column(last_seen);null" json:"lastSeen"`         // 最近上报时间
+	Status      string `orm:"size(32);index" json:"status"`                   // 状态：pending/approved/ignored
+	ProductId   int64  `orm:"column(product_id);default(0)" json:"productId"` // 注册到的产品
+	Rule        int64  `orm:"column(rule_id);default(0)" json:"ruleId"`       // 命中的自动注册规则，人工审批为0
+	Error       string `orm:"type(text);null" json:"error"`                   // 最近一次自动注册失败原因
+	Tenant      int64  `orm:"column(tenant_id);null;index" json:"-"`          // 按网关推断的租户，未知为0，推断出租户前不对任何租户可见
+	Created     int64  `orm:"null" json:"created"`
+	Modified    int64  `orm:"null" json:"modified"`
+}
+
+// ProvisionRule 网关自动注册规则，设备名称匹配 Pattern 时自动注册到产品
+type ProvisionRule struct {
+	Id          int64    `orm:"pk;auto" json:"id"`
+	GWSN        string   `orm:"size(255);column(sn);index" json:"GWSN"` // 网关SN，* 表示本租户所有网关
+	Pattern     string   `orm:"size(255)" json:"pattern"`               // 设备名称通配符，如 meter_*
+	Product     *Product `orm:"rel(fk);column(product_id);on_delete(cascade)" json:"-"`
+	PositionId  int64    `orm:"column(position_id);default(0)" json:"positionId"` // 注册后的位置
+	GroupId     int64    `orm:"column(group_id);default(0)" json:"groupId"`       // 注册后的分组
+	Priority    int      `orm:"default(0)" json:"priority"`                       // 优先级，越大越先匹配
+	Enabled     bool     `orm:"default(true)" json:"enabled"`
+	Description string   `orm:"type(text);null" json:"description"`
+	Tenant      int64    `orm:"column(tenant_id);index" json:"-"`
+	Created     int64    `orm:"null" json:"created"`
+	Modified    int64    `orm:"null" json:"modified"`
+
+	ProductId   int64  `orm:"-" json:"productId"`
+	ProductName string `orm:"-" json:"productName"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(PendingDevice), new(ProvisionRule))
+}
+
+// BeforeInsert 插入前钩子
+func (p *PendingDevice) BeforeInsert() error {
+	now := time.Now().Unix()
+	if p.Created == 0 {
+		p.Created = now
+	}
+	p.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (p *PendingDevice) BeforeUpdate() error {
+	p.Modified = time.Now().Unix()
+	return nil
+}
+
+// BeforeInsert 插入前钩子
+func (r *ProvisionRule) BeforeInsert() error {
+	now := time.Now().Unix()
+	if r.Created == 0 {
+		r.Created = now
+	}
+	r.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (r *ProvisionRule) BeforeUpdate() error {
+	r.Modified = time.Now().Unix()
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// 场景执行来源
+const (
+	SceneSourceCron     = "cron"     // 定时触发
+	SceneSourceCallback = "callback" // 设备触发(eKuiper 或内置流规则回调)
+	SceneSourceManual   = "manual"   // 手动执行
+)
+
+// 场景执行结果
+const (
+	SceneRunRunning = "running" // 执行中
+	SceneRunSuccess = "success" // 全部动作下发成功
+	SceneRunPartial = "partial" // 部分动作失败(继续执行)
+	SceneRunFailed  = "failed"  // 动作失败中止或全部失败
+	SceneRunSkipped = "skipped" // 限制条件不满足，未执行动作
+)
+
+// SceneActionSkipped 动作因前序动作失败中止而未执行
+const SceneActionSkipped = "SKIPPED"
+
+// SceneLog 场景执行记录，动作结果以 JSON 保存
+type SceneLog struct {
+	Id        int64  `orm:"pk;auto" json:"id"`
+	SceneId   int64  `orm:"column(scene_id);index" json:"scene_id"`
+	Name      string `orm:"size(255)" json:"name"`                 // 场景名称
+	Source    string `orm:"size(32)" json:"source"`                // cron/callback/manual
+	Status    string `orm:"size(32);index" json:"status"`          // running/success/partial/failed/skipped
+	StartTime int64  `orm:"column(start_time)" json:"start_time"`  // 开始时间(毫秒)
+	EndTime   int64  `orm:"column(end_time);null" json:"end_time"` // 结束时间(毫秒)
+	ExecRes   string `orm:"type(text);null" json:"exec_res"`       // 执行结果描述
+	Actions   string `orm:"type(text);null" json:"-"`              // 各动作结果
+	Tenant    int64  `orm:"column(tenant_id);index" json:"-"`      // 租户ID
+	Created   int64  `orm:"null" json:"created"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(SceneLog))
+}
+
+// BeforeInsert 插入前钩子
+func (l *SceneLog) BeforeInsert() error {
+	if l.Created == 0 {
+		l.Created = time.Now().Unix()
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// ServiceInvoke 物模型服务调用记录，状态复用控制命令的 WAIT/SUCCESS/FAIL/TIMEOUT/EXPIRED
+type ServiceInvoke struct {
+	Id       int64  `orm:"pk;auto" json:"id"`
+	Seq      string `orm:"size(64);unique" json:"seq"`
+	Sn       string `orm:"size(255)" json:"sn"`
+	Dn       string `orm:"size(255);index" json:"dn"`
+	Service  string `orm:"size(255)" json:"service"`                   // 服务标识(Actions.Code)
+	CallType string `orm:"column(call_type);size(16)" json:"callType"` // SYNC/ASYNC
+	Input    string `orm:"type(text);null" json:"input"`               // 输入参数JSON
+	Output   string `orm:"type(text);null" json:"output"`              // 设备返回的输出参数JSON
+	Status   string `orm:"size(32);index" json:"status"`               // 调用状态
+	Error    string `orm:"type(text);null" json:"error"`               // 失败原因
+	Callback string `orm:"size(512);null" json:"callback"`             // ASYNC 调用完成后回调的地址
+	UserId   int64  `orm:"column(user_id);null" json:"userId"`         // 调用人
+	Tenant   int64  `orm:"column(tenant_id);index" json:"-"`           // 租户ID
+	RespTime int64  `orm:"column(resp_time);null" json:"respTime"`     // 响应时间
+	Created  int64  `orm:"null" json:"created"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(ServiceInvoke))
+}
+
+// BeforeInsert 插入前钩子
+func (s *ServiceInvoke) BeforeInsert() error {
+	if s.Created == 0 {
+		s.Created = time.Now().Unix()
+	}
+	return nil
+}
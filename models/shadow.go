@@ -0,0 +1,40 @@
+package models
+
+import (
+	"github.com/beego/beego/v2/client/orm"
+	"time"
+)
+
+// DeviceShadow 设备影子，保存设备上报状态与期望状态
+type DeviceShadow struct {
+	Id       int64  `orm:"pk;auto" json:"id"`
+	Name     string `orm:"size(255);unique" json:"name"`          // 设备名称
+	Reported string `orm:"type(text);null" json:"reported"`       // 上报状态(JSON)
+	Desired  string `orm:"type(text);null" json:"desired"`        // 期望状态(JSON)
+	Metadata string `orm:"type(text);null" json:"metadata"`       // 各属性的更新时间(JSON)
+	Version  int64  `orm:"default(0)" json:"version"`             // 版本号，每次状态变化递增
+	Tenant   int64  `orm:"column(tenant_id);null;index" json:"-"` // 租户ID
+	Created  int64  `orm:"null" json:"created"`
+	Modified int64  `orm:"null" json:"modified"`
+}
+
+func init() {
+	// 注册模型
+	orm.RegisterModel(new(DeviceShadow))
+}
+
+// BeforeInsert 插入前钩子
+func (d *DeviceShadow) BeforeInsert() error {
+	now := time.Now().Unix()
+	if d.Created == 0 {
+		d.Created = now
+	}
+	d.Modified = now
+	return nil
+}
+
+// BeforeUpdate 更新前钩子
+func (d *DeviceShadow) BeforeUpdate() error {
+	d.Modified = time.Now().Unix()
+	return nil
+}
@@ -5,6 +5,15 @@ import (
 	"time"
 )
 
+// 控制命令状态
+const (
+	WriteLogWait    = "WAIT"    // 已下发，等待响应
+	WriteLogSuccess = "SUCCESS" // 执行成功
+	WriteLogFail    = "FAIL"    // 执行失败或下发失败
+	WriteLogTimeout = "TIMEOUT" // 重试用尽仍未响应
+	WriteLogExpired = "EXPIRED" // 超过有效期未得到结果(如服务重启后丢失跟踪)
+)
+
 // WriteLog 记录操作日志
 type WriteLog struct {
 	Seq        string      `orm:"size(255);index;pk" json:"seq"`
@@ -16,6 +25,8 @@ type WriteLog struct {
 	Status     string      `orm:"size(255)" json:"status"`
 	Channel    string      `orm:"size(255)" json:"channel"`
 	RespTime   int64       `orm:"null" json:"respTime"`
+	Attempts   int         `orm:"default(0)" json:"attempts"`                 // 下发次数(含重试)
+	BatchId    int64       `orm:"column(batch_id);null;index" json:"batchId"` // 所属批量控制任务，单条控制为0
 	Created    int64       `orm:"null" json:"created"`
 	Department *Department `orm:"rel(fk);on_delete(cascade);null" json:"-"`
 }
@@ -115,6 +115,24 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "Ack",
+			Router:           `/ack`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "Close",
+			Router:           `/close`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
 		beego.ControllerComments{
 			Method:           "Delete",
@@ -124,6 +142,24 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "DeliveryList",
+			Router:           `/delivery/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "DeliveryResend",
+			Router:           `/delivery/resend`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
 		beego.ControllerComments{
 			Method:           "Detail",
@@ -142,6 +178,42 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "History",
+			Router:           `/history`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "IncidentClose",
+			Router:           `/incident/close`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "IncidentDetail",
+			Router:           `/incident/detail`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
+		beego.ControllerComments{
+			Method:           "IncidentList",
+			Router:           `/incident/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:AlertController"] = append(beego.GlobalControllerRouter["iotServer/controllers:AlertController"],
 		beego.ControllerComments{
 			Method:           "UpdateStatus",
@@ -151,6 +223,193 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:BatchController"] = append(beego.GlobalControllerRouter["iotServer/controllers:BatchController"],
+		beego.ControllerComments{
+			Method:           "Cancel",
+			Router:           `/cancel`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:BatchController"] = append(beego.GlobalControllerRouter["iotServer/controllers:BatchController"],
+		beego.ControllerComments{
+			Method:           "Create",
+			Router:           `/create`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:BatchController"] = append(beego.GlobalControllerRouter["iotServer/controllers:BatchController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:BatchController"] = append(beego.GlobalControllerRouter["iotServer/controllers:BatchController"],
+		beego.ControllerComments{
+			Method:           "Report",
+			Router:           `/report`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "Check",
+			Router:           `/check`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "Delete",
+			Router:           `/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "DeleteDays",
+			Router:           `/day/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "ImportDays",
+			Router:           `/day/import`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "ListDays",
+			Router:           `/day/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "Save",
+			Router:           `/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "SaveDays",
+			Router:           `/day/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "SetTimeZone",
+			Router:           `/timezone/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CalendarController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CalendarController"],
+		beego.ControllerComments{
+			Method:           "TimeZone",
+			Router:           `/timezone`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CredentialController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CredentialController"],
+		beego.ControllerComments{
+			Method:           "Issue",
+			Router:           `/issue`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("kind", param.IsRequired),
+				param.New("name", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CredentialController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CredentialController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("page"),
+				param.New("size"),
+				param.New("kind"),
+				param.New("name"),
+				param.New("status"),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CredentialController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CredentialController"],
+		beego.ControllerComments{
+			Method:           "Revoke",
+			Router:           `/revoke`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("ids", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CredentialController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CredentialController"],
+		beego.ControllerComments{
+			Method:           "Rotate",
+			Router:           `/rotate`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("id", param.IsRequired),
+				param.New("grace"),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:CredentialController"] = append(beego.GlobalControllerRouter["iotServer/controllers:CredentialController"],
+		beego.ControllerComments{
+			Method:           "Triplet",
+			Router:           `/triplet`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("id", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:DepartmentController"] = append(beego.GlobalControllerRouter["iotServer/controllers:DepartmentController"],
 		beego.ControllerComments{
 			Method:           "CreateDepartment",
@@ -277,6 +536,24 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:EkuiperController"] = append(beego.GlobalControllerRouter["iotServer/controllers:EkuiperController"],
+		beego.ControllerComments{
+			Method:           "Drift",
+			Router:           `/drift`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:EkuiperController"] = append(beego.GlobalControllerRouter["iotServer/controllers:EkuiperController"],
+		beego.ControllerComments{
+			Method:           "Reconcile",
+			Router:           `/reconcile`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:EkuiperController"] = append(beego.GlobalControllerRouter["iotServer/controllers:EkuiperController"],
 		beego.ControllerComments{
 			Method:           "SceneCallback",
@@ -457,6 +734,33 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:InvokeController"] = append(beego.GlobalControllerRouter["iotServer/controllers:InvokeController"],
+		beego.ControllerComments{
+			Method:           "Call",
+			Router:           `/call`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:InvokeController"] = append(beego.GlobalControllerRouter["iotServer/controllers:InvokeController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:InvokeController"] = append(beego.GlobalControllerRouter["iotServer/controllers:InvokeController"],
+		beego.ControllerComments{
+			Method:           "Result",
+			Router:           `/result`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:MenuController"] = append(beego.GlobalControllerRouter["iotServer/controllers:MenuController"],
 		beego.ControllerComments{
 			Method:           "Create",
@@ -538,6 +842,159 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:MonitorController"] = append(beego.GlobalControllerRouter["iotServer/controllers:MonitorController"],
+		beego.ControllerComments{
+			Method:           "QueueStats",
+			Router:           `/queue`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:MqttHookController"] = append(beego.GlobalControllerRouter["iotServer/controllers:MqttHookController"],
+		beego.ControllerComments{
+			Method:           "Acl",
+			Router:           `/acl`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:MqttHookController"] = append(beego.GlobalControllerRouter["iotServer/controllers:MqttHookController"],
+		beego.ControllerComments{
+			Method:           "Auth",
+			Router:           `/auth`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"] = append(beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"],
+		beego.ControllerComments{
+			Method:           "Delete",
+			Router:           `/template/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"] = append(beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/template/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"] = append(beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"],
+		beego.ControllerComments{
+			Method:           "Preview",
+			Router:           `/template/preview`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"] = append(beego.GlobalControllerRouter["iotServer/controllers:NotifyTemplateController"],
+		beego.ControllerComments{
+			Method:           "Save",
+			Router:           `/template/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "AddOverride",
+			Router:           `/oncall/override/add`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "Current",
+			Router:           `/oncall/current`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "DeleteOverrides",
+			Router:           `/oncall/override/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "DeleteSchedules",
+			Router:           `/oncall/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "ListContacts",
+			Router:           `/contact/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "ListOverrides",
+			Router:           `/oncall/override/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "ListSchedules",
+			Router:           `/oncall/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "Resolve",
+			Router:           `/recipient/resolve`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "SaveContact",
+			Router:           `/contact/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:OnCallController"] = append(beego.GlobalControllerRouter["iotServer/controllers:OnCallController"],
+		beego.ControllerComments{
+			Method:           "SaveSchedule",
+			Router:           `/oncall/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:PositionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:PositionController"],
 		beego.ControllerComments{
 			Method:           "Create",
@@ -646,6 +1103,125 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "PendingApprove",
+			Router:           `/pending/approve`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("ids", param.IsRequired),
+				param.New("productId", param.IsRequired),
+				param.New("positionId"),
+				param.New("groupId"),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "PendingDelete",
+			Router:           `/pending/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("ids", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "PendingIgnore",
+			Router:           `/pending/ignore`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("ids", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "PendingList",
+			Router:           `/pending/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("page"),
+				param.New("size"),
+				param.New("sn"),
+				param.New("name"),
+				param.New("status"),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "RuleDelete",
+			Router:           `/rule/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("ids", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "RuleList",
+			Router:           `/rule/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("sn"),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ProvisionController"],
+		beego.ControllerComments{
+			Method:           "RuleSave",
+			Router:           `/rule/save`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("id"),
+				param.New("sn", param.IsRequired),
+				param.New("pattern", param.IsRequired),
+				param.New("productId", param.IsRequired),
+				param.New("positionId"),
+				param.New("groupId"),
+				param.New("priority"),
+				param.New("enabled"),
+				param.New("description"),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ReportController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ReportController"],
+		beego.ControllerComments{
+			Method:           "DeadLetterDelete",
+			Router:           `/deadLetter/delete`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ReportController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ReportController"],
+		beego.ControllerComments{
+			Method:           "DeadLetterList",
+			Router:           `/deadLetter/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ReportController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ReportController"],
+		beego.ControllerComments{
+			Method:           "DeadLetterReplay",
+			Router:           `/deadLetter/replay`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:ReportController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ReportController"],
 		beego.ControllerComments{
 			Method:           "ExportTimePeriodReport",
@@ -763,6 +1339,15 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:RuleController"] = append(beego.GlobalControllerRouter["iotServer/controllers:RuleController"],
+		beego.ControllerComments{
+			Method:           "Backtest",
+			Router:           `/backtest`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:RuleController"] = append(beego.GlobalControllerRouter["iotServer/controllers:RuleController"],
 		beego.ControllerComments{
 			Method:           "Edit",
@@ -808,6 +1393,15 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:SceneController"] = append(beego.GlobalControllerRouter["iotServer/controllers:SceneController"],
+		beego.ControllerComments{
+			Method:           "Analyze",
+			Router:           `/analyze`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:SceneController"] = append(beego.GlobalControllerRouter["iotServer/controllers:SceneController"],
 		beego.ControllerComments{
 			Method:           "Edit",
@@ -826,6 +1420,24 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:SceneController"] = append(beego.GlobalControllerRouter["iotServer/controllers:SceneController"],
+		beego.ControllerComments{
+			Method:           "LogDetail",
+			Router:           `/log/detail`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:SceneController"] = append(beego.GlobalControllerRouter["iotServer/controllers:SceneController"],
+		beego.ControllerComments{
+			Method:           "LogList",
+			Router:           `/log/list`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:SceneController"] = append(beego.GlobalControllerRouter["iotServer/controllers:SceneController"],
 		beego.ControllerComments{
 			Method:           "OperateScene",
@@ -853,6 +1465,37 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:ShadowController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ShadowController"],
+		beego.ControllerComments{
+			Method:           "Desired",
+			Router:           `/desired`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ShadowController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ShadowController"],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           `/get`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("name", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:ShadowController"] = append(beego.GlobalControllerRouter["iotServer/controllers:ShadowController"],
+		beego.ControllerComments{
+			Method:           "Sync",
+			Router:           `/sync`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("name", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
 	beego.GlobalControllerRouter["iotServer/controllers:TenantController"] = append(beego.GlobalControllerRouter["iotServer/controllers:TenantController"],
 		beego.ControllerComments{
 			Method:           "Setting",
@@ -1028,4 +1671,27 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["iotServer/controllers:WriteController"] = append(beego.GlobalControllerRouter["iotServer/controllers:WriteController"],
+		beego.ControllerComments{
+			Method:           "Result",
+			Router:           `/result`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("seq", param.IsRequired),
+			),
+			Filters: nil,
+			Params:  nil})
+
+	beego.GlobalControllerRouter["iotServer/controllers:WriteController"] = append(beego.GlobalControllerRouter["iotServer/controllers:WriteController"],
+		beego.ControllerComments{
+			Method:           "Wait",
+			Router:           `/wait`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams: param.Make(
+				param.New("seq", param.IsRequired),
+				param.New("timeout"),
+			),
+			Filters: nil,
+			Params:  nil})
+
 }
@@ -117,6 +117,52 @@ func init() {
 				&controllers.DepartmentController{},
 			),
 		),
+		beego.NSNamespace("/monitor",
+			beego.NSInclude(
+				&controllers.MonitorController{},
+			),
+		),
+		beego.NSNamespace("/provision",
+			beego.NSInclude(
+				&controllers.ProvisionController{},
+			),
+		),
+		beego.NSNamespace("/credential",
+			beego.NSInclude(
+				&controllers.CredentialController{},
+			),
+		),
+		beego.NSNamespace("/mqtt",
+			beego.NSInclude(
+				&controllers.MqttHookController{},
+			),
+		),
+		beego.NSNamespace("/shadow",
+			beego.NSInclude(
+				&controllers.ShadowController{},
+			),
+		),
+		beego.NSNamespace("/invoke",
+			beego.NSInclude(
+				&controllers.InvokeController{},
+			),
+		),
+		beego.NSNamespace("/batch",
+			beego.NSInclude(
+				&controllers.BatchController{},
+			),
+		),
+		beego.NSNamespace("/notify",
+			beego.NSInclude(
+				&controllers.NotifyTemplateController{},
+				&controllers.OnCallController{},
+			),
+		),
+		beego.NSNamespace("/calendar",
+			beego.NSInclude(
+				&controllers.CalendarController{},
+			),
+		),
 	)
 	// 独立的 WebSocket 命名空间
 	ws := beego.NewNamespace("/ws",
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 网关事件告警是否按网关SN归并为事件
+var alertGroupGateway = beego.AppConfig.DefaultBool("alertGroupGateway", true)
+
+// AlertIncidentService 告警事件
+type AlertIncidentService struct{}
+
+// openAlertStates 未恢复的告警状态
+var openAlertStates = []string{string(constants.AlertTriggered), string(constants.AlertAcknowledged)}
+
+// alertFingerprint 告警去重键：规则|设备|属性，条件为all的告警按全部命中的设备属性排序拼接
+func alertFingerprint(ruleId int64, result map[string]interface{}, fired []map[string]interface{}) string {
+	keys := []string{}
+	if len(fired) > 1 {
+		for _, hit := range fired {
+			keys = append(keys, fmt.Sprintf("%v.%v", hit["dn"], hitCode(hit)))
+		}
+		sort.Strings(keys)
+		return fmt.Sprintf("%d|%s", ruleId, strings.Join(keys, ","))
+	}
+	return fmt.Sprintf("%d|%v|%s", ruleId, result["dn"], hitCode(result))
+}
+
+// hitCode 命中的属性或事件code，设备状态触发取状态
+func hitCode(hit map[string]interface{}) string {
+	if code, ok := hit["code"].(string); ok && code != "" {
+		return code
+	}
+	if event, ok := hit["event"].(string); ok && event != "" {
+		return event
+	}
+	return InterfaceToString(hit["value"])
+}
+
+// peakValue 取更极端的值，判断条件为小于时取最小值，非数值取最新值
+func peakValue(cond, peak, value string) string {
+	p, err1 := strconv.ParseFloat(peak, 64)
+	v, err2 := strconv.ParseFloat(value, 64)
+	if err1 != nil || err2 != nil {
+		return value
+	}
+	if strings.HasPrefix(strings.TrimSpace(cond), "<") {
+		if v < p {
+			return value
+		}
+		return peak
+	}
+	if v > p {
+		return value
+	}
+	return peak
+}
+
+// foldAlert 相同去重键的告警未恢复时累加触发次数，返回是否已归并
+func foldAlert(o orm.Ormer, fingerprint, cond, value string) (bool, error) {
+	var alert models.AlertList
+	err := o.QueryTable(new(models.AlertList)).
+		Filter("fingerprint", fingerprint).
+		Filter("state__in", openAlertStates).
+		OrderBy("-id").
+		Limit(1).
+		One(&alert)
+	if err == orm.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询未恢复告警失败: %v", err)
+	}
+	if alert.Occurrences == 0 {
+		alert.Occurrences = 1
+	}
+	alert.Occurrences++
+	alert.LastSeen = time.Now().UnixMilli()
+	if value != "" {
+		if alert.PeakValue == "" {
+			alert.PeakValue = value
+		} else {
+			alert.PeakValue = peakValue(cond, alert.PeakValue, value)
+		}
+	}
+	_ = alert.BeforeUpdate()
+	if _, err = o.Update(&alert, "Occurrences", "LastSeen", "PeakValue", "Modified"); err != nil {
+		return false, fmt.Errorf("更新告警触发次数失败: %v", err)
+	}
+	if alert.IncidentId > 0 {
+		_, _ = o.QueryTable(new(models.AlertIncident)).Filter("id", alert.IncidentId).
+			Update(orm.Params{"last_seen": alert.LastSeen})
+	}
+	return true, nil
+}
+
+// incidentGroupValue 按归并方式取设备所属网关SN或位置ID，同时返回设备租户
+func incidentGroupValue(o orm.Ormer, groupBy, dn string) (string, int64) {
+	device := models.Device{Name: dn}
+	if dn == "" || o.Read(&device, "Name") != nil {
+		return "", 0
+	}
+	switch groupBy {
+	case models.IncidentGroupSn:
+		return device.GWSN, device.Tenant
+	case models.IncidentGroupPosition:
+		if device.Position != nil && device.Position.Id > 0 {
+			return strconv.FormatInt(device.Position.Id, 10), device.Tenant
+		}
+	}
+	return "", device.Tenant
+}
+
+// attachIncident 将告警归入同一网关或位置下未关闭的事件，返回是否新建了事件
+func attachIncident(o orm.Ormer, alert *models.AlertList, groupBy, groupValue, title, level string, department *models.Department) bool {
+	if groupBy == models.IncidentGroupNone || groupValue == "" {
+		return true
+	}
+	qs := o.QueryTable(new(models.AlertIncident)).
+		Filter("group_by", groupBy).
+		Filter("group_value", groupValue).
+		Filter("state", models.IncidentOpen)
+	if department != nil {
+		qs = qs.Filter("department_id", department.Id)
+	}
+	var incident models.AlertIncident
+	created := false
+	if err := qs.OrderBy("-id").Limit(1).One(&incident); err == nil {
+		incident.Count++
+		incident.LastSeen = alert.TriggerTime
+		if _, err = o.Update(&incident, "Count", "LastSeen"); err != nil {
+			logs.Error("更新告警事件 %d 失败: %v", incident.Id, err)
+		}
+	} else {
+		incident = models.AlertIncident{
+			GroupBy:    groupBy,
+			GroupValue: groupValue,
+			Title:      title,
+			AlertLevel: level,
+			Count:      1,
+			FirstSeen:  alert.TriggerTime,
+			LastSeen:   alert.TriggerTime,
+			State:      models.IncidentOpen,
+			Department: department,
+		}
+		if _, err = o.Insert(&incident); err != nil {
+			logs.Error("创建告警事件失败: %v", err)
+			return true
+		}
+		created = true
+	}
+	alert.IncidentId = incident.Id
+	if _, err := o.Update(alert, "IncidentId"); err != nil {
+		logs.Error("告警 %d 关联事件失败: %v", alert.Id, err)
+	}
+	return created
+}
+
+// releaseIncident 事件下已无未恢复告警时关闭事件
+func releaseIncident(o orm.Ormer, incidentId int64) {
+	if incidentId == 0 {
+		return
+	}
+	count, err := o.QueryTable(new(models.AlertList)).
+		Filter("incident_id", incidentId).
+		Filter("state__in", openAlertStates).
+		Count()
+	if err != nil || count > 0 {
+		return
+	}
+	_, err = o.QueryTable(new(models.AlertIncident)).
+		Filter("id", incidentId).
+		Filter("state", models.IncidentOpen).
+		Update(orm.Params{"state": models.IncidentClosed, "close_time": time.Now().UnixMilli()})
+	if err != nil {
+		logs.Error("关闭告警事件 %d 失败: %v", incidentId, err)
+	}
+}
+
+// getTenantIncident 校验事件归属
+func getTenantIncident(o orm.Ormer, tenantId, id int64) (*models.AlertIncident, error) {
+	incident := &models.AlertIncident{Id: id}
+	if err := o.Read(incident); err != nil {
+		return nil, fmt.Errorf("告警事件 %d 不存在", id)
+	}
+	if incident.Department == nil || incident.Department.Id != tenantId {
+		return nil, fmt.Errorf("告警事件 %d 不存在", id)
+	}
+	return incident, nil
+}
+
+// List 分页查询告警事件
+func (s *AlertIncidentService) List(tenantId int64, state, groupBy string, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.AlertIncident)).Filter("department_id", tenantId).OrderBy("-last_seen")
+	if state != "" {
+		qs = qs.Filter("state", state)
+	}
+	if groupBy != "" {
+		qs = qs.Filter("group_by", groupBy)
+	}
+	var list []*models.AlertIncident
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// Detail 事件及其归并的告警
+func (s *AlertIncidentService) Detail(tenantId, id int64) (map[string]interface{}, error) {
+	o := orm.NewOrm()
+	incident, err := getTenantIncident(o, tenantId, id)
+	if err != nil {
+		return nil, err
+	}
+	var alerts []*models.AlertList
+	if _, err = o.QueryTable(new(models.AlertList)).Filter("incident_id", id).OrderBy("-TriggerTime").All(&alerts); err != nil {
+		return nil, fmt.Errorf("查询事件告警失败: %v", err)
+	}
+	return map[string]interface{}{
+		"incident": incident,
+		"alerts":   alerts,
+	}, nil
+}
+
+// Close 关闭事件及其下全部未关闭的告警
+func (s *AlertIncidentService) Close(tenantId, userId, id int64, message string) error {
+	o := orm.NewOrm()
+	incident, err := getTenantIncident(o, tenantId, id)
+	if err != nil {
+		return err
+	}
+	var alerts []*models.AlertList
+	_, err = o.QueryTable(new(models.AlertList)).
+		Filter("incident_id", id).
+		Exclude("state", string(constants.AlertClosed)).
+		All(&alerts, "Id")
+	if err != nil {
+		return fmt.Errorf("查询事件告警失败: %v", err)
+	}
+	for _, alert := range alerts {
+		if err = closeAlert(o, alert.Id, userId, message); err != nil {
+			return fmt.Errorf("关闭告警 %d 失败: %v", alert.Id, err)
+		}
+	}
+	if incident.State == models.IncidentOpen {
+		incident.State = models.IncidentClosed
+		incident.CloseTime = time.Now().UnixMilli()
+		if _, err = o.Update(incident, "State", "CloseTime"); err != nil {
+			return fmt.Errorf("关闭事件失败: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,569 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const alertLifecycleInterval = 30 * time.Second
+
+// 已恢复的告警超过该秒数自动关闭，0不自动关闭
+var alertAutoClose = beego.AppConfig.DefaultInt64("alertAutoClose", 3600)
+
+// openAlert 未恢复告警中的一个命中条件，条件解除时告警恢复
+type openAlert struct {
+	alertId  int64
+	ruleId   int64  // 网关事件告警为0
+	subRule  int    // 子规则序号
+	trigger  string // 触发方式，网关事件为 gateway
+	code     string // 属性或事件code
+	cond     string // 原始值触发的判断条件
+	window   time.Duration
+	lastHit  time.Time
+	statusOn string // 设备状态触发的状态
+}
+
+// openAlerts 设备名 -> 未恢复告警的命中条件
+var openAlerts = struct {
+	sync.Mutex
+	byDn map[string][]*openAlert
+}{byDn: make(map[string][]*openAlert)}
+
+const gatewayAlertTrigger = "gateway"
+
+// AlertLifecycleService 告警生命周期
+type AlertLifecycleService struct{}
+
+// recordAlertTransition 记录告警状态变更
+func recordAlertTransition(o orm.Ormer, alertId int64, action, from, to string, operator int64, remark string) {
+	transition := &models.AlertTransition{
+		Alert:    &models.AlertList{Id: alertId},
+		Action:   action,
+		From:     from,
+		To:       to,
+		Operator: operator,
+		Remark:   remark,
+		Created:  time.Now().UnixMilli(),
+	}
+	if _, err := o.Insert(transition); err != nil {
+		logs.Error("记录告警 %d 状态变更失败: %v", alertId, err)
+	}
+}
+
+// newOpenAlert 根据子规则配置生成恢复条件
+func newOpenAlert(alertId int64, rule *models.AlertRule, index int, subRules []models.SubRule) *openAlert {
+	entry := &openAlert{alertId: alertId, subRule: index, lastHit: time.Now()}
+	if rule == nil {
+		entry.trigger = gatewayAlertTrigger
+		return entry
+	}
+	entry.ruleId = rule.Id
+	if index >= len(subRules) {
+		return entry
+	}
+	sub := subRules[index]
+	entry.trigger = sub.Trigger
+	entry.code = sub.Option["code"]
+	entry.statusOn = sub.Option["status"]
+	if sub.Option["value_type"] == "" || sub.Option["value_type"] == string(constants.Original) {
+		entry.cond = sub.Option["decide_condition"]
+	} else {
+		entry.window = time.Duration(windowSeconds(sub.Option["value_cycle"])) * time.Second
+	}
+	return entry
+}
+
+// windowSeconds 聚合周期对应的秒数
+func windowSeconds(cycle string) int {
+	switch cycle {
+	case "5分钟周期":
+		return 5 * 60
+	case "15分钟周期":
+		return 15 * 60
+	case "30分钟周期":
+		return 30 * 60
+	case "60分钟周期":
+		return 60 * 60
+	default:
+		return 60
+	}
+}
+
+// trackOpenAlert 登记告警的命中条件，用于自动恢复
+func trackOpenAlert(dn string, entry *openAlert) {
+	if dn == "" {
+		return
+	}
+	openAlerts.Lock()
+	openAlerts.byDn[dn] = append(openAlerts.byDn[dn], entry)
+	openAlerts.Unlock()
+}
+
+// untrackAlert 告警恢复或关闭后移除所有命中条件
+func untrackAlert(alertId int64) {
+	openAlerts.Lock()
+	defer openAlerts.Unlock()
+	for dn, entries := range openAlerts.byDn {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.alertId != alertId {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == 0 {
+			delete(openAlerts.byDn, dn)
+		} else {
+			openAlerts.byDn[dn] = kept
+		}
+	}
+}
+
+// touchOpenAlerts 子规则再次命中时刷新最近命中时间，聚合触发以此判断条件是否解除
+func touchOpenAlerts(ruleId int64, index int, dn string) {
+	openAlerts.Lock()
+	defer openAlerts.Unlock()
+	for _, e := range openAlerts.byDn[dn] {
+		if e.ruleId == ruleId && e.subRule == index {
+			e.lastHit = time.Now()
+		}
+	}
+}
+
+// matchOpenAlerts 找出满足条件的告警ID
+func matchOpenAlerts(dn string, match func(e *openAlert) bool) []int64 {
+	openAlerts.Lock()
+	defer openAlerts.Unlock()
+	seen := make(map[int64]bool)
+	var ids []int64
+	for _, e := range openAlerts.byDn[dn] {
+		if !seen[e.alertId] && match(e) {
+			seen[e.alertId] = true
+			ids = append(ids, e.alertId)
+		}
+	}
+	return ids
+}
+
+// loadOpenAlerts 启动时从数据库恢复未恢复告警的命中条件
+func loadOpenAlerts() {
+	var alerts []*models.AlertList
+	_, err := orm.NewOrm().QueryTable(new(models.AlertList)).
+		Filter("state__in", string(constants.AlertTriggered), string(constants.AlertAcknowledged)).
+		RelatedSel("AlertRule").All(&alerts)
+	if err != nil {
+		logs.Error("加载未恢复告警失败: %v", err)
+		return
+	}
+	for _, alert := range alerts {
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(alert.AlertResult), &result); err != nil {
+			continue
+		}
+		registerAlertHits(alert, result)
+	}
+	logs.Info("已加载 %d 条未恢复告警", len(alerts))
+}
+
+// registerAlertHits 按告警内容登记命中条件，多子规则告警按 fired 逐条登记
+func registerAlertHits(alert *models.AlertList, result map[string]interface{}) {
+	var subRules []models.SubRule
+	if alert.AlertRule != nil {
+		subRules = alert.AlertRule.SubRules()
+	}
+	hits := []map[string]interface{}{result}
+	if fired, ok := result["fired"].([]interface{}); ok && len(fired) > 0 {
+		hits = hits[:0]
+		for _, f := range fired {
+			if hit, ok := f.(map[string]interface{}); ok {
+				hits = append(hits, hit)
+			}
+		}
+	} else if fired, ok := result["fired"].([]map[string]interface{}); ok && len(fired) > 0 {
+		hits = fired
+	}
+	for _, hit := range hits {
+		dn, _ := hit["dn"].(string)
+		index := 0
+		if f, ok := toFloat(hit["sub_rule"]); ok {
+			index = int(f)
+		}
+		entry := newOpenAlert(alert.Id, alert.AlertRule, index, subRules)
+		if entry.trigger == gatewayAlertTrigger {
+			entry.code, _ = hit["code"].(string)
+		}
+		trackOpenAlert(dn, entry)
+	}
+}
+
+// startAlert 新告警进入 triggered 状态
+func startAlert(o orm.Ormer, alert *models.AlertList, result map[string]interface{}) {
+	recordAlertTransition(o, alert.Id, "trigger", "", string(constants.AlertTriggered), 0, "")
+	registerAlertHits(alert, result)
+}
+
+// recoverAlert 条件解除，告警进入 recovered 状态
+func recoverAlert(alertId int64, reason string) {
+	untrackAlert(alertId)
+	o := orm.NewOrm()
+	alert := models.AlertList{Id: alertId}
+	if err := o.Read(&alert); err != nil {
+		return
+	}
+	if alert.State != string(constants.AlertTriggered) && alert.State != string(constants.AlertAcknowledged) {
+		return
+	}
+	now := time.Now().UnixMilli()
+	from := alert.State
+	alert.State = string(constants.AlertRecovered)
+	alert.RecoverTime = now
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(alert.AlertResult), &result); err == nil && result["end_at"] == nil {
+		result["end_at"] = now
+		if b, err := json.Marshal(result); err == nil {
+			alert.AlertResult = string(b)
+		}
+	}
+	_ = alert.BeforeUpdate()
+	if _, err := o.Update(&alert, "State", "RecoverTime", "AlertResult", "Modified"); err != nil {
+		logs.Error("告警 %d 恢复失败: %v", alertId, err)
+		return
+	}
+	recordAlertTransition(o, alertId, "recover", from, alert.State, 0, reason)
+	releaseIncident(o, alert.IncidentId)
+	logs.Info("告警 %d 已恢复: %s", alertId, reason)
+}
+
+// observeAlertRecovery 属性上报时检查原始值触发的告警条件是否解除
+func observeAlertRecovery(msg MqttMessage) {
+	ids := matchOpenAlerts(msg.Dn, func(e *openAlert) bool {
+		if e.trigger != string(constants.DeviceDataTrigger) || e.cond == "" {
+			return false
+		}
+		v, ok := msg.Properties[e.code]
+		if !ok {
+			return false
+		}
+		matched, ok := evalDecideCondition(e.cond, v)
+		return ok && !matched
+	})
+	for _, id := range ids {
+		recoverAlert(id, "属性值恢复正常")
+	}
+}
+
+// observeStatusRecovery 设备上下线时恢复相反状态的设备状态告警
+func observeStatusRecovery(dn, status string) {
+	ids := matchOpenAlerts(dn, func(e *openAlert) bool {
+		return e.trigger == string(constants.DeviceStatusTrigger) && e.statusOn != "" && e.statusOn != status
+	})
+	for _, id := range ids {
+		recoverAlert(id, "设备状态变为"+constants.GetDeviceStatusLabel(status))
+	}
+}
+
+// recoverEventAlerts 收到 AlarmRecover 事件时恢复对应告警，ruleId 为0表示网关事件告警
+func recoverEventAlerts(ruleId int64, index int, dn, code string) int {
+	ids := matchOpenAlerts(dn, func(e *openAlert) bool {
+		if ruleId == 0 {
+			return e.trigger == gatewayAlertTrigger && e.code == code
+		}
+		return e.ruleId == ruleId && e.subRule == index
+	})
+	for _, id := range ids {
+		recoverAlert(id, "收到事件解除")
+	}
+	return len(ids)
+}
+
+// evalDecideCondition 计算判断条件，ok 为 false 表示无法计算
+func evalDecideCondition(cond string, v interface{}) (bool, bool) {
+	cond = strings.TrimSpace(cond)
+	upper := strings.ToUpper(cond)
+	if i := strings.Index(upper, "LIKE"); i >= 0 && (i == 0 || strings.HasPrefix(upper, "NOT")) {
+		pattern := strings.Trim(strings.TrimSpace(cond[i+4:]), `"`)
+		matched := likeMatch(pattern, InterfaceToString(v))
+		return matched != strings.HasPrefix(upper, "NOT"), true
+	}
+
+	var op string
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(cond, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return false, false
+	}
+	rhs := strings.TrimSpace(cond[len(op):])
+	if strings.HasPrefix(rhs, `"`) {
+		target := strings.Trim(rhs, `"`)
+		switch op {
+		case "=":
+			return InterfaceToString(v) == target, true
+		case "!=":
+			return InterfaceToString(v) != target, true
+		}
+		return false, false
+	}
+
+	target, err := strconv.ParseFloat(rhs, 64)
+	if err != nil {
+		return false, false
+	}
+	var value float64
+	if b, ok := v.(bool); ok {
+		if b {
+			value = 1
+		}
+	} else if f, ok := toFloat(v); ok {
+		value = f
+	} else {
+		return false, false
+	}
+	switch op {
+	case ">":
+		return value > target, true
+	case ">=":
+		return value >= target, true
+	case "<":
+		return value < target, true
+	case "<=":
+		return value <= target, true
+	case "=":
+		return math.Abs(value-target) < 1e-9, true
+	case "!=":
+		return math.Abs(value-target) >= 1e-9, true
+	}
+	return false, false
+}
+
+// likeMatch SQL LIKE 匹配，% 任意字符，_ 单个字符
+func likeMatch(pattern, s string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(s)
+}
+
+// alertLifecycleLoop 定期处理升级通知、聚合触发的恢复及已恢复告警的自动关闭
+func alertLifecycleLoop() {
+	loadOpenAlerts()
+	ticker := time.NewTicker(alertLifecycleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		recoverStaleWindows(now)
+		escalateAlerts(now)
+		autoCloseAlerts(now)
+	}
+}
+
+// recoverStaleWindows 聚合触发的告警超过两个周期未再命中视为恢复
+func recoverStaleWindows(now time.Time) {
+	var ids []int64
+	openAlerts.Lock()
+	for _, entries := range openAlerts.byDn {
+		for _, e := range entries {
+			if e.window > 0 && now.Sub(e.lastHit) > 2*e.window {
+				ids = append(ids, e.alertId)
+			}
+		}
+	}
+	openAlerts.Unlock()
+	for _, id := range ids {
+		recoverAlert(id, "聚合周期内未再触发")
+	}
+}
+
+// escalateAlerts 触发后超过升级时间仍未确认的告警按下一级策略重新通知
+func escalateAlerts(now time.Time) {
+	o := orm.NewOrm()
+	var alerts []*models.AlertList
+	_, err := o.QueryTable(new(models.AlertList)).
+		Filter("state", string(constants.AlertTriggered)).
+		Filter("AlertRule__Escalation__isnull", false).
+		RelatedSel("AlertRule").All(&alerts)
+	if err != nil {
+		logs.Error("查询待升级告警失败: %v", err)
+		return
+	}
+	service := AlertService{}
+	for _, alert := range alerts {
+		escalations := alert.AlertRule.Escalations()
+		if alert.Escalated >= len(escalations) {
+			continue
+		}
+		level := escalations[alert.Escalated]
+		elapsed := now.UnixMilli() - alert.TriggerTime
+		if elapsed < level.After*1000 {
+			continue
+		}
+
+		n, err := o.QueryTable(new(models.AlertList)).Filter("id", alert.Id).Filter("escalated", alert.Escalated).
+			Update(orm.Params{"escalated": alert.Escalated + 1})
+		if err != nil || n == 0 {
+			continue
+		}
+		alert.Escalated++
+		recordAlertTransition(o, alert.Id, "escalate", alert.State, alert.State, 0, fmt.Sprintf("第%d级升级", alert.Escalated))
+
+		var notify []map[string]interface{}
+		b, _ := json.Marshal(level.Notify)
+		_ = json.Unmarshal(b, &notify)
+		content := fmt.Sprintf("【告警升级】规则：%s，设备：%s，告警等级：%s，触发时间：%s，已%d分钟未确认，请及时处理！",
+			alert.AlertRule.Name, alert.Dn, alert.AlertRule.AlertLevel,
+			time.UnixMilli(alert.TriggerTime).Format("2006-01-02 15:04:05"), elapsed/60000)
+		vars, err := alertNotifyVars(o, alert, models.NotifyKindEscalation)
+		if err != nil {
+			logs.Error("告警 %d 升级通知内容解析失败: %v", alert.Id, err)
+			continue
+		}
+		vars.Text = content
+		go service.sendNotifications(vars, notify, alert)
+	}
+}
+
+// autoCloseAlerts 已恢复的告警超过时限自动关闭
+func autoCloseAlerts(now time.Time) {
+	if alertAutoClose <= 0 {
+		return
+	}
+	var alerts []*models.AlertList
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(models.AlertList)).
+		Filter("state", string(constants.AlertRecovered)).
+		Filter("recover_time__lt", now.UnixMilli()-alertAutoClose*1000).
+		All(&alerts, "Id")
+	if err != nil {
+		logs.Error("查询待关闭告警失败: %v", err)
+		return
+	}
+	for _, alert := range alerts {
+		if err := closeAlert(o, alert.Id, 0, "恢复后自动关闭"); err != nil {
+			logs.Error("告警 %d 自动关闭失败: %v", alert.Id, err)
+		}
+	}
+}
+
+// closeAlert 关闭告警，未处理的告警同时标记为已处理
+func closeAlert(o orm.Ormer, alertId, operator int64, message string) error {
+	alert := models.AlertList{Id: alertId}
+	if err := o.Read(&alert); err != nil {
+		return fmt.Errorf("告警记录不存在")
+	}
+	if alert.State == string(constants.AlertClosed) {
+		return nil
+	}
+	from := alert.State
+	now := time.Now().UnixMilli()
+	alert.State = string(constants.AlertClosed)
+	alert.CloseBy = operator
+	alert.CloseTime = now
+	fields := []string{"State", "CloseBy", "CloseTime", "Modified"}
+	if alert.Status == "" || alert.Status == string(constants.Untreated) {
+		alert.Status = string(constants.Treated)
+		alert.TreatedTime = now
+		fields = append(fields, "Status", "TreatedTime")
+	}
+	if message != "" {
+		alert.Message = message
+		fields = append(fields, "Message")
+	}
+	_ = alert.BeforeUpdate()
+	if _, err := o.Update(&alert, fields...); err != nil {
+		return err
+	}
+	untrackAlert(alertId)
+	recordAlertTransition(o, alertId, "close", from, alert.State, operator, message)
+	releaseIncident(o, alert.IncidentId)
+	return nil
+}
+
+// getTenantAlert 校验告警归属
+func getTenantAlert(o orm.Ormer, tenantId, id int64) (*models.AlertList, error) {
+	alert := &models.AlertList{Id: id}
+	if err := o.Read(alert); err != nil {
+		return nil, fmt.Errorf("告警记录 %d 不存在", id)
+	}
+	// 未归属租户的告警不对任何租户开放
+	if alert.Department == nil || alert.Department.Id != tenantId {
+		return nil, fmt.Errorf("告警记录 %d 无操作权限", id)
+	}
+	return alert, nil
+}
+
+// Acknowledge 确认告警，已确认的告警不再升级
+func (s *AlertLifecycleService) Acknowledge(tenantId, userId int64, ids []int64, message string) error {
+	o := orm.NewOrm()
+	for _, id := range ids {
+		alert, err := getTenantAlert(o, tenantId, id)
+		if err != nil {
+			return err
+		}
+		if alert.State != string(constants.AlertTriggered) && alert.State != "" {
+			continue
+		}
+		from := alert.State
+		alert.State = string(constants.AlertAcknowledged)
+		alert.AckBy = userId
+		alert.AckTime = time.Now().UnixMilli()
+		fields := []string{"State", "AckBy", "AckTime", "Modified"}
+		if message != "" {
+			alert.Message = message
+			fields = append(fields, "Message")
+		}
+		_ = alert.BeforeUpdate()
+		if _, err := o.Update(alert, fields...); err != nil {
+			return fmt.Errorf("确认告警 %d 失败: %v", id, err)
+		}
+		recordAlertTransition(o, id, "ack", from, alert.State, userId, message)
+	}
+	return nil
+}
+
+// Close 手动关闭告警
+func (s *AlertLifecycleService) Close(tenantId, userId int64, ids []int64, message string) error {
+	o := orm.NewOrm()
+	for _, id := range ids {
+		if _, err := getTenantAlert(o, tenantId, id); err != nil {
+			return err
+		}
+		if err := closeAlert(o, id, userId, message); err != nil {
+			return fmt.Errorf("关闭告警 %d 失败: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// History 查询告警状态变更记录
+func (s *AlertLifecycleService) History(tenantId, id int64) ([]*models.AlertTransition, error) {
+	o := orm.NewOrm()
+	if _, err := getTenantAlert(o, tenantId, id); err != nil {
+		return nil, err
+	}
+	var list []*models.AlertTransition
+	_, err := o.QueryTable(new(models.AlertTransition)).Filter("alert_id", id).OrderBy("id").All(&list)
+	return list, err
+}
@@ -2,40 +2,44 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/beego/beego/v2/client/orm"
 	"github.com/beego/beego/v2/core/logs"
 	"iotServer/models"
 	"iotServer/models/constants"
+	"iotServer/models/dtos"
 	"iotServer/utils"
 	"strings"
+	"sync"
 	"time"
 )
 
 type AlertService struct{}
 
+// 条件为all时子规则命中的默认关联窗口
+const defaultAlertCorrelationWindow = 60 * time.Second
+
+// alertHit 子规则的一次命中
+type alertHit struct {
+	result  map[string]interface{}
+	content string
+	at      time.Time
+}
+
+// alertHits 条件为all的规则中各子规则最近一次命中：规则ID -> 子规则序号 -> 命中
+var alertHits = struct {
+	sync.Mutex
+	m map[int64]map[int]alertHit
+}{m: make(map[int64]map[int]alertHit)}
+
 // AddAlert 告警处理方法
 func (s *AlertService) AddAlert(req map[string]interface{}) error {
 	now := time.Now().UnixMilli()
-	alertResult := make(map[string]interface{}) //告警对象
-	var subRuleData []map[string]interface{}    //规则内容
-	var notifyData []map[string]interface{}     //通知内容
-	var content string
+	var notifyData []map[string]interface{} //通知内容
 
-	message := req["messageType"]
 	ruleId := req["rule_id"].(string)
-	deviceId := req["deviceId"].(string)
-	alertResult["dn"] = deviceId
-
-	var ruleName string
-	index := strings.LastIndex(ruleId, "__")
-	if index > 0 {
-		ruleName = ruleId[:index] // 跳过 "__" 本身
-	} else {
-		ruleName = ruleId
-	}
-
-	alertResult["rule_name"] = ruleName
+	ruleName, index := models.ParseAlertEkuiperRuleId(ruleId)
 
 	o := orm.NewOrm()
 	var rule models.AlertRule
@@ -44,6 +48,52 @@ func (s *AlertService) AddAlert(req map[string]interface{}) error {
 		return fmt.Errorf("查询失败: %v", err)
 	}
 
+	var subRuleData []map[string]interface{} //规则内容
+	if err := json.Unmarshal([]byte(rule.SubRule), &subRuleData); err != nil {
+		return fmt.Errorf("查询失败: %v", err)
+	}
+	if index >= len(subRuleData) {
+		return fmt.Errorf("规则 %s 不存在子规则 %d", ruleName, index)
+	}
+	if err := json.Unmarshal([]byte(rule.Notify), &notifyData); err != nil {
+		return fmt.Errorf("查询失败: %v", err)
+	}
+
+	hitResult, hitContent, err := buildAlertHit(rule, index, subRuleData[index], req)
+	if err != nil || hitResult == nil {
+		return err
+	}
+	// 事件解除只恢复已有告警，不产生新告警
+	dn, _ := hitResult["dn"].(string)
+	if req["messageType"] == "EVENT_REPORT" && req["alert_type"] == "AlarmRecover" {
+		recoverEventAlerts(rule.Id, index, dn, "")
+		return nil
+	}
+	touchOpenAlerts(rule.Id, index, dn)
+
+	// 多个子规则且条件为all时，窗口内全部子规则命中才告警
+	hits := []alertHit{{result: hitResult, content: hitContent, at: time.Now()}}
+	if rule.Condition == string(constants.WorkerConditionAll) && len(subRuleData) > 1 {
+		if hits = correlateAlertHit(rule, len(subRuleData), index, hits[0]); hits == nil {
+			logs.Info("告警规则 %s 子规则%d命中，等待其余子规则", ruleName, index+1)
+			return nil
+		}
+	}
+
+	// 相同规则、设备、属性的告警未恢复时只累加触发次数，不再新增记录和通知
+	fingerprint := alertFingerprint(rule.Id, hitResult, hitResults(hits))
+	value := InterfaceToString(hitResult["value"])
+	cond := ""
+	if option, ok := subRuleData[index]["option"].(map[string]interface{}); ok {
+		cond, _ = option["decide_condition"].(string)
+	}
+	if folded, err := foldAlert(o, fingerprint, cond, value); err != nil {
+		return err
+	} else if folded {
+		logs.Info("告警规则 %s 设备 %s 未恢复，累加触发次数", ruleName, dn)
+		return nil
+	}
+
 	// 任意告警若未达到沉默时间跳过
 	if constants.ReturnSilenceTimestamp(rule.SilenceTime) > 0 {
 		// 查询该规则最新的告警记录
@@ -54,9 +104,9 @@ func (s *AlertService) AddAlert(req map[string]interface{}) error {
 			Limit(1).
 			One(&latestAlert)
 
-		if err != nil {
+		if err != nil && err != orm.ErrNoRows {
 			return fmt.Errorf("查询最新告警记录失败: %v", err)
-		} else {
+		} else if err == nil {
 			// 如果找到了记录且仍在静默期内，则跳过
 			if now-latestAlert.TriggerTime < constants.ReturnSilenceTimestamp(rule.SilenceTime) {
 				logs.Info("告警规则 %s 处于静默期，跳过本次告警", ruleName)
@@ -65,28 +115,129 @@ func (s *AlertService) AddAlert(req map[string]interface{}) error {
 		}
 	}
 
-	if err := json.Unmarshal([]byte(rule.SubRule), &subRuleData); err != nil {
-		return fmt.Errorf("查询失败: %v", err)
+	// 告警内容沿用触发本次告警的子规则字段，fired 中列出全部命中的子规则
+	alertResult := make(map[string]interface{}, len(hitResult)+2)
+	for k, v := range hitResult {
+		alertResult[k] = v
 	}
-	if err := json.Unmarshal([]byte(rule.Notify), &notifyData); err != nil {
+	fired := hitResults(hits)
+	contents := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		contents = append(contents, hit.content)
+	}
+	alertResult["condition"] = rule.Condition
+	alertResult["fired"] = fired
+	content := strings.Join(contents, "\n")
+
+	alertMarshal, err := json.Marshal(alertResult)
+	if err != nil {
 		return fmt.Errorf("查询失败: %v", err)
 	}
+	// 构建告警记录
+	alert := &models.AlertList{
+		AlertRule:   &rule,
+		TriggerTime: time.Now().UnixMilli(),
+		IsSend:      false,
+		Status:      string(constants.Untreated),
+		State:       string(constants.AlertTriggered),
+		Dn:          dn,
+		AlertResult: string(alertMarshal),
+		Department:  &models.Department{Id: rule.Department.Id},
+		Fingerprint: fingerprint,
+		Occurrences: 1,
+		PeakValue:   value,
+	}
+	alert.LastSeen = alert.TriggerTime
+
+	// 保存到数据库
+	if err = alert.BeforeInsert(); err != nil {
+		return fmt.Errorf("插入失败: %v", err)
+	}
+	if _, err = o.Insert(alert); err != nil {
+		return fmt.Errorf("保存告警记录失败: %v", err)
+	}
+	startAlert(o, alert, alertResult)
+
+	// 归入已有事件的告警不再重复通知
+	groupValue, _ := incidentGroupValue(o, rule.GroupBy, dn)
+	if !attachIncident(o, alert, rule.GroupBy, groupValue, rule.Name, rule.AlertLevel, alert.Department) {
+		logs.Info("告警 %d 已归入事件 %d，跳过通知", alert.Id, alert.IncidentId)
+		return nil
+	}
+
+	// 异步发送通知
+	vars := newNotifyVars(o, &rule, notifyKind(req["messageType"]), alertResult, content)
+	go s.sendNotifications(vars, notifyData, alert)
+
+	return nil
+}
+
+// hitResults 各子规则命中的告警内容
+func hitResults(hits []alertHit) []map[string]interface{} {
+	fired := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		fired = append(fired, hit.result)
+	}
+	return fired
+}
+
+// correlateAlertHit 记录子规则命中，关联窗口内全部子规则均已命中时返回各子规则的命中并清空
+func correlateAlertHit(rule models.AlertRule, total, index int, hit alertHit) []alertHit {
+	window := defaultAlertCorrelationWindow
+	if rule.Window > 0 {
+		window = time.Duration(rule.Window) * time.Second
+	}
+
+	alertHits.Lock()
+	defer alertHits.Unlock()
+	ruleHits, ok := alertHits.m[rule.Id]
+	if !ok {
+		ruleHits = make(map[int]alertHit, total)
+		alertHits.m[rule.Id] = ruleHits
+	}
+	ruleHits[index] = hit
+	for i, h := range ruleHits {
+		if hit.at.Sub(h.at) > window || i >= total {
+			delete(ruleHits, i)
+		}
+	}
+	if len(ruleHits) < total {
+		return nil
+	}
+	hits := make([]alertHit, 0, total)
+	for i := 0; i < total; i++ {
+		hits = append(hits, ruleHits[i])
+	}
+	delete(alertHits.m, rule.Id)
+	return hits
+}
+
+// buildAlertHit 按子规则配置整理回调数据，返回告警内容及通知文本
+func buildAlertHit(rule models.AlertRule, index int, subRule map[string]interface{}, req map[string]interface{}) (map[string]interface{}, string, error) {
+	alertResult := make(map[string]interface{}) //告警对象
+	var content string
+
+	message := req["messageType"]
+	deviceId, _ := req["deviceId"].(string)
+	alertResult["dn"] = deviceId
+	alertResult["rule_name"] = rule.Name
+	alertResult["sub_rule"] = index
 	alertResult["alert_level"] = rule.AlertLevel
-	alertResult["trigger"] = subRuleData[0]["trigger"]
+	alertResult["trigger"] = subRule["trigger"]
 
 	//处理不同告警类型的返回格式
 	if message == "PROPERTY_REPORT" {
 		value := InterfaceToString(req["alert_value"])
 
 		// 正确地提取嵌套的 option.code
-		if option, ok := subRuleData[0]["option"].(map[string]interface{}); ok {
+		if option, ok := subRule["option"].(map[string]interface{}); ok {
 			code, codeOk := option["code"].(string)
 			name, nameOk := option["name"].(string)
 			cycle, cycleOk := option["value_cycle"].(string)
 			typeR, typeROk := option["value_type"].(string)
 
 			if !codeOk || !nameOk || !cycleOk || !typeROk {
-				return fmt.Errorf("无法提取必要字段: code存在=%t, name存在=%t, cycle存在=%t, type存在=%t", codeOk, nameOk, cycleOk, typeROk)
+				return nil, "", fmt.Errorf("无法提取必要字段: code存在=%t, name存在=%t, cycle存在=%t, type存在=%t", codeOk, nameOk, cycleOk, typeROk)
 			}
 			alertResult["code"] = code
 			alertResult["name"] = name
@@ -109,10 +260,10 @@ func (s *AlertService) AddAlert(req map[string]interface{}) error {
 		alertResult["value"] = value
 
 	} else if message == "DEVICE_STATUS" {
-		if option, ok := subRuleData[0]["option"].(map[string]interface{}); ok {
+		if option, ok := subRule["option"].(map[string]interface{}); ok {
 			status, statusOk := option["status"].(string)
 			if !statusOk {
-				return fmt.Errorf("无法提取必要字段: code存在=%t", statusOk)
+				return nil, "", fmt.Errorf("无法提取必要字段: code存在=%t", statusOk)
 			}
 			alertResult["value"] = constants.GetDeviceStatusLabel(status)
 			reportTime := req["report_time"]
@@ -135,39 +286,28 @@ func (s *AlertService) AddAlert(req map[string]interface{}) error {
 			alertResult["dn"], alertResult["alert_level"], alertResult["trigger"], alertResult["event"], utils.FormatTimestamp(alertResult["start_at"]), alertResult["type"])
 
 	} else {
-		return nil
-	}
-
-	alertMarshal, err := json.Marshal(alertResult)
-	if err != nil {
-		return fmt.Errorf("查询失败: %v", err)
-	}
-	// 构建告警记录
-	alert := &models.AlertList{
-		AlertRule:   &rule,
-		TriggerTime: time.Now().UnixMilli(),
-		IsSend:      false,
-		Status:      string(constants.Untreated),
-		AlertResult: string(alertMarshal),
-		Department:  &models.Department{Id: rule.Department.Id},
+		return nil, "", nil
 	}
+	return alertResult, content, nil
+}
 
-	// 保存到数据库
-	if err = alert.BeforeInsert(); err != nil {
-		return fmt.Errorf("插入失败: %v", err)
+// notifyInEffect 按租户时区判断是否处于通知生效时间段，引用日历时还需为指定类型的日期
+func notifyInEffect(o orm.Ormer, tenantId int64, notifyConfig map[string]interface{}, now time.Time) (bool, string) {
+	local := now.In(tenantLocation(o, tenantId))
+	currentTime := local.Format("15:04:05") // 格式化为 HH:MM:SS
+	if !utils.IsInEffectiveTime(notifyConfig, currentTime) {
+		return false, fmt.Sprintf("当前时间 %s 不在通知有效时间内", currentTime)
 	}
-	if _, err = o.Insert(alert); err != nil {
-		return fmt.Errorf("保存告警记录失败: %v", err)
+	calendarId, _ := toFloat(notifyConfig["calendar_id"])
+	if calendarId <= 0 {
+		return true, ""
 	}
-
-	// 异步发送通知
-	go s.sendNotifications(content, notifyData, alert)
-
-	return nil
+	dayType, _ := notifyConfig["day_type"].(string)
+	return checkCalendar(o, tenantId, int64(calendarId), dayType, local)
 }
 
-// 增强sendNotifications方法
-func (s *AlertService) sendNotifications(content string, notify []map[string]interface{}, alert *models.AlertList) {
+// sendNotifications 按通知配置逐个投递，每个通知方式记录一条投递记录，失败的由 notifyRetryLoop 重试
+func (s *AlertService) sendNotifications(vars *notifyVars, notify []map[string]interface{}, alert *models.AlertList) {
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -176,117 +316,159 @@ func (s *AlertService) sendNotifications(content string, notify []map[string]int
 	}()
 	// 获取当前时间
 	now := time.Now()
-	currentTime := now.Format("15:04:05") // 格式化为 HH:MM:SS
-	// 标记是否至少有一个通知发送成功
-	successSent := false
+	o := orm.NewOrm()
+	var tenantId, ruleId int64
+	if alert.Department != nil {
+		tenantId = alert.Department.Id
+	}
+	if alert.AlertRule != nil {
+		ruleId = alert.AlertRule.Id
+	}
 
 	// 遍历所有通知配置
 	for _, notifyConfig := range notify {
 		// 检查是否在有效时间内
-		if utils.IsInEffectiveTime(notifyConfig, currentTime) {
-			// 根据通知类型发送通知
-			if name, ok := notifyConfig["name"].(string); ok {
-				sendSuccess := false
-				switch name {
-				case "企业微信机器人":
-					sendSuccess = s.sendWeComNotification(content, notifyConfig)
-				case "钉钉机器人":
-					s.sendDingTalkNotification(content, notifyConfig)
-				case "sms":
-					s.sendSmsNotification(content, notifyConfig)
-				case "email":
-					s.sendSmsNotification(content, notifyConfig)
-				case "API接口":
-					sendSuccess = s.sendApiNotification(content, notifyConfig)
-				default:
-					logs.Warn("未知的通知方式: %s", name)
-				}
-				if sendSuccess {
-					successSent = true
-				}
-			}
-		} else {
-			logs.Info("当前时间 %s 不在通知有效时间内，跳过发送", currentTime)
+		if ok, reason := notifyInEffect(o, tenantId, notifyConfig, now); !ok {
+			logs.Info("%s，跳过发送", reason)
+			continue
 		}
+		// 配置了接收人时按触发时刻解析用户、角色、部门及值班人的联系方式
+		if recipients := notifyRecipients(notifyConfig); len(recipients) > 0 {
+			notifyConfig = applyRecipients(notifyConfig, resolveRecipients(o, tenantId, recipients, now))
+		}
+		name, _ := notifyConfig["name"].(string)
+		msg := renderNotify(o, tenantId, ruleId, name, vars)
+		delivery, err := newDelivery(o, alert, msg, notifyConfig)
+		if err != nil {
+			logs.Error("记录通知投递失败: %v", err)
+			continue
+		}
+		s.attemptDelivery(o, delivery, notifyConfig)
 	}
+}
 
-	// 更新数据库中的 is_send 字段
-	if successSent {
-		o := orm.NewOrm()
-		alert.IsSend = true
-		if _, err := o.Update(alert, "IsSend"); err != nil {
-			logs.Error("更新告警记录的IsSend字段失败: %v", err)
-		}
+// dispatchNotify 按通知方式发送，返回接收方响应
+func (s *AlertService) dispatchNotify(msg notifyMessage, notifyConfig map[string]interface{}, alert *models.AlertList) (string, error) {
+	name, _ := notifyConfig["name"].(string)
+	switch constants.AlertWay(name) {
+	case constants.QYweixin:
+		return s.sendWeComNotification(msg, notifyConfig)
+	case constants.DingDing:
+		return s.sendDingTalkNotification(msg, notifyConfig)
+	case constants.FeiShu:
+		return s.sendFeishuNotification(msg, notifyConfig)
+	case constants.SMS:
+		return s.sendSmsNotification(msg.Content, notifyConfig)
+	case constants.PHONE:
+		return s.sendPhoneNotification(msg.Content, notifyConfig)
+	case constants.EMAIL:
+		return s.sendEmailNotification(msg, notifyConfig, alert)
+	case constants.WEBAPI:
+		return s.sendApiNotification(msg.Content, notifyConfig)
+	default:
+		return "", fmt.Errorf("%w: %s", errNotifyUnsupported, name)
 	}
 }
 
+// notifyOption 通知配置中的 option
+func notifyOption(notifyConfig map[string]interface{}) map[string]interface{} {
+	option, _ := notifyConfig["option"].(map[string]interface{})
+	return option
+}
+
 // sendWeComNotification 发送企业微信通知
-func (s *AlertService) sendWeComNotification(content string, notifyConfig map[string]interface{}) bool {
-	if option, ok := notifyConfig["option"].(map[string]interface{}); ok {
-		if webhook, ok := option["webhook"].(string); ok && webhook != "" {
-			// 这里实现企业微信机器人通知逻辑
-			logs.Info("发送企业微信通知: %s 到 webhook: %s", content, webhook)
-			// 构造企业微信机器人消息格式
-			message := map[string]interface{}{
-				"msgtype": "text",
-				"text": map[string]interface{}{
-					"content": content,
-				},
-			}
-			if err := utils.SendHttpPost(webhook, message); err != nil {
-				return false
-			}
-		}
+func (s *AlertService) sendWeComNotification(msg notifyMessage, notifyConfig map[string]interface{}) (string, error) {
+	webhook, _ := notifyOption(notifyConfig)["webhook"].(string)
+	if webhook == "" {
+		return "", errors.New("webhook 为空")
+	}
+	logs.Info("发送企业微信通知: %s 到 webhook: %s", msg.Content, webhook)
+	body, err := utils.SendHttpPostBody(webhook, withMentions(constants.QYweixin, robotMessage(constants.QYweixin, msg), notifyOption(notifyConfig)))
+	if err != nil {
+		return body, err
 	}
-	return true
+	return body, checkErrcode(body)
 }
 
 // sendApiNotification 发送API通知
-func (s *AlertService) sendApiNotification(content string, notifyConfig map[string]interface{}) bool {
-	if option, ok := notifyConfig["option"].(map[string]interface{}); ok {
-		if webhook, ok := option["webhook"].(string); ok && webhook != "" {
-			// 这里实现API通知逻辑
-			logs.Info("发送API通知: %s 到 URL: %s", content, webhook)
-			// 实现具体的API调用逻辑
-			if err := utils.SendHttpPost(webhook, content); err != nil {
-				return false
-			}
-		}
+func (s *AlertService) sendApiNotification(content string, notifyConfig map[string]interface{}) (string, error) {
+	webhook, _ := notifyOption(notifyConfig)["webhook"].(string)
+	if webhook == "" {
+		return "", errors.New("webhook 为空")
 	}
-	return true
+	logs.Info("发送API通知: %s 到 URL: %s", content, webhook)
+	return utils.SendHttpPostBody(webhook, content)
 }
 
-// sendDingTalkNotification 发送钉钉通知
-func (s *AlertService) sendDingTalkNotification(content string, notifyConfig map[string]interface{}) {
-	if option, ok := notifyConfig["option"].(map[string]interface{}); ok {
-		if webhook, ok := option["webhook"].(string); ok && webhook != "" {
-			// 这里实现钉钉机器人通知逻辑
-			logs.Info("发送钉钉通知: %s 到 webhook: %s", content, webhook)
-			// TODO: 实现具体的钉钉发送逻辑
-		}
+// sendFeishuNotification 发送飞书机器人通知，option.secret 为机器人签名校验密钥
+func (s *AlertService) sendFeishuNotification(msg notifyMessage, notifyConfig map[string]interface{}) (string, error) {
+	option := notifyOption(notifyConfig)
+	webhook, _ := option["webhook"].(string)
+	if webhook == "" {
+		return "", errors.New("webhook 为空")
 	}
+	secret, _ := option["secret"].(string)
+	logs.Info("发送飞书通知: %s 到 webhook: %s", msg.Content, webhook)
+	return sendFeishu(webhook, secret, withMentions(constants.FeiShu, feishuMessage(msg), option))
 }
 
-// sendSmsNotification 发送短信通知
-func (s *AlertService) sendSmsNotification(content string, notifyConfig map[string]interface{}) {
-	if option, ok := notifyConfig["option"].(map[string]interface{}); ok {
-		if phone, ok := option["phone"].(string); ok && phone != "" {
-			// 这里实现短信通知逻辑
-			logs.Info("发送短信通知: %s 到手机号: %s", content, phone)
-			// TODO: 实现具体的短信发送逻辑
+// sendEmailNotification 发送邮件通知，option.email 为收件人，多个以逗号分隔
+func (s *AlertService) sendEmailNotification(msg notifyMessage, notifyConfig map[string]interface{}, alert *models.AlertList) (string, error) {
+	option := notifyOption(notifyConfig)
+	email, _ := option["email"].(string)
+	to := dtos.SplitNotifyTargets(email)
+	if len(to) == 0 {
+		return "", errors.New("收件人为空")
+	}
+	subject, _ := option["subject"].(string)
+	if subject == "" {
+		subject = msg.Title
+	}
+	if subject == "" {
+		subject = "【告警通知】"
+		if alert != nil && alert.AlertRule != nil {
+			subject += alert.AlertRule.Name
 		}
 	}
+	logs.Info("发送邮件通知: %s 到: %v", msg.Content, to)
+	if err := sendMail(loadSmtpConfig(), to, subject, alertMailBody(msg.Content)); err != nil {
+		return "", err
+	}
+	return "250 OK", nil
 }
 
-// sendPhoneNotification 发送电话通知
-func (s *AlertService) sendPhoneNotification(content string, notifyConfig map[string]interface{}) {
-	if option, ok := notifyConfig["option"].(map[string]interface{}); ok {
-		if phone, ok := option["phone"].(string); ok && phone != "" {
-			// 这里实现电话通知逻辑
-			logs.Info("发送电话通知: %s 到手机号: %s", content, phone)
-			// TODO: 实现具体的电话拨打逻辑
-		}
+// sendDingTalkNotification 发送钉钉通知，option.secret 为机器人加签密钥
+func (s *AlertService) sendDingTalkNotification(msg notifyMessage, notifyConfig map[string]interface{}) (string, error) {
+	option := notifyOption(notifyConfig)
+	webhook, _ := option["webhook"].(string)
+	if webhook == "" {
+		return "", errors.New("webhook 为空")
+	}
+	logs.Info("发送钉钉通知: %s 到 webhook: %s", msg.Content, webhook)
+	if secret, _ := option["secret"].(string); secret != "" {
+		webhook = dingTalkSignedUrl(webhook, secret, time.Now().UnixMilli())
 	}
+	body, err := utils.SendHttpPostBody(webhook, withMentions(constants.DingDing, robotMessage(constants.DingDing, msg), option))
+	if err != nil {
+		return body, err
+	}
+	return body, checkErrcode(body)
+}
+
+// sendSmsNotification 发送短信通知
+func (s *AlertService) sendSmsNotification(content string, notifyConfig map[string]interface{}) (string, error) {
+	phone, _ := notifyOption(notifyConfig)["phone"].(string)
+	logs.Info("发送短信通知: %s 到手机号: %s", content, phone)
+	// TODO: 接入短信服务商
+	return "", fmt.Errorf("%w: 短信", errNotifyUnsupported)
+}
+
+// sendPhoneNotification 发送电话通知
+func (s *AlertService) sendPhoneNotification(content string, notifyConfig map[string]interface{}) (string, error) {
+	phone, _ := notifyOption(notifyConfig)["phone"].(string)
+	logs.Info("发送电话通知: %s 到手机号: %s", content, phone)
+	// TODO: 接入语音服务商
+	return "", fmt.Errorf("%w: 语音", errNotifyUnsupported)
 }
 
 // 新增方法：批量处理告警状态
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	batchChannel        = "批量控制"
+	batchMaxConcurrency = 50
+)
+
+var runningBatches = sync.Map{} // 任务ID -> *batchRun
+
+// batchRun 执行中的批量控制任务
+type batchRun struct {
+	batch    *models.BatchCommand
+	canceled int32
+	success  int32
+	fail     int32
+}
+
+// BatchDeviceResult 单设备的下发结果
+type BatchDeviceResult struct {
+	Dn       string `json:"dn"`
+	Seq      string `json:"seq"`
+	Status   string `json:"status"` // WriteLog 状态，未下发为 SKIPPED，尚未执行为 PENDING
+	Attempts int    `json:"attempts"`
+	RespTime int64  `json:"respTime"`
+}
+
+// BatchReport 批量控制报告
+type BatchReport struct {
+	Batch   *models.BatchCommand `json:"batch"`
+	Devices []BatchDeviceResult  `json:"devices"`
+}
+
+// BatchService 批量控制
+type BatchService struct{}
+
+// positionSubtreeIds 获取位置及其所有子位置ID
+func positionSubtreeIds(o orm.Ormer, rootId int64) ([]int64, error) {
+	ids := []int64{rootId}
+	parents := []int64{rootId}
+	for len(parents) > 0 {
+		var children []*models.Position
+		if _, err := o.QueryTable(new(models.Position)).Filter("parent_position__in", parents).All(&children, "Id"); err != nil {
+			return nil, err
+		}
+		parents = parents[:0]
+		for _, child := range children {
+			ids = append(ids, child.Id)
+			parents = append(parents, child.Id)
+		}
+	}
+	return ids, nil
+}
+
+// resolveBatchDevices 按目标类型解析租户下的设备名称
+func resolveBatchDevices(tenantId int64, req dtos.BatchCommandRequest) ([]string, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.Device)).Filter("tenant_id", tenantId)
+	switch req.Target {
+	case models.BatchTargetGroup:
+		group := models.Group{Id: req.TargetId}
+		if err := o.Read(&group); err != nil {
+			return nil, fmt.Errorf("分组不存在")
+		}
+		qs = qs.Filter("group_id", req.TargetId)
+	case models.BatchTargetPosition:
+		position := models.Position{Id: req.TargetId}
+		if err := o.Read(&position); err != nil {
+			return nil, fmt.Errorf("位置不存在")
+		}
+		ids, err := positionSubtreeIds(o, req.TargetId)
+		if err != nil {
+			return nil, err
+		}
+		qs = qs.Filter("position_id__in", ids)
+	case models.BatchTargetDepartment:
+		department := models.Department{Id: req.TargetId}
+		if err := o.Read(&department); err != nil || (department.TenantId != tenantId && department.Id != tenantId) {
+			return nil, fmt.Errorf("部门不存在或无操作权限")
+		}
+		departmentService := DepartmentService{}
+		ids, err := departmentService.getDepartmentTreeIDs(req.TargetId)
+		if err != nil {
+			return nil, err
+		}
+		qs = qs.Filter("department_id__in", ids)
+	case models.BatchTargetFilter:
+		if req.ProductId == 0 && req.Keyword == "" {
+			return nil, fmt.Errorf("筛选条件不能为空")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的目标类型: %s", req.Target)
+	}
+	if req.ProductId != 0 {
+		qs = qs.Filter("product_id", req.ProductId)
+	}
+	if req.Keyword != "" {
+		qs = qs.Filter("name__icontains", req.Keyword)
+	}
+
+	var devices []*models.Device
+	if _, err := qs.OrderBy("id").All(&devices, "Name"); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(devices))
+	for _, d := range devices {
+		names = append(names, d.Name)
+	}
+	return names, nil
+}
+
+// Create 创建批量控制任务并在后台执行
+func (s *BatchService) Create(tenantId, userId int64, req dtos.BatchCommandRequest) (*models.BatchCommand, error) {
+	if req.Tag == "" {
+		return nil, fmt.Errorf("写入点不能为空")
+	}
+	if Processor == nil {
+		return nil, fmt.Errorf("MQTT未初始化")
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 1
+	} else if req.Concurrency > batchMaxConcurrency {
+		req.Concurrency = batchMaxConcurrency
+	}
+	if req.Canary < 0 || req.Canary > 100 || req.MaxFailRate < 0 || req.MaxFailRate > 100 {
+		return nil, fmt.Errorf("灰度比例和失败率阈值应在0-100之间")
+	}
+
+	names, err := resolveBatchDevices(tenantId, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("没有匹配的设备")
+	}
+	devices, _ := json.Marshal(names)
+	batch := &models.BatchCommand{
+		Name:        req.Name,
+		Target:      req.Target,
+		TargetId:    req.TargetId,
+		ProductId:   req.ProductId,
+		Keyword:     req.Keyword,
+		Tag:         req.Tag,
+		Val:         req.Val,
+		Concurrency: req.Concurrency,
+		Canary:      req.Canary,
+		MaxFailRate: req.MaxFailRate,
+		Devices:     string(devices),
+		Total:       len(names),
+		Status:      models.BatchRunning,
+		UserId:      userId,
+		Tenant:      tenantId,
+	}
+	_ = batch.BeforeInsert()
+	if _, err := orm.NewOrm().Insert(batch); err != nil {
+		return nil, fmt.Errorf("保存批量任务失败: %v", err)
+	}
+
+	run := &batchRun{batch: batch}
+	runningBatches.Store(batch.Id, run)
+	go run.execute(names)
+	return batch, nil
+}
+
+// execute 先下发灰度批次并评估失败率，再按并发数下发剩余设备
+func (r *batchRun) execute(names []string) {
+	defer runningBatches.Delete(r.batch.Id)
+
+	canary := 0
+	if r.batch.Canary > 0 {
+		canary = (len(names)*r.batch.Canary + 99) / 100
+	}
+	status, reason := models.BatchCompleted, ""
+	if canary > 0 && canary < len(names) {
+		if status, reason = r.stage(names[:canary]); status == models.BatchRunning {
+			log.Printf("批量控制 %d 灰度完成: 成功%d 失败%d", r.batch.Id, r.success, r.fail)
+			status, reason = r.stage(names[canary:])
+		}
+	} else {
+		status, reason = r.stage(names)
+	}
+	if status == models.BatchRunning {
+		status = models.BatchCompleted
+	}
+	r.finish(status, reason)
+}
+
+// stage 并发下发一批设备，全部结束后返回；失败率超过阈值或被取消时停止领取新设备
+func (r *batchRun) stage(names []string) (string, string) {
+	var next int32 = -1
+	var stop atomic.Value
+	var wg sync.WaitGroup
+	for i := 0; i < r.batch.Concurrency && i < len(names); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if stop.Load() != nil || atomic.LoadInt32(&r.canceled) == 1 {
+					return
+				}
+				idx := int(atomic.AddInt32(&next, 1))
+				if idx >= len(names) {
+					return
+				}
+				r.send(names[idx])
+				if r.exceeded() {
+					stop.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&r.canceled) == 1 {
+		return models.BatchCanceled, "任务已取消"
+	}
+	if r.exceeded() {
+		return models.BatchAborted, fmt.Sprintf("失败率超过阈值%d%%，已终止", r.batch.MaxFailRate)
+	}
+	return models.BatchRunning, ""
+}
+
+// send 下发单台设备并等待命令进入终态
+func (r *batchRun) send(dn string) {
+	o := orm.NewOrm()
+	seq, err := Processor.Deal(dn, r.batch.Tag, r.batch.Val, batchChannel, r.batch.UserId, r.batch.Tenant)
+	_, _ = o.QueryTable(new(models.WriteLog)).Filter("seq", seq).Update(orm.Params{"batch_id": r.batch.Id})
+	status := models.WriteLogFail
+	if err == nil {
+		if writeLog, err := WaitCommand(seq, time.Duration(commandExpire)*time.Second); err == nil {
+			status = writeLog.Status
+		}
+	}
+
+	field := "fail"
+	if status == models.WriteLogSuccess {
+		atomic.AddInt32(&r.success, 1)
+		field = "success"
+	} else {
+		atomic.AddInt32(&r.fail, 1)
+	}
+	_, _ = o.QueryTable(new(models.BatchCommand)).Filter("id", r.batch.Id).Update(orm.Params{
+		field: orm.ColValue(orm.ColAdd, 1),
+	})
+}
+
+// exceeded 已结束设备的失败率是否超过阈值
+func (r *batchRun) exceeded() bool {
+	if r.batch.MaxFailRate <= 0 {
+		return false
+	}
+	success, fail := atomic.LoadInt32(&r.success), atomic.LoadInt32(&r.fail)
+	done := success + fail
+	return done > 0 && int(fail)*100 > int(done)*r.batch.MaxFailRate
+}
+
+func (r *batchRun) finish(status, reason string) {
+	_, err := orm.NewOrm().QueryTable(new(models.BatchCommand)).Filter("id", r.batch.Id).Update(orm.Params{
+		"status":   status,
+		"error":    reason,
+		"finished": time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("批量控制 %d 状态更新失败: %v", r.batch.Id, err)
+	}
+	log.Printf("批量控制 %d 结束: %s 成功%d 失败%d 共%d", r.batch.Id, status, r.success, r.fail, r.batch.Total)
+}
+
+// interruptBatches 服务启动时将上次未执行完的任务置为中断
+func interruptBatches() {
+	_, err := orm.NewOrm().QueryTable(new(models.BatchCommand)).Filter("status", models.BatchRunning).Update(orm.Params{
+		"status":   models.BatchInterrupted,
+		"error":    "服务重启，任务中断",
+		"finished": time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("更新中断的批量任务失败: %v", err)
+	}
+}
+
+func (s *BatchService) get(tenantId, id int64) (*models.BatchCommand, error) {
+	batch := &models.BatchCommand{Id: id}
+	if err := orm.NewOrm().Read(batch); err != nil || batch.Tenant != tenantId {
+		return nil, fmt.Errorf("批量任务不存在或无操作权限")
+	}
+	return batch, nil
+}
+
+// Cancel 取消执行中的任务，已下发的设备不受影响
+func (s *BatchService) Cancel(tenantId, id int64) error {
+	if _, err := s.get(tenantId, id); err != nil {
+		return err
+	}
+	v, ok := runningBatches.Load(id)
+	if !ok {
+		return fmt.Errorf("任务未在执行")
+	}
+	atomic.StoreInt32(&v.(*batchRun).canceled, 1)
+	return nil
+}
+
+// List 分页查询批量任务
+func (s *BatchService) List(tenantId int64, status string, page, size int) (*utils.PageResult, error) {
+	var list []*models.BatchCommand
+	qs := orm.NewOrm().QueryTable(new(models.BatchCommand)).Filter("tenant_id", tenantId)
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	qs = qs.OrderBy("-id")
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// Report 生成任务的逐设备结果报告
+func (s *BatchService) Report(tenantId, id int64) (*BatchReport, error) {
+	batch, err := s.get(tenantId, id)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	_ = json.Unmarshal([]byte(batch.Devices), &names)
+
+	var logs []*models.WriteLog
+	if _, err := orm.NewOrm().QueryTable(new(models.WriteLog)).Filter("batch_id", id).All(&logs); err != nil {
+		return nil, err
+	}
+	byDn := make(map[string]*models.WriteLog, len(logs))
+	for _, l := range logs {
+		byDn[l.Dn] = l
+	}
+
+	unsent := "SKIPPED"
+	if batch.Status == models.BatchRunning {
+		unsent = "PENDING"
+	}
+	report := &BatchReport{Batch: batch, Devices: make([]BatchDeviceResult, 0, len(names))}
+	for _, dn := range names {
+		result := BatchDeviceResult{Dn: dn, Status: unsent}
+		if l, ok := byDn[dn]; ok {
+			result.Seq = l.Seq
+			result.Status = l.Status
+			result.Attempts = l.Attempts
+			result.RespTime = l.RespTime
+		}
+		report.Devices = append(report.Devices, result)
+	}
+	return report, nil
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/xuri/excelize/v2"
+	"iotServer/models"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarService 工作日历与租户时区
+type CalendarService struct{}
+
+// tenantTimeZone 租户配置的时区，未配置为空
+func tenantTimeZone(o orm.Ormer, tenantId int64) string {
+	var setting models.TenantTimeZone
+	if err := o.QueryTable(new(models.TenantTimeZone)).Filter("tenant_id", tenantId).One(&setting); err != nil {
+		return ""
+	}
+	return setting.TimeZone
+}
+
+// tenantLocation 租户时区，未配置或非法时使用服务器时区
+func tenantLocation(o orm.Ormer, tenantId int64) *time.Location {
+	tz := tenantTimeZone(o, tenantId)
+	if tz == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// parseCalendarDate 解析 Excel 或接口中的日期
+func parseCalendarDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "2006/1/2", "2006-1-2", "20060102", "01-02-06"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	// 未设置日期格式的单元格为 Excel 序列号
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		return excelize.ExcelDateToTime(serial, false)
+	}
+	return time.Time{}, fmt.Errorf("日期格式错误: %s", value)
+}
+
+// parseCalendarDayType 日期类型，兼容 Excel 中的中文写法
+func parseCalendarDayType(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case models.CalendarHoliday, "节假日", "假日", "休息", "休息日":
+		return models.CalendarHoliday, nil
+	case models.CalendarWorkday, "工作日", "上班", "调休", "调休上班", "补班":
+		return models.CalendarWorkday, nil
+	}
+	return "", fmt.Errorf("日期类型错误: %s，应为 holiday/workday", value)
+}
+
+// calendarCycle 解析轮班周期
+func calendarCycle(cycle string) ([]bool, error) {
+	var days []bool
+	for _, item := range strings.Split(cycle, ",") {
+		switch strings.TrimSpace(item) {
+		case "1":
+			days = append(days, true)
+		case "0":
+			days = append(days, false)
+		default:
+			return nil, fmt.Errorf("轮班周期格式错误: %s", item)
+		}
+	}
+	return days, nil
+}
+
+// calendarDayType 日期在日历中的类型，单独配置的日期优先，其余按排班方式计算
+func calendarDayType(o orm.Ormer, calendar *models.WorkCalendar, date time.Time) (string, string) {
+	var day models.CalendarDay
+	if err := o.QueryTable(new(models.CalendarDay)).Filter("Calendar__Id", calendar.Id).Filter("date", date.Format("2006-01-02")).One(&day); err == nil {
+		return day.Type, day.Name
+	}
+	if calendar.Mode == models.CalendarModeCycle {
+		days, err := calendarCycle(calendar.Cycle)
+		start, perr := time.Parse("2006-01-02", calendar.CycleStart)
+		if err != nil || perr != nil || len(days) == 0 {
+			return models.CalendarHoliday, "轮班周期配置错误"
+		}
+		d := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+		offset := int(d.Sub(start).Hours()/24) % len(days)
+		if offset < 0 {
+			offset += len(days)
+		}
+		if days[offset] {
+			return models.CalendarWorkday, ""
+		}
+		return models.CalendarHoliday, ""
+	}
+	weekdays, err := parseSceneWeekdays(calendar.Workdays)
+	if err != nil {
+		return models.CalendarHoliday, "上班星期配置错误"
+	}
+	if weekdays == nil || weekdays[date.Weekday()] {
+		return models.CalendarWorkday, ""
+	}
+	return models.CalendarHoliday, ""
+}
+
+// checkCalendar 判断 local 所在日期是否为日历中的 dayType(默认 workday)，返回不满足的原因
+func checkCalendar(o orm.Ormer, tenantId, calendarId int64, dayType string, local time.Time) (bool, string) {
+	if dayType == "" {
+		dayType = models.CalendarWorkday
+	}
+	calendar, err := getTenantCalendar(o, tenantId, calendarId)
+	if err != nil {
+		return false, err.Error()
+	}
+	kind, name := calendarDayType(o, calendar, local)
+	if kind == dayType {
+		return true, ""
+	}
+	if name != "" {
+		return false, fmt.Sprintf("%s 为日历 %s 的%s(%s)", local.Format("2006-01-02"), calendar.Name, calendarDayLabel(kind), name)
+	}
+	return false, fmt.Sprintf("%s 为日历 %s 的%s", local.Format("2006-01-02"), calendar.Name, calendarDayLabel(kind))
+}
+
+func calendarDayLabel(kind string) string {
+	if kind == models.CalendarWorkday {
+		return "工作日"
+	}
+	return "休息日"
+}
+
+// getTenantCalendar 校验日历归属
+func getTenantCalendar(o orm.Ormer, tenantId, id int64) (*models.WorkCalendar, error) {
+	calendar := &models.WorkCalendar{Id: id}
+	if err := o.Read(calendar); err != nil || calendar.Tenant != tenantId {
+		return nil, fmt.Errorf("日历 %d 不存在", id)
+	}
+	return calendar, nil
+}
+
+// SaveCalendar 新增或修改工作日历
+func (s *CalendarService) SaveCalendar(tenantId int64, req dtos.CalendarRequest) (*models.WorkCalendar, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("日历名称不能为空")
+	}
+	switch req.Mode {
+	case "", models.CalendarModeWeekly:
+		req.Mode = models.CalendarModeWeekly
+		if req.Workdays == "" {
+			req.Workdays = "1,2,3,4,5"
+		}
+		if _, err := parseSceneWeekdays(req.Workdays); err != nil {
+			return nil, err
+		}
+	case models.CalendarModeCycle:
+		if _, err := time.Parse("2006-01-02", req.CycleStart); err != nil {
+			return nil, fmt.Errorf("周期首日格式错误")
+		}
+		if _, err := calendarCycle(req.Cycle); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("排班方式必须为 weekly 或 cycle")
+	}
+
+	o := orm.NewOrm()
+	calendar := &models.WorkCalendar{
+		Id:         req.Id,
+		Name:       req.Name,
+		Mode:       req.Mode,
+		Workdays:   req.Workdays,
+		CycleStart: req.CycleStart,
+		Cycle:      req.Cycle,
+		Remark:     req.Remark,
+		Tenant:     tenantId,
+	}
+	if calendar.Id == 0 {
+		_ = calendar.BeforeInsert()
+		if _, err := o.Insert(calendar); err != nil {
+			return nil, fmt.Errorf("保存日历失败: %v", err)
+		}
+		return calendar, nil
+	}
+	old, err := getTenantCalendar(o, tenantId, calendar.Id)
+	if err != nil {
+		return nil, err
+	}
+	calendar.Created = old.Created
+	_ = calendar.BeforeUpdate()
+	if _, err = o.Update(calendar); err != nil {
+		return nil, fmt.Errorf("保存日历失败: %v", err)
+	}
+	return calendar, nil
+}
+
+// ListCalendars 分页查询工作日历
+func (s *CalendarService) ListCalendars(tenantId int64, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.WorkCalendar)).Filter("tenant_id", tenantId).OrderBy("-id")
+	var list []*models.WorkCalendar
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// DeleteCalendars 删除工作日历及其日期
+func (s *CalendarService) DeleteCalendars(tenantId int64, ids []int64) error {
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(models.WorkCalendar)).Filter("tenant_id", tenantId).Filter("id__in", ids).Delete()
+	return err
+}
+
+// saveCalendarDays 按日期覆盖保存，返回保存条数
+func saveCalendarDays(o orm.Ormer, calendar *models.WorkCalendar, items []dtos.CalendarDayItem) (int, error) {
+	tx, err := o.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开启事务失败: %v", err)
+	}
+	var committed bool
+	defer func() {
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				logs.Error("事务回滚失败: %v", err)
+			}
+		}
+	}()
+
+	for _, item := range items {
+		var day models.CalendarDay
+		err := tx.QueryTable(new(models.CalendarDay)).Filter("Calendar__Id", calendar.Id).Filter("date", item.Date).One(&day)
+		if err == nil {
+			day.Type, day.Name = item.Type, item.Name
+			if _, err = tx.Update(&day, "Type", "Name"); err != nil {
+				return 0, fmt.Errorf("保存日期 %s 失败: %v", item.Date, err)
+			}
+			continue
+		}
+		day = models.CalendarDay{Calendar: calendar, Date: item.Date, Type: item.Type, Name: item.Name}
+		_ = day.BeforeInsert()
+		if _, err = tx.Insert(&day); err != nil {
+			return 0, fmt.Errorf("保存日期 %s 失败: %v", item.Date, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %v", err)
+	}
+	committed = true
+	return len(items), nil
+}
+
+// normalizeCalendarDay 校验并统一日期及类型格式
+func normalizeCalendarDay(item dtos.CalendarDayItem) (dtos.CalendarDayItem, error) {
+	date, err := parseCalendarDate(item.Date)
+	if err != nil {
+		return item, err
+	}
+	kind, err := parseCalendarDayType(item.Type)
+	if err != nil {
+		return item, err
+	}
+	return dtos.CalendarDayItem{Date: date.Format("2006-01-02"), Type: kind, Name: strings.TrimSpace(item.Name)}, nil
+}
+
+// SaveDays 批量保存节假日、调休上班日期
+func (s *CalendarService) SaveDays(tenantId int64, req dtos.CalendarDaysRequest) (int, error) {
+	o := orm.NewOrm()
+	calendar, err := getTenantCalendar(o, tenantId, req.CalendarId)
+	if err != nil {
+		return 0, err
+	}
+	items := make([]dtos.CalendarDayItem, 0, len(req.Days))
+	for _, day := range req.Days {
+		item, err := normalizeCalendarDay(day)
+		if err != nil {
+			return 0, err
+		}
+		items = append(items, item)
+	}
+	return saveCalendarDays(o, calendar, items)
+}
+
+// ImportDays 从 Excel 首个工作表导入日期，首行为表头，列依次为 日期、类型、名称
+func (s *CalendarService) ImportDays(tenantId, calendarId int64, f *excelize.File) (int, error) {
+	o := orm.NewOrm()
+	calendar, err := getTenantCalendar(o, tenantId, calendarId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return 0, fmt.Errorf("读取工作表失败: %v", err)
+	}
+	var items []dtos.CalendarDayItem
+	for i, row := range rows {
+		if i == 0 || len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		day := dtos.CalendarDayItem{Date: row[0]}
+		if len(row) > 1 {
+			day.Type = row[1]
+		}
+		if len(row) > 2 {
+			day.Name = row[2]
+		}
+		item, err := normalizeCalendarDay(day)
+		if err != nil {
+			return 0, fmt.Errorf("第%d行: %v", i+1, err)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return 0, fmt.Errorf("没有可导入的日期")
+	}
+	return saveCalendarDays(o, calendar, items)
+}
+
+// ListDays 查询日历单独配置的日期，year 为空返回全部
+func (s *CalendarService) ListDays(tenantId, calendarId int64, year string) ([]*models.CalendarDay, error) {
+	o := orm.NewOrm()
+	if _, err := getTenantCalendar(o, tenantId, calendarId); err != nil {
+		return nil, err
+	}
+	qs := o.QueryTable(new(models.CalendarDay)).Filter("Calendar__Id", calendarId).OrderBy("date")
+	if year != "" {
+		qs = qs.Filter("date__startswith", year+"-")
+	}
+	list := []*models.CalendarDay{}
+	_, err := qs.All(&list)
+	return list, err
+}
+
+// DeleteDays 删除日历单独配置的日期
+func (s *CalendarService) DeleteDays(tenantId, calendarId int64, ids []int64) error {
+	o := orm.NewOrm()
+	if _, err := getTenantCalendar(o, tenantId, calendarId); err != nil {
+		return err
+	}
+	_, err := o.QueryTable(new(models.CalendarDay)).Filter("Calendar__Id", calendarId).Filter("id__in", ids).Delete()
+	return err
+}
+
+// Check 查询日期在日历中的类型，date 为空取租户时区的今天
+func (s *CalendarService) Check(tenantId, calendarId int64, date string) (map[string]interface{}, error) {
+	o := orm.NewOrm()
+	calendar, err := getTenantCalendar(o, tenantId, calendarId)
+	if err != nil {
+		return nil, err
+	}
+	day := time.Now().In(tenantLocation(o, tenantId))
+	if date != "" {
+		if day, err = parseCalendarDate(date); err != nil {
+			return nil, err
+		}
+	}
+	kind, name := calendarDayType(o, calendar, day)
+	return map[string]interface{}{
+		"date": day.Format("2006-01-02"),
+		"type": kind,
+		"name": name,
+	}, nil
+}
+
+// GetTimeZone 租户时区，未配置返回服务器时区
+func (s *CalendarService) GetTimeZone(tenantId int64) map[string]interface{} {
+	tz := tenantTimeZone(orm.NewOrm(), tenantId)
+	return map[string]interface{}{
+		"timeZone":   tz,
+		"configured": tz != "",
+		"server":     time.Local.String(),
+	}
+}
+
+// SetTimeZone 设置租户时区，并按新时区重新加载运行中的定时场景
+func (s *CalendarService) SetTimeZone(tenantId int64, tz string) error {
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("时区 %s 非法", tz)
+		}
+	}
+	o := orm.NewOrm()
+	setting := models.TenantTimeZone{Tenant: tenantId}
+	err := o.Read(&setting, "Tenant")
+	setting.TimeZone = tz
+	setting.Modified = time.Now().Unix()
+	if err == nil {
+		_, err = o.Update(&setting, "TimeZone", "Modified")
+	} else {
+		_, err = o.Insert(&setting)
+	}
+	if err != nil {
+		return fmt.Errorf("保存时区失败: %v", err)
+	}
+	GlobalSceneService.ReloadTenantTimers(tenantId)
+	return nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"log"
+	"sync"
+	"time"
+)
+
+// 控制命令默认策略，产品未配置时使用
+var (
+	commandTimeout = beego.AppConfig.DefaultInt("commandTimeout", 10)   // 单次下发等待响应的秒数
+	commandRetries = beego.AppConfig.DefaultInt("commandRetries", 2)    // 超时后的重试次数
+	commandExpire  = beego.AppConfig.DefaultInt64("commandExpire", 300) // WAIT 状态超过该秒数且未被跟踪时置为 EXPIRED
+)
+
+// trackedCommand 等待响应的控制命令
+type trackedCommand struct {
+	seq, sn, dn, tag, val string
+	attempts              int
+	maxAttempts           int
+	timeout               time.Duration
+	deadline              time.Time
+	waiters               []chan string
+}
+
+var commands = struct {
+	sync.Mutex
+	m map[string]*trackedCommand
+}{m: make(map[string]*trackedCommand)}
+
+// commandPolicy 按产品配置获取超时与重试次数
+func commandPolicy(device *models.Device) (time.Duration, int) {
+	timeout, retries := commandTimeout, commandRetries
+	if device.Product != nil {
+		product := models.Product{Id: device.Product.Id}
+		if err := orm.NewOrm().Read(&product); err == nil {
+			if product.CmdTimeout > 0 {
+				timeout = product.CmdTimeout
+			}
+			if product.CmdRetries > 0 {
+				retries = product.CmdRetries
+			} else if product.CmdRetries < 0 {
+				retries = 0
+			}
+		}
+	}
+	return time.Duration(timeout) * time.Second, retries
+}
+
+// publishCommand 发布控制命令到网关
+func (p *PropertySetProcessor) publishCommand(sn, seq, dn, tag, val string) error {
+	topic := fmt.Sprintf("lm/iot/ctrlRequest/%s", sn)
+	body := fmt.Sprintf("[{\"seq\":\"%s\",\"deviceCode\":\"%s\", \"tagCode\": \"%s\", \"val\": \"%s\"}]", seq, dn, tag, val)
+	return p.mqttClient.Publish(topic, 0, []byte(body))
+}
+
+// trackCommand 开始跟踪已下发的命令
+func trackCommand(cmd *trackedCommand) {
+	cmd.attempts = 1
+	cmd.deadline = time.Now().Add(cmd.timeout)
+	commands.Lock()
+	commands.m[cmd.seq] = cmd
+	commands.Unlock()
+}
+
+// finishCommand 将 WAIT 状态的命令置为终态并通知等待者，已是终态的命令不再改变
+func finishCommand(seq, status string) bool {
+	n, err := orm.NewOrm().QueryTable(new(models.WriteLog)).
+		Filter("seq", seq).Filter("status", models.WriteLogWait).
+		Update(orm.Params{"status": status, "resp_time": time.Now().Unix()})
+	if err != nil {
+		log.Printf("命令 %s 状态更新失败: %v", seq, err)
+	}
+
+	commands.Lock()
+	cmd, ok := commands.m[seq]
+	delete(commands.m, seq)
+	commands.Unlock()
+	if ok {
+		for _, ch := range cmd.waiters {
+			ch <- status
+		}
+	}
+	if n == 0 {
+		log.Printf("命令 %s 已结束或不存在，忽略状态 %s", seq, status)
+		return false
+	}
+	return true
+}
+
+// commandSweepLoop 检查超时命令及服务调用：未用尽重试次数则重发，否则置为 TIMEOUT；定期将遗留的 WAIT 记录置为 EXPIRED
+func commandSweepLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastExpire time.Time
+	for now := range ticker.C {
+		sweepCommands(now)
+		sweepInvokes(now)
+		if now.Sub(lastExpire) >= time.Minute {
+			expireCommands(now)
+			expireInvokes(now)
+			lastExpire = now
+		}
+	}
+}
+
+func sweepCommands(now time.Time) {
+	var retry []trackedCommand
+	var timeout []string
+	commands.Lock()
+	for seq, cmd := range commands.m {
+		if now.Before(cmd.deadline) {
+			continue
+		}
+		if cmd.attempts < cmd.maxAttempts {
+			cmd.attempts++
+			cmd.deadline = now.Add(cmd.timeout)
+			retry = append(retry, *cmd)
+		} else {
+			timeout = append(timeout, seq)
+		}
+	}
+	commands.Unlock()
+
+	o := orm.NewOrm()
+	for _, cmd := range retry {
+		if Processor == nil {
+			break
+		}
+		if err := Processor.publishCommand(cmd.sn, cmd.seq, cmd.dn, cmd.tag, cmd.val); err != nil {
+			log.Printf("命令 %s 第%d次下发失败: %v", cmd.seq, cmd.attempts, err)
+		} else {
+			log.Printf("命令 %s 响应超时，第%d次重新下发", cmd.seq, cmd.attempts)
+		}
+		_, _ = o.QueryTable(new(models.WriteLog)).Filter("seq", cmd.seq).Update(orm.Params{"attempts": cmd.attempts})
+	}
+	for _, seq := range timeout {
+		finishCommand(seq, models.WriteLogTimeout)
+	}
+}
+
+// expireCommands 将超过有效期且不在跟踪中的 WAIT 命令置为 EXPIRED
+func expireCommands(now time.Time) {
+	var logs []*models.WriteLog
+	_, err := orm.NewOrm().QueryTable(new(models.WriteLog)).
+		Filter("status", models.WriteLogWait).Filter("created__lt", now.Unix()-commandExpire).
+		All(&logs, "Seq")
+	if err != nil {
+		log.Printf("查询过期命令失败: %v", err)
+		return
+	}
+	for _, l := range logs {
+		commands.Lock()
+		_, tracked := commands.m[l.Seq]
+		commands.Unlock()
+		if !tracked {
+			finishCommand(l.Seq, models.WriteLogExpired)
+		}
+	}
+}
+
+// WaitCommand 等待命令进入终态，超时返回当前记录
+func WaitCommand(seq string, timeout time.Duration) (*models.WriteLog, error) {
+	ch := make(chan string, 1)
+	commands.Lock()
+	cmd, ok := commands.m[seq]
+	if ok {
+		cmd.waiters = append(cmd.waiters, ch)
+	}
+	commands.Unlock()
+
+	if ok {
+		select {
+		case <-ch:
+		case <-time.After(timeout):
+		}
+	}
+	writeLog := models.WriteLog{Seq: seq}
+	if err := orm.NewOrm().Read(&writeLog); err != nil {
+		return nil, fmt.Errorf("命令 %s 不存在", seq)
+	}
+	return &writeLog, nil
+}
+
+// GetCommand 查询租户下的命令记录
+func GetCommand(tenantId int64, seq string) (*models.WriteLog, error) {
+	writeLog := models.WriteLog{Seq: seq}
+	if err := orm.NewOrm().Read(&writeLog); err != nil || writeLog.Department == nil || writeLog.Department.Id != tenantId {
+		return nil, fmt.Errorf("命令不存在或无操作权限")
+	}
+	return &writeLog, nil
+}
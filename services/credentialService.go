@@ -0,0 +1,326 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	credentialSecretLength = 32
+	credentialSignMethod   = "hmacsha256"
+)
+
+var credentialCache = sync.Map{} // 用户名(name|scope) -> *models.DeviceCredential
+
+// 开启时间戳校验的凭证，签名时间戳与当前时间允许的最大偏差(秒)，超出视为过期的三元组拒绝连接，防止截获后重放；0为不校验
+// 未开启的凭证使用平台签发的固定三元组，防重放依赖轮换与吊销
+var mqttSignWindow = beego.AppConfig.DefaultInt64("mqttSignWindow", 600)
+
+// MqttTriplet 设备接入MQTT所需的 ClientId/Username/Password
+type MqttTriplet struct {
+	ClientId  string `json:"clientId"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// CredentialResult 签发或轮换后的凭证，密钥仅在此时返回一次
+type CredentialResult struct {
+	Credential *models.DeviceCredential `json:"credential"`
+	Secret     string                   `json:"secret"`
+	Triplet    MqttTriplet              `json:"triplet"`
+}
+
+// CredentialService 设备/网关接入凭证管理
+type CredentialService struct{}
+
+// SignMqttPassword 按 securemode=3,signmethod=hmacsha256 规则计算密码
+func SignMqttPassword(secret, name, scope string, timestamp int64) string {
+	content := fmt.Sprintf("clientId%s%sdeviceName%sproductKey%stimestamp%d", name, scope, name, scope, timestamp)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BuildMqttTriplet 生成签名三元组
+func BuildMqttTriplet(name, scope, secret string, timestamp int64) MqttTriplet {
+	return MqttTriplet{
+		ClientId:  fmt.Sprintf("%s%s|securemode=3,signmethod=%s,timestamp=%d|", name, scope, credentialSignMethod, timestamp),
+		Username:  name + "|" + scope,
+		Password:  SignMqttPassword(secret, name, scope, timestamp),
+		Timestamp: timestamp,
+	}
+}
+
+func newCredentialResult(cred *models.DeviceCredential) *CredentialResult {
+	return &CredentialResult{
+		Credential: cred,
+		Secret:     cred.Secret,
+		Triplet:    BuildMqttTriplet(cred.Name, cred.Scope, cred.Secret, time.Now().UnixMilli()),
+	}
+}
+
+// loadCredential 按用户名查找凭证
+func loadCredential(username string) *models.DeviceCredential {
+	if v, ok := credentialCache.Load(username); ok {
+		return v.(*models.DeviceCredential)
+	}
+	name, scope, ok := strings.Cut(username, "|")
+	if !ok || name == "" || scope == "" {
+		return nil
+	}
+	var cred models.DeviceCredential
+	err := orm.NewOrm().QueryTable(new(models.DeviceCredential)).Filter("name", name).Filter("scope", scope).One(&cred)
+	if err != nil {
+		return nil
+	}
+	credentialCache.Store(username, &cred)
+	return &cred
+}
+
+func invalidateCredential(cred *models.DeviceCredential) {
+	credentialCache.Delete(cred.Name + "|" + cred.Scope)
+}
+
+// isPlatformAccount 平台自身及eKuiper使用的共享账号
+func isPlatformAccount(username, password string) bool {
+	accounts := [][2]string{
+		{mqttUsername, mqttPassword},
+		{beego.AppConfig.DefaultString("Username", ""), beego.AppConfig.DefaultString("Password", "")},
+	}
+	for _, acc := range accounts {
+		if acc[0] == "" || acc[0] != username {
+			continue
+		}
+		if password == "" || subtle.ConstantTimeCompare([]byte(acc[1]), []byte(password)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateMqtt 校验MQTT连接签名，返回是否允许连接及是否为超级用户
+func AuthenticateMqtt(clientId, username, password string) (bool, bool) {
+	if password != "" && isPlatformAccount(username, password) {
+		return true, true
+	}
+	cred := loadCredential(username)
+	if cred == nil || cred.Status != models.CredentialActive {
+		return false, false
+	}
+
+	// ClientId 格式: {name}{scope}|securemode=3,signmethod=hmacsha256,timestamp=xxx|
+	parts := strings.Split(clientId, "|")
+	if len(parts) < 2 || parts[0] != cred.Name+cred.Scope {
+		return false, false
+	}
+	params := make(map[string]string)
+	for _, kv := range strings.Split(parts[1], ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	if params["signmethod"] != credentialSignMethod {
+		return false, false
+	}
+	timestamp, err := strconv.ParseInt(params["timestamp"], 10, 64)
+	if err != nil || (cred.CheckTimestamp && !signTimestampFresh(timestamp, time.Now())) {
+		return false, false
+	}
+
+	matched := hmac.Equal([]byte(SignMqttPassword(cred.Secret, cred.Name, cred.Scope, timestamp)), []byte(password))
+	if !matched && cred.PrevSecret != "" && time.Now().Unix() < cred.PrevExpire {
+		matched = hmac.Equal([]byte(SignMqttPassword(cred.PrevSecret, cred.Name, cred.Scope, timestamp)), []byte(password))
+	}
+	if !matched {
+		return false, false
+	}
+
+	go func(id int64) {
+		_, _ = orm.NewOrm().QueryTable(new(models.DeviceCredential)).Filter("id", id).
+			Update(orm.Params{"last_auth": time.Now().Unix()})
+	}(cred.Id)
+	return true, false
+}
+
+// signTimestampFresh 签名时间戳(毫秒，兼容秒)是否在允许的偏差内
+func signTimestampFresh(timestamp int64, now time.Time) bool {
+	if mqttSignWindow <= 0 {
+		return true
+	}
+	if timestamp < 1e12 {
+		timestamp *= 1000
+	}
+	skew := now.UnixMilli() - timestamp
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew <= mqttSignWindow*1000
+}
+
+// AuthorizeMqtt 校验发布/订阅权限，设备和网关只能访问 /edge/.../{自身SN}/... 主题，
+// 以及订阅控制请求 lm/iot/ctrlRequest/{自身SN}、发布控制响应 lm/gw/ctrlResponse/{自身SN}
+func AuthorizeMqtt(username, topic, action string) bool {
+	if isPlatformAccount(username, "") {
+		return true
+	}
+	cred := loadCredential(username)
+	if cred == nil || cred.Status != models.CredentialActive {
+		return false
+	}
+	parts := strings.Split(topic, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "lm" && parts[1] == "iot" && parts[2] == "ctrlRequest":
+		return parts[3] == cred.Name && action != "publish"
+	case len(parts) == 4 && parts[0] == "lm" && parts[1] == "gw" && parts[2] == "ctrlResponse":
+		return parts[3] == cred.Name && action != "subscribe"
+	}
+	if len(parts) < 5 || parts[0] != "" || parts[1] != "edge" {
+		return false
+	}
+	return parts[3] == cred.Name
+}
+
+// List 分页查询凭证
+func (s *CredentialService) List(tenantId int64, kind, name, status string, page, size int) (*utils.PageResult, error) {
+	var list []*models.DeviceCredential
+	qs := orm.NewOrm().QueryTable(new(models.DeviceCredential)).Filter("tenant_id", tenantId)
+	if kind != "" {
+		qs = qs.Filter("kind", kind)
+	}
+	if name != "" {
+		qs = qs.Filter("name__icontains", name)
+	}
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	qs = qs.OrderBy("-id")
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// Issue 为设备或网关签发密钥，checkTimestamp 开启签名时间戳校验
+func (s *CredentialService) Issue(tenantId int64, kind, name string, checkTimestamp bool) (*CredentialResult, error) {
+	if name == "" {
+		return nil, fmt.Errorf("名称不能为空")
+	}
+	o := orm.NewOrm()
+	var scope string
+	switch kind {
+	case models.CredentialDevice:
+		var device models.Device
+		err := o.QueryTable(new(models.Device)).Filter("name", name).Filter("tenant_id", tenantId).RelatedSel("Product").One(&device)
+		if err != nil {
+			return nil, fmt.Errorf("设备不存在或无操作权限")
+		}
+		if device.Product == nil || device.Product.Key == "" {
+			return nil, fmt.Errorf("设备未绑定产品或产品Key为空")
+		}
+		scope = device.Product.Key
+	case models.CredentialGateway:
+		if owner := gatewayTenant(name); owner != 0 && owner != tenantId {
+			return nil, fmt.Errorf("网关不属于当前租户")
+		}
+		scope = name
+	default:
+		return nil, fmt.Errorf("不支持的凭证类型: %s", kind)
+	}
+
+	if o.QueryTable(new(models.DeviceCredential)).Filter("kind", kind).Filter("name", name).Exist() {
+		return nil, fmt.Errorf("凭证已存在，请使用轮换")
+	}
+
+	cred := &models.DeviceCredential{
+		Kind:   kind,
+		Name:   name,
+		Scope:  scope,
+		Secret: utils.GenerateDeviceSecret(credentialSecretLength),
+		Status: models.CredentialActive,
+		Tenant: tenantId,
+		// 开启后设备须自行按当前时间签名
+		CheckTimestamp: checkTimestamp,
+	}
+	_ = cred.BeforeInsert()
+	if _, err := o.Insert(cred); err != nil {
+		return nil, fmt.Errorf("签发凭证失败: %v", err)
+	}
+	invalidateCredential(cred)
+	return newCredentialResult(cred), nil
+}
+
+func (s *CredentialService) get(tenantId, id int64) (*models.DeviceCredential, error) {
+	cred := &models.DeviceCredential{Id: id}
+	if err := orm.NewOrm().Read(cred); err != nil || cred.Tenant != tenantId {
+		return nil, fmt.Errorf("凭证不存在或无操作权限")
+	}
+	return cred, nil
+}
+
+// Triplet 用当前密钥重新生成三元组，不返回密钥
+func (s *CredentialService) Triplet(tenantId, id int64) (*MqttTriplet, error) {
+	cred, err := s.get(tenantId, id)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Status != models.CredentialActive {
+		return nil, fmt.Errorf("凭证已吊销")
+	}
+	triplet := BuildMqttTriplet(cred.Name, cred.Scope, cred.Secret, time.Now().UnixMilli())
+	return &triplet, nil
+}
+
+// Rotate 轮换密钥，旧密钥在宽限期(秒)内仍可认证；已吊销的凭证轮换后重新生效
+func (s *CredentialService) Rotate(tenantId, id, graceSeconds int64) (*CredentialResult, error) {
+	cred, err := s.get(tenantId, id)
+	if err != nil {
+		return nil, err
+	}
+	if graceSeconds > 0 && cred.Status == models.CredentialActive {
+		cred.PrevSecret = cred.Secret
+		cred.PrevExpire = time.Now().Unix() + graceSeconds
+	} else {
+		cred.PrevSecret = ""
+		cred.PrevExpire = 0
+	}
+	cred.Secret = utils.GenerateDeviceSecret(credentialSecretLength)
+	cred.Status = models.CredentialActive
+	_ = cred.BeforeUpdate()
+	if _, err := orm.NewOrm().Update(cred, "secret", "prev_secret", "prev_expire", "status", "modified"); err != nil {
+		return nil, fmt.Errorf("轮换密钥失败: %v", err)
+	}
+	invalidateCredential(cred)
+	return newCredentialResult(cred), nil
+}
+
+// Revoke 吊销凭证，之后的连接与发布订阅均被拒绝
+func (s *CredentialService) Revoke(tenantId int64, ids []int64) error {
+	o := orm.NewOrm()
+	var list []*models.DeviceCredential
+	qs := o.QueryTable(new(models.DeviceCredential)).Filter("tenant_id", tenantId).Filter("id__in", ids)
+	if _, err := qs.All(&list); err != nil {
+		return err
+	}
+	_, err := qs.Update(orm.Params{
+		"status":      models.CredentialRevoked,
+		"prev_secret": "",
+		"prev_expire": 0,
+		"modified":    time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, cred := range list {
+		invalidateCredential(cred)
+	}
+	return nil
+}
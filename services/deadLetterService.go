@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"iotServer/models"
+	"iotServer/utils"
+	"log"
+	"time"
+)
+
+// DeadLetterService 写入失败数据的死信管理
+type DeadLetterService struct{}
+
+// saveDeadLetters 将写入失败的上报数据持久化为死信
+func saveDeadLetters(msgs []MqttMessage, cause error, attempts int) {
+	o := orm.NewOrm()
+	errMsg := ""
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	for _, msg := range msgs {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("死信序列化失败: %v", err)
+			continue
+		}
+		letter := models.DeadLetter{
+			Dn:       msg.Dn,
+			Message:  string(body),
+			Error:    errMsg,
+			Attempts: attempts,
+			Status:   models.DeadLetterPending,
+		}
+		letter.Tenant = deadLetterTenant(o, msg.Dn)
+		_ = letter.BeforeInsert()
+		if _, err := o.Insert(&letter); err != nil {
+			log.Printf("死信保存失败 [%s]: %v", msg.Dn, err)
+		}
+	}
+	log.Printf("%d 条数据写入失败，已转入死信: %s", len(msgs), errMsg)
+}
+
+// deadLetterTenant 死信归属租户：已注册设备取设备租户，未注册设备取待审批记录中按网关推断的租户
+// 仍无法确定时为0，设备注册后审批或查询死信时归入对应租户
+func deadLetterTenant(o orm.Ormer, dn string) int64 {
+	device := models.Device{Name: dn}
+	if err := o.Read(&device, "name"); err == nil && device.Tenant != 0 {
+		return device.Tenant
+	}
+	pending := models.PendingDevice{Name: dn}
+	if err := o.Read(&pending, "name"); err == nil {
+		if pending.Tenant != 0 {
+			return pending.Tenant
+		}
+		return gatewayTenant(pending.GWSN)
+	}
+	return 0
+}
+
+// adoptDeadLetters 将设备注册前未归属租户的死信归入设备所属租户
+func adoptDeadLetters(o orm.Ormer, dn string, tenantId int64) {
+	if _, err := o.QueryTable(new(models.DeadLetter)).Filter("dn", dn).Filter("tenant_id", 0).
+		Update(orm.Params{"tenant_id": tenantId}); err != nil {
+		log.Printf("设备 %s 的死信归属租户失败: %v", dn, err)
+	}
+}
+
+// adoptTenantDeadLetters 将未归属租户、但设备现已注册到该租户的死信归入该租户
+func adoptTenantDeadLetters(o orm.Ormer, tenantId int64) {
+	var orphans []*models.DeadLetter
+	if _, err := o.QueryTable(new(models.DeadLetter)).Filter("tenant_id", 0).Distinct().All(&orphans, "Dn"); err != nil || len(orphans) == 0 {
+		return
+	}
+	names := make([]string, 0, len(orphans))
+	for _, letter := range orphans {
+		names = append(names, letter.Dn)
+	}
+	var devices []*models.Device
+	if _, err := o.QueryTable(new(models.Device)).Filter("tenant_id", tenantId).Filter("name__in", names).All(&devices, "Name"); err != nil {
+		return
+	}
+	for _, device := range devices {
+		adoptDeadLetters(o, device.Name, tenantId)
+	}
+}
+
+// List 分页查询死信
+func (s *DeadLetterService) List(tenantId int64, dn, status string, page, size int) (*utils.PageResult, error) {
+	var letters []*models.DeadLetter
+	o := orm.NewOrm()
+	adoptTenantDeadLetters(o, tenantId)
+	qs := o.QueryTable(new(models.DeadLetter)).Filter("tenant_id", tenantId)
+	if dn != "" {
+		qs = qs.Filter("dn__icontains", dn)
+	}
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	qs = qs.OrderBy("-id")
+	return utils.Paginate(qs, page, size, &letters)
+}
+
+// Replay 重新写入指定死信（ids 为空时重放租户下全部待处理死信），返回成功与失败数量
+func (s *DeadLetterService) Replay(tenantId int64, ids []int64) (int, int, error) {
+	var letters []*models.DeadLetter
+	o := orm.NewOrm()
+	adoptTenantDeadLetters(o, tenantId)
+	qs := o.QueryTable(new(models.DeadLetter)).Filter("tenant_id", tenantId).Filter("status", models.DeadLetterPending)
+	if len(ids) > 0 {
+		qs = qs.Filter("id__in", ids)
+	}
+	if _, err := qs.OrderBy("id").All(&letters); err != nil {
+		return 0, 0, fmt.Errorf("查询死信失败: %v", err)
+	}
+	if len(letters) == 0 {
+		return 0, 0, nil
+	}
+
+	t, err := NewTDengineService()
+	if err != nil {
+		return 0, 0, fmt.Errorf("连接TDengine失败: %v", err)
+	}
+	defer t.Close()
+
+	succeeded, failed := 0, 0
+	for _, letter := range letters {
+		var msg MqttMessage
+		if err := json.Unmarshal([]byte(letter.Message), &msg); err != nil {
+			letter.Status = models.DeadLetterDiscarded
+			letter.Error = "消息解析失败: " + err.Error()
+			failed++
+		} else {
+			sqlStr, _ := buildInsertSql([]MqttMessage{msg})
+			letter.Attempts++
+			if _, err := t.db.Exec(sqlStr); err != nil {
+				letter.Error = err.Error()
+				failed++
+			} else {
+				letter.Status = models.DeadLetterReplayed
+				succeeded++
+			}
+		}
+		letter.LastReplay = time.Now().Unix()
+		_ = letter.BeforeUpdate()
+		if _, err := o.Update(letter); err != nil {
+			log.Printf("死信状态更新失败 [%d]: %v", letter.Id, err)
+		}
+	}
+	return succeeded, failed, nil
+}
+
+// Delete 删除指定死信
+func (s *DeadLetterService) Delete(tenantId int64, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("死信ID不能为空")
+	}
+	o := orm.NewOrm()
+	return o.QueryTable(new(models.DeadLetter)).Filter("tenant_id", tenantId).Filter("id__in", ids).Delete()
+}
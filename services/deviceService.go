@@ -79,6 +79,7 @@ func (s *DevicesService) GetAllDevices(page, size int, tenantId int64, departmen
 			device.GroupId = device.Group.Id
 			device.GroupName = device.Group.Name
 		}
+		device.Rejected += PendingRejectedPoints(device.Name)
 	}
 
 	return result, nil
@@ -162,6 +163,8 @@ func (s *DevicesService) DeleteDevice(deviceName string, tenantId int64) error {
 		return fmt.Errorf("删除原子表失败: %v", execErr)
 	}
 
+	deleteShadow(deviceName)
+
 	err = tagService.RemoveTag(deviceName, "productId")
 	if err != nil {
 		return fmt.Errorf("删除设备失败: %v", err)
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务调用主题：平台 -> 网关 /edge/service/{SN}/invoke，网关 -> 平台 /edge/service/{SN}/reply
+// 请求: {"seq":"svc-xxx","deviceCode":"dn","service":"code","params":{...}}
+// 响应: {"seq":"svc-xxx","code":0,"message":"","output":{...}}，code为0表示执行成功
+const (
+	serviceInvokeTopic = "/edge/service/%s/invoke"
+	serviceReplyTopic  = "/edge/service/+/reply"
+	invokeMaxWait      = 60 * time.Second
+)
+
+var invokeHttpClient = &http.Client{Timeout: 5 * time.Second}
+
+// pendingInvoke 等待网关响应的服务调用
+type pendingInvoke struct {
+	record   *models.ServiceInvoke
+	outputs  []models.InputOutput
+	deadline time.Time
+	done     chan struct{}
+}
+
+var invokes = struct {
+	sync.Mutex
+	m map[string]*pendingInvoke
+}{m: make(map[string]*pendingInvoke)}
+
+// InvokeService 物模型服务调用
+type InvokeService struct{}
+
+// serviceReply 网关返回的服务执行结果
+type serviceReply struct {
+	Seq     string                 `json:"seq"`
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Output  map[string]interface{} `json:"output"`
+}
+
+// parseServiceParams 解析服务的输入/输出参数定义
+func parseServiceParams(raw string) ([]models.InputOutput, error) {
+	var params []models.InputOutput
+	if strings.TrimSpace(raw) == "" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &params); err != nil {
+		return nil, fmt.Errorf("服务参数定义格式错误: %v", err)
+	}
+	return params, nil
+}
+
+// validateServiceParams 按参数定义校验取值，定义的参数必须全部提供，不允许未定义的参数
+func validateServiceParams(defs []models.InputOutput, values map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(defs))
+	var errs []string
+	known := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		known[def.Code] = true
+		raw, ok := values[def.Code]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("缺少参数 %s", def.Code))
+			continue
+		}
+		spec := parsePropertySpec(def.TypeSpec)
+		val, ok := spec.normalize(raw)
+		if !ok || !spec.conform(val) {
+			errs = append(errs, fmt.Sprintf("参数 %s 取值 %v 不符合类型定义", def.Code, raw))
+			continue
+		}
+		result[def.Code] = val
+	}
+	for code := range values {
+		if !known[code] {
+			errs = append(errs, fmt.Sprintf("未定义的参数 %s", code))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// Invoke 校验输入参数并下发服务调用；SYNC 服务等待结果返回，ASYNC 服务立即返回调用记录
+func (s *InvokeService) Invoke(tenantId, userId int64, req dtos.InvokeRequest) (*models.ServiceInvoke, error) {
+	if req.Name == "" || req.Service == "" {
+		return nil, fmt.Errorf("设备名称和服务标识不能为空")
+	}
+	if Processor == nil {
+		return nil, fmt.Errorf("MQTT未初始化")
+	}
+	o := orm.NewOrm()
+	device := &models.Device{Name: req.Name}
+	if err := o.Read(device, "name"); err != nil || device.Tenant != tenantId {
+		return nil, fmt.Errorf("设备不存在或无操作权限")
+	}
+	if device.Product == nil {
+		return nil, fmt.Errorf("设备未绑定产品")
+	}
+	if device.GWSN == "" {
+		return nil, fmt.Errorf("设备未包含网关信息")
+	}
+
+	var action models.Actions
+	err := o.QueryTable(new(models.Actions)).Filter("product_id", device.Product.Id).Filter("code", req.Service).One(&action)
+	if err != nil {
+		return nil, fmt.Errorf("产品未定义服务 %s", req.Service)
+	}
+	inputs, err := parseServiceParams(action.InputParams)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := parseServiceParams(action.OutputParams)
+	if err != nil {
+		return nil, err
+	}
+	params, err := validateServiceParams(inputs, req.Params)
+	if err != nil {
+		return nil, fmt.Errorf("输入参数校验失败: %v", err)
+	}
+
+	callType := strings.ToUpper(action.CallType)
+	if callType != string(constants.CallTypeAsync) {
+		callType = string(constants.CallTypeSync)
+	}
+	timeout, _ := commandPolicy(device)
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	if timeout > invokeMaxWait {
+		timeout = invokeMaxWait
+	}
+
+	input, _ := json.Marshal(params)
+	record := &models.ServiceInvoke{
+		Seq:      fmt.Sprintf("svc-%d", time.Now().UnixNano()),
+		Sn:       device.GWSN,
+		Dn:       device.Name,
+		Service:  action.Code,
+		CallType: callType,
+		Input:    string(input),
+		Status:   models.WriteLogWait,
+		Callback: req.Callback,
+		UserId:   userId,
+		Tenant:   tenantId,
+	}
+	_ = record.BeforeInsert()
+	if _, err := o.Insert(record); err != nil {
+		return nil, fmt.Errorf("保存调用记录失败: %v", err)
+	}
+
+	// 先加入跟踪再下发，避免响应先于跟踪到达
+	pending := &pendingInvoke{record: record, outputs: outputs, deadline: time.Now().Add(timeout), done: make(chan struct{})}
+	invokes.Lock()
+	invokes.m[record.Seq] = pending
+	invokes.Unlock()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"seq":        record.Seq,
+		"deviceCode": record.Dn,
+		"service":    record.Service,
+		"params":     params,
+	})
+	topic := fmt.Sprintf(serviceInvokeTopic, record.Sn)
+	if err := Processor.mqttClient.Publish(topic, 0, body); err != nil {
+		finishInvoke(record.Seq, models.WriteLogFail, "", "下发失败: "+err.Error())
+		return nil, fmt.Errorf("下发服务调用失败: %v", err)
+	}
+	log.Printf("已下发服务调用: %s %s.%s", topic, record.Dn, record.Service)
+
+	if callType == string(constants.CallTypeAsync) {
+		return record, nil
+	}
+	select {
+	case <-pending.done:
+	case <-time.After(timeout + time.Second):
+	}
+	return getInvoke(record.Seq)
+}
+
+// handleServiceReply 处理网关返回的服务执行结果，按 OutputParams 校验输出
+func (p *PropertySetProcessor) handleServiceReply(topic, payload string) error {
+	var reply serviceReply
+	if err := json.Unmarshal([]byte(payload), &reply); err != nil {
+		return fmt.Errorf("JSON解析失败:%v", err)
+	}
+	if reply.Seq == "" {
+		return fmt.Errorf("服务响应缺少seq: %s", topic)
+	}
+	// 响应主题 /edge/service/{SN}/reply 须来自下发该调用的网关，防止其他网关结束别的设备的调用
+	parts := strings.Split(topic, "/")
+	if len(parts) != 5 || !orm.NewOrm().QueryTable(new(models.ServiceInvoke)).Filter("seq", reply.Seq).Filter("sn", parts[3]).Exist() {
+		return fmt.Errorf("服务响应 %s 与下发网关不匹配，忽略: %s", reply.Seq, topic)
+	}
+	output := ""
+	if reply.Output != nil {
+		b, _ := json.Marshal(reply.Output)
+		output = string(b)
+	}
+	if reply.Code != 0 {
+		finishInvoke(reply.Seq, models.WriteLogFail, output, fmt.Sprintf("设备返回错误(%d): %s", reply.Code, reply.Message))
+		return nil
+	}
+
+	invokes.Lock()
+	pending, ok := invokes.m[reply.Seq]
+	invokes.Unlock()
+	if ok {
+		checked, err := validateServiceParams(pending.outputs, reply.Output)
+		if err != nil {
+			finishInvoke(reply.Seq, models.WriteLogFail, output, "输出参数校验失败: "+err.Error())
+			return nil
+		}
+		b, _ := json.Marshal(checked)
+		output = string(b)
+	}
+	finishInvoke(reply.Seq, models.WriteLogSuccess, output, "")
+	return nil
+}
+
+// finishInvoke 将 WAIT 状态的调用置为终态，通知等待者并执行回调
+func finishInvoke(seq, status, output, errMsg string) bool {
+	n, err := orm.NewOrm().QueryTable(new(models.ServiceInvoke)).
+		Filter("seq", seq).Filter("status", models.WriteLogWait).
+		Update(orm.Params{"status": status, "output": output, "error": errMsg, "resp_time": time.Now().Unix()})
+	if err != nil {
+		log.Printf("服务调用 %s 状态更新失败: %v", seq, err)
+	}
+
+	invokes.Lock()
+	pending, ok := invokes.m[seq]
+	delete(invokes.m, seq)
+	invokes.Unlock()
+	if ok {
+		close(pending.done)
+	}
+	if n == 0 {
+		log.Printf("服务调用 %s 已结束或不存在，忽略状态 %s", seq, status)
+		return false
+	}
+	if ok && pending.record.Callback != "" {
+		go invokeCallback(seq, pending.record.Callback)
+	}
+	return true
+}
+
+// invokeCallback 将调用结果 POST 到回调地址
+func invokeCallback(seq, url string) {
+	record, err := getInvoke(seq)
+	if err != nil {
+		return
+	}
+	body, _ := json.Marshal(record)
+	resp, err := invokeHttpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("服务调用 %s 回调失败: %v", seq, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("服务调用 %s 回调返回状态码 %d", seq, resp.StatusCode)
+	}
+}
+
+// sweepInvokes 将超过等待时间的调用置为 TIMEOUT，服务调用不做重试
+func sweepInvokes(now time.Time) {
+	var expired []string
+	invokes.Lock()
+	for seq, pending := range invokes.m {
+		if !now.Before(pending.deadline) {
+			expired = append(expired, seq)
+		}
+	}
+	invokes.Unlock()
+	for _, seq := range expired {
+		finishInvoke(seq, models.WriteLogTimeout, "", "等待设备响应超时")
+	}
+}
+
+// expireInvokes 将服务重启后遗留的 WAIT 调用置为 EXPIRED
+func expireInvokes(now time.Time) {
+	var list []*models.ServiceInvoke
+	_, err := orm.NewOrm().QueryTable(new(models.ServiceInvoke)).
+		Filter("status", models.WriteLogWait).Filter("created__lt", now.Unix()-commandExpire).
+		All(&list, "Seq")
+	if err != nil {
+		log.Printf("查询过期服务调用失败: %v", err)
+		return
+	}
+	for _, record := range list {
+		invokes.Lock()
+		_, tracked := invokes.m[record.Seq]
+		invokes.Unlock()
+		if !tracked {
+			finishInvoke(record.Seq, models.WriteLogExpired, "", "调用已过期")
+		}
+	}
+}
+
+func getInvoke(seq string) (*models.ServiceInvoke, error) {
+	record := &models.ServiceInvoke{Seq: seq}
+	if err := orm.NewOrm().Read(record, "seq"); err != nil {
+		return nil, fmt.Errorf("调用记录 %s 不存在", seq)
+	}
+	return record, nil
+}
+
+// Result 查询调用结果
+func (s *InvokeService) Result(tenantId int64, seq string) (*models.ServiceInvoke, error) {
+	record, err := getInvoke(seq)
+	if err != nil || record.Tenant != tenantId {
+		return nil, fmt.Errorf("调用记录不存在或无操作权限")
+	}
+	return record, nil
+}
+
+// List 分页查询调用记录
+func (s *InvokeService) List(tenantId int64, dn, service, status string, page, size int) (*utils.PageResult, error) {
+	var list []*models.ServiceInvoke
+	qs := orm.NewOrm().QueryTable(new(models.ServiceInvoke)).Filter("tenant_id", tenantId)
+	if dn != "" {
+		qs = qs.Filter("dn", dn)
+	}
+	if service != "" {
+		qs = qs.Filter("service", service)
+	}
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	qs = qs.OrderBy("-id")
+	return utils.Paginate(qs, page, size, &list)
+}
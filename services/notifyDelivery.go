@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/utils"
+	"time"
+)
+
+// 通知失败后的自动重试次数，以及首次重试间隔(秒)，之后每次翻倍
+var (
+	notifyRetries      = beego.AppConfig.DefaultInt("notifyRetries", 3)
+	notifyRetryBackoff = beego.AppConfig.DefaultInt64("notifyRetryBackoff", 30)
+)
+
+const notifyRetryInterval = 5 * time.Second
+
+// 发送前认领投递记录的租期，期间其他重试或手动重发不会重复发送；进程在发送中退出时租期过后自动重试
+const notifyClaimLease = 2 * time.Minute
+
+// NotifyDeliveryService 通知投递记录
+type NotifyDeliveryService struct{}
+
+// notifyTarget 通知接收方，用于投递记录展示
+func notifyTarget(notifyConfig map[string]interface{}) string {
+	option := notifyOption(notifyConfig)
+	for _, key := range []string{"email", "phone", "webhook"} {
+		if v, ok := option[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// newDelivery 为单个通知方式创建投递记录
+func newDelivery(o orm.Ormer, alert *models.AlertList, msg notifyMessage, notifyConfig map[string]interface{}) (*models.NotifyDelivery, error) {
+	option, err := json.Marshal(notifyConfig)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := notifyConfig["name"].(string)
+	delivery := &models.NotifyDelivery{
+		Alert:   alert,
+		Channel: name,
+		Target:  notifyTarget(notifyConfig),
+		Title:   msg.Title,
+		Content: msg.Content,
+		Format:  msg.Format,
+		Option:  string(option),
+		Status:  models.DeliveryPending,
+	}
+	// 创建即认领，由创建方直接发送；发送前进程退出时，租期过后由重试任务补发
+	delivery.NextRetry = time.Now().Add(notifyClaimLease).UnixMilli()
+	if alert.Department != nil {
+		delivery.Tenant = alert.Department.Id
+	}
+	_ = delivery.BeforeInsert()
+	if _, err = o.Insert(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// notifyBackoff 第 attempt 次发送失败后距下次重试的间隔
+func notifyBackoff(attempt int) time.Duration {
+	backoff := time.Duration(notifyRetryBackoff) * time.Second
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// claimDelivery 下次重试时间已到期(不在其他任务的认领租期内)且状态、下次重试时间与读取时一致时更新为认领租期，仅更新成功的一方发送
+func claimDelivery(o orm.Ormer, delivery *models.NotifyDelivery) bool {
+	now := time.Now()
+	lease := now.Add(notifyClaimLease).UnixMilli()
+	n, err := o.QueryTable(new(models.NotifyDelivery)).
+		Filter("id", delivery.Id).
+		Filter("status", delivery.Status).
+		Filter("next_retry", delivery.NextRetry).
+		Filter("next_retry__lte", now.UnixMilli()).
+		Update(orm.Params{"next_retry": lease})
+	if err != nil {
+		logs.Error("认领通知投递记录 %d 失败: %v", delivery.Id, err)
+		return false
+	}
+	if n != 1 {
+		return false
+	}
+	delivery.NextRetry = lease
+	return true
+}
+
+// attemptDelivery 发送已认领的投递一次并记录结果，失败时按退避间隔安排重试，成功后标记告警已发送
+func (s *AlertService) attemptDelivery(o orm.Ormer, delivery *models.NotifyDelivery, notifyConfig map[string]interface{}) bool {
+	start := time.Now()
+	msg := notifyMessage{Title: delivery.Title, Content: delivery.Content, Format: delivery.Format}
+	response, err := s.dispatchNotify(msg, notifyConfig, delivery.Alert)
+	delivery.Latency = time.Since(start).Milliseconds()
+	delivery.Attempt++
+	delivery.Response = response
+	delivery.NextRetry = 0
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySuccess
+	case errors.Is(err, errNotifyUnsupported) || delivery.Attempt > notifyRetries:
+		delivery.Status = models.DeliveryFailed
+		delivery.Response = err.Error()
+	default:
+		delivery.Status = models.DeliveryPending
+		delivery.Response = err.Error()
+		delivery.NextRetry = time.Now().Add(notifyBackoff(delivery.Attempt)).UnixMilli()
+	}
+	if err != nil {
+		logs.Error("告警 %d %s通知第%d次发送失败: %v", delivery.Alert.Id, delivery.Channel, delivery.Attempt, err)
+	}
+	_ = delivery.BeforeUpdate()
+	if _, uerr := o.Update(delivery, "Attempt", "Status", "Response", "Latency", "NextRetry", "Modified"); uerr != nil {
+		logs.Error("更新通知投递记录 %d 失败: %v", delivery.Id, uerr)
+	}
+	if err != nil {
+		return false
+	}
+	if _, uerr := o.QueryTable(new(models.AlertList)).Filter("id", delivery.Alert.Id).Update(orm.Params{"is_send": true}); uerr != nil {
+		logs.Error("更新告警记录的IsSend字段失败: %v", uerr)
+	}
+	return true
+}
+
+// resendDelivery 认领后按投递记录中保存的通知配置重新发送
+func resendDelivery(o orm.Ormer, delivery *models.NotifyDelivery) bool {
+	if !claimDelivery(o, delivery) {
+		logs.Info("通知投递记录 %d 正在由其他任务发送，跳过", delivery.Id)
+		return false
+	}
+	var notifyConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(delivery.Option), &notifyConfig); err != nil {
+		logs.Error("通知投递记录 %d 配置解析失败: %v", delivery.Id, err)
+		return false
+	}
+	if delivery.Alert != nil && delivery.Alert.AlertRule == nil {
+		_ = o.Read(delivery.Alert)
+		if delivery.Alert.AlertRule != nil {
+			_ = o.Read(delivery.Alert.AlertRule)
+		}
+	}
+	service := AlertService{}
+	return service.attemptDelivery(o, delivery, notifyConfig)
+}
+
+// notifyRetryLoop 定期重试到期的失败通知
+func notifyRetryLoop() {
+	ticker := time.NewTicker(notifyRetryInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		retryDeliveries(now)
+	}
+}
+
+// retryDeliveries 重试 next_retry 已到期的投递，包括认领租期已过仍未完成的发送
+func retryDeliveries(now time.Time) {
+	o := orm.NewOrm()
+	var deliveries []*models.NotifyDelivery
+	_, err := o.QueryTable(new(models.NotifyDelivery)).
+		Filter("status", models.DeliveryPending).
+		Filter("next_retry__lte", now.UnixMilli()).
+		OrderBy("next_retry").
+		Limit(100).
+		All(&deliveries)
+	if err != nil {
+		logs.Error("查询待重试通知失败: %v", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		resendDelivery(o, delivery)
+	}
+}
+
+// List 分页查询告警的通知投递记录
+func (s *NotifyDeliveryService) List(tenantId, alertId int64, status string, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.NotifyDelivery)).Filter("tenant_id", tenantId).OrderBy("-id")
+	if alertId > 0 {
+		qs = qs.Filter("alert_id", alertId)
+	}
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	var list []*models.NotifyDelivery
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// Resend 手动重新发送投递记录，返回发送后的记录；待发送且未到重试时间(发送中或等待重试)的记录由重试任务处理，跳过
+func (s *NotifyDeliveryService) Resend(tenantId int64, ids []int64) ([]*models.NotifyDelivery, error) {
+	o := orm.NewOrm()
+	var deliveries []*models.NotifyDelivery
+	_, err := o.QueryTable(new(models.NotifyDelivery)).
+		Filter("tenant_id", tenantId).
+		Filter("id__in", ids).
+		All(&deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("查询投递记录失败: %v", err)
+	}
+	if len(deliveries) == 0 {
+		return nil, fmt.Errorf("投递记录不存在")
+	}
+	now := time.Now().UnixMilli()
+	for _, delivery := range deliveries {
+		if delivery.Status == models.DeliveryPending && delivery.NextRetry > now {
+			logs.Info("通知投递记录 %d 正在发送或等待重试，跳过", delivery.Id)
+			continue
+		}
+		resendDelivery(o, delivery)
+	}
+	return deliveries, nil
+}
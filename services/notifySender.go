@@ -0,0 +1,223 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	beego "github.com/beego/beego/v2/server/web"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNotifyUnsupported 通知通道未接入，不再重试
+var errNotifyUnsupported = errors.New("通知通道未接入")
+
+// smtpConfig 告警邮件发送配置
+type smtpConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+	TLS      string // ssl/starttls/none
+}
+
+// loadSmtpConfig 读取 SMTP 配置，发件人为空时使用登录账号
+func loadSmtpConfig() smtpConfig {
+	cfg := smtpConfig{
+		Host:     beego.AppConfig.DefaultString("smtpHost", ""),
+		Port:     beego.AppConfig.DefaultInt("smtpPort", 465),
+		User:     beego.AppConfig.DefaultString("smtpUser", ""),
+		Password: beego.AppConfig.DefaultString("smtpPassword", ""),
+		From:     beego.AppConfig.DefaultString("smtpFrom", ""),
+		TLS:      strings.ToLower(beego.AppConfig.DefaultString("smtpTLS", "ssl")),
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.User
+	}
+	return cfg
+}
+
+// buildMailMessage 构造 HTML 邮件，标题按 RFC 2047 编码
+func buildMailMessage(from string, to []string, subject, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// alertMailBody 告警文本转为 HTML 邮件正文
+func alertMailBody(content string) string {
+	lines := strings.Split(html.EscapeString(content), "\n")
+	return "<html><body><div style=\"font-family:sans-serif;font-size:14px\">" +
+		strings.Join(lines, "<br/>") + "</div></body></html>"
+}
+
+// sendMail 通过 SMTP 发送邮件，支持 SSL 直连与 STARTTLS
+func sendMail(cfg smtpConfig, to []string, subject, body string) error {
+	if cfg.Host == "" {
+		return fmt.Errorf("未配置 smtpHost")
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("收件人不能为空")
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if cfg.TLS == "ssl" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP 握手失败: %v", err)
+	}
+	defer client.Close()
+
+	if cfg.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP 服务器不支持 STARTTLS")
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS 失败: %v", err)
+		}
+	}
+	if cfg.User != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err = client.Auth(smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)); err != nil {
+				return fmt.Errorf("SMTP 认证失败: %v", err)
+			}
+		}
+	}
+	if err = client.Mail(cfg.From); err != nil {
+		return fmt.Errorf("发件人被拒绝: %v", err)
+	}
+	for _, rcpt := range to {
+		if err = client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %v", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件内容失败: %v", err)
+	}
+	if _, err = w.Write(buildMailMessage(cfg.From, to, subject, body)); err != nil {
+		w.Close()
+		return fmt.Errorf("发送邮件内容失败: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %v", err)
+	}
+	return client.Quit()
+}
+
+// feishuSign 飞书机器人签名：以 timestamp+"\n"+secret 为密钥对空串做 HmacSHA256 后 Base64
+func feishuSign(secret string, timestamp int64) string {
+	key := strconv.FormatInt(timestamp, 10) + "\n" + secret
+	h := hmac.New(sha256.New, []byte(key))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sendFeishu 发送飞书机器人消息，配置了密钥时附带签名，按返回 code 判断是否成功
+func sendFeishu(webhook, secret string, message map[string]interface{}) (string, error) {
+	if secret != "" {
+		timestamp := time.Now().Unix()
+		message["timestamp"] = strconv.FormatInt(timestamp, 10)
+		message["sign"] = feishuSign(secret, timestamp)
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(strings.TrimSpace(webhook), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return string(body), fmt.Errorf("状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	// 新版接口返回 code，旧版返回 StatusCode，非0为失败(如签名校验不通过 19021)
+	var result struct {
+		Code       *int   `json:"code"`
+		Msg        string `json:"msg"`
+		StatusCode *int   `json:"StatusCode"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return string(body), fmt.Errorf("响应解析失败: %s", string(body))
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return string(body), fmt.Errorf("code: %d, msg: %s", *result.Code, result.Msg)
+	}
+	if result.Code == nil && result.StatusCode != nil && *result.StatusCode != 0 {
+		return string(body), fmt.Errorf("StatusCode: %d, 响应: %s", *result.StatusCode, string(body))
+	}
+	return string(body), nil
+}
+
+// dingTalkSignedUrl 钉钉机器人加签：以 secret 为密钥对 timestamp+"\n"+secret 做 HmacSHA256 后 Base64，附加到 webhook
+func dingTalkSignedUrl(webhook, secret string, timestamp int64) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts + "\n" + secret))
+	sign := url.QueryEscape(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	sep := "&"
+	if !strings.Contains(webhook, "?") {
+		sep = "?"
+	}
+	return strings.TrimSpace(webhook) + sep + "timestamp=" + ts + "&sign=" + sign
+}
+
+// checkErrcode 企业微信、钉钉机器人返回 errcode，非0为失败
+func checkErrcode(body string) error {
+	var result struct {
+		Errcode *int   `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil || result.Errcode == nil {
+		return nil
+	}
+	if *result.Errcode != 0 {
+		return fmt.Errorf("errcode: %d, errmsg: %s", *result.Errcode, result.Errmsg)
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"text/template"
+	"time"
+)
+
+// NotifyTemplateService 通知模板
+type NotifyTemplateService struct{}
+
+// notifyVars 通知模板可用变量，模板中以 {{.Device}} 形式引用
+type notifyVars struct {
+	Kind        string // 告警类型：property/status/event/escalation
+	Rule        string // 规则名称
+	Level       string // 告警等级
+	Trigger     string // 触发方式
+	Device      string // 设备名称(dn)
+	DeviceDesc  string // 设备描述
+	Property    string // 属性名称
+	Code        string // 属性或事件标识
+	Value       string // 当前值或状态
+	Type        string // 取值类型或事件状态
+	Cycle       string // 聚合周期
+	Event       string // 事件
+	WindowStart string // 告警开始时间
+	WindowEnd   string // 告警结束时间
+	Time        string // 通知生成时间
+	Position    string // 设备位置
+	Department  string // 设备所属部门
+	Occurrences int    // 未恢复期间触发次数
+	Escalated   int    // 已升级级数
+	Text        string // 内置通知文本
+}
+
+// notifyMessage 渲染后的通知
+type notifyMessage struct {
+	Title   string
+	Content string
+	Format  string
+}
+
+// notifyKind 告警消息类型对应的模板类型
+func notifyKind(messageType interface{}) string {
+	switch messageType {
+	case "PROPERTY_REPORT":
+		return models.NotifyKindProperty
+	case "DEVICE_STATUS":
+		return models.NotifyKindStatus
+	case "EVENT_REPORT":
+		return models.NotifyKindEvent
+	}
+	return models.NotifyKindAll
+}
+
+// newNotifyVars 由告警内容整理模板变量，位置和部门取自设备
+func newNotifyVars(o orm.Ormer, rule *models.AlertRule, kind string, result map[string]interface{}, text string) *notifyVars {
+	vars := &notifyVars{
+		Kind:        kind,
+		Device:      InterfaceToString(result["dn"]),
+		Property:    InterfaceToString(result["name"]),
+		Code:        InterfaceToString(result["code"]),
+		Value:       InterfaceToString(result["value"]),
+		Type:        InterfaceToString(result["type"]),
+		Cycle:       InterfaceToString(result["cycle"]),
+		Event:       InterfaceToString(result["event"]),
+		Trigger:     InterfaceToString(result["trigger"]),
+		Level:       InterfaceToString(result["alert_level"]),
+		Time:        time.Now().Format("2006-01-02 15:04:05"),
+		Occurrences: 1,
+		Text:        text,
+	}
+	if rule != nil {
+		vars.Rule = rule.Name
+		vars.Level = rule.AlertLevel
+	}
+	if result["start_at"] != nil {
+		vars.WindowStart = utils.FormatTimestamp(result["start_at"])
+	}
+	if result["end_at"] != nil {
+		vars.WindowEnd = utils.FormatTimestamp(result["end_at"])
+	}
+	device := models.Device{Name: vars.Device}
+	if vars.Device != "" && o.Read(&device, "Name") == nil {
+		vars.DeviceDesc = device.Description
+		if device.Position != nil && o.Read(device.Position) == nil {
+			vars.Position = device.Position.Name
+		}
+		if device.Department != nil && o.Read(device.Department) == nil {
+			vars.Department = device.Department.Name
+		}
+	}
+	return vars
+}
+
+// alertNotifyVars 由已有告警记录整理模板变量，kind 为空时按触发方式判断
+func alertNotifyVars(o orm.Ormer, alert *models.AlertList, kind string) (*notifyVars, error) {
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(alert.AlertResult), &result); err != nil {
+		return nil, fmt.Errorf("告警内容解析失败: %v", err)
+	}
+	if kind == models.NotifyKindAll {
+		switch result["trigger"] {
+		case string(constants.DeviceDataTrigger):
+			kind = models.NotifyKindProperty
+		case string(constants.DeviceStatusTrigger):
+			kind = models.NotifyKindStatus
+		default:
+			kind = models.NotifyKindEvent
+		}
+	}
+	var rule *models.AlertRule
+	if alert.AlertRule != nil && o.Read(alert.AlertRule) == nil {
+		rule = alert.AlertRule
+	}
+	vars := newNotifyVars(o, rule, kind, result, "")
+	vars.Occurrences = alert.Occurrences
+	vars.Escalated = alert.Escalated
+	return vars, nil
+}
+
+// findNotifyTemplate 选取最匹配的模板：规则 > 通知方式 > 告警类型，均可回落到通用模板
+func findNotifyTemplate(o orm.Ormer, tenantId, ruleId int64, channel, kind string) *models.NotifyTemplate {
+	var templates []*models.NotifyTemplate
+	_, err := o.QueryTable(new(models.NotifyTemplate)).
+		Filter("tenant_id", tenantId).
+		Filter("rule_id__in", ruleId, 0).
+		All(&templates)
+	if err != nil {
+		logs.Error("查询通知模板失败: %v", err)
+		return nil
+	}
+	var best *models.NotifyTemplate
+	bestScore := -1
+	for _, t := range templates {
+		if (t.Channel != "" && t.Channel != channel) || (t.Kind != models.NotifyKindAll && t.Kind != kind) {
+			continue
+		}
+		score := 0
+		if t.RuleId != 0 {
+			score += 4
+		}
+		if t.Channel != "" {
+			score += 2
+		}
+		if t.Kind != models.NotifyKindAll {
+			score++
+		}
+		if score > bestScore || (score == bestScore && t.Id > best.Id) {
+			best, bestScore = t, score
+		}
+	}
+	return best
+}
+
+// parseNotifyTemplate 解析标题和内容模板，缺失的变量输出空值
+func parseNotifyTemplate(t *models.NotifyTemplate) (*template.Template, *template.Template, error) {
+	title, err := template.New("title").Option("missingkey=zero").Parse(t.Title)
+	if err != nil {
+		return nil, nil, fmt.Errorf("标题模板错误: %v", err)
+	}
+	content, err := template.New("content").Option("missingkey=zero").Parse(t.Content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("内容模板错误: %v", err)
+	}
+	return title, content, nil
+}
+
+// renderNotifyTemplate 按模板渲染通知
+func renderNotifyTemplate(t *models.NotifyTemplate, vars *notifyVars) (notifyMessage, error) {
+	title, content, err := parseNotifyTemplate(t)
+	if err != nil {
+		return notifyMessage{}, err
+	}
+	var tb, cb bytes.Buffer
+	if err = title.Execute(&tb, vars); err != nil {
+		return notifyMessage{}, fmt.Errorf("标题渲染失败: %v", err)
+	}
+	if err = content.Execute(&cb, vars); err != nil {
+		return notifyMessage{}, fmt.Errorf("内容渲染失败: %v", err)
+	}
+	return notifyMessage{Title: tb.String(), Content: cb.String(), Format: t.Format}, nil
+}
+
+// defaultNotifyTitle 未配置模板时的通知标题
+func defaultNotifyTitle(vars *notifyVars) string {
+	if vars.Kind == models.NotifyKindEscalation {
+		return "【告警升级】" + vars.Rule
+	}
+	return "【告警通知】" + vars.Rule
+}
+
+// renderNotify 按租户模板渲染通知，无模板或渲染失败时使用内置文本
+func renderNotify(o orm.Ormer, tenantId, ruleId int64, channel string, vars *notifyVars) notifyMessage {
+	if t := findNotifyTemplate(o, tenantId, ruleId, channel, vars.Kind); t != nil {
+		msg, err := renderNotifyTemplate(t, vars)
+		if err == nil {
+			return msg
+		}
+		logs.Error("通知模板 %d 渲染失败，使用默认内容: %v", t.Id, err)
+	}
+	return notifyMessage{Title: defaultNotifyTitle(vars), Content: vars.Text, Format: models.NotifyFormatText}
+}
+
+// robotMessage 按消息格式构造企业微信、钉钉机器人消息
+func robotMessage(way constants.AlertWay, msg notifyMessage) map[string]interface{} {
+	switch {
+	case msg.Format == models.NotifyFormatText || msg.Format == "":
+		return map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]interface{}{"content": msg.Content},
+		}
+	case way == constants.DingDing && msg.Format == models.NotifyFormatCard:
+		return map[string]interface{}{
+			"msgtype":    "actionCard",
+			"actionCard": map[string]interface{}{"title": msg.Title, "text": msg.Content},
+		}
+	case way == constants.DingDing:
+		return map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]interface{}{"title": msg.Title, "text": msg.Content},
+		}
+	default:
+		// 企业微信卡片按 Markdown 发送，标题加粗置顶
+		content := msg.Content
+		if msg.Format == models.NotifyFormatCard && msg.Title != "" {
+			content = "**" + msg.Title + "**\n" + content
+		}
+		return map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]interface{}{"content": content},
+		}
+	}
+}
+
+// feishuMessage 按消息格式构造飞书机器人消息，Markdown 与卡片均以消息卡片发送
+func feishuMessage(msg notifyMessage) map[string]interface{} {
+	if msg.Format == models.NotifyFormatText || msg.Format == "" {
+		return map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]interface{}{"text": msg.Content},
+		}
+	}
+	card := map[string]interface{}{
+		"config": map[string]interface{}{"wide_screen_mode": true},
+		"elements": []map[string]interface{}{
+			{"tag": "div", "text": map[string]interface{}{"tag": "lark_md", "content": msg.Content}},
+		},
+	}
+	if msg.Format == models.NotifyFormatCard {
+		card["header"] = map[string]interface{}{
+			"title":    map[string]interface{}{"tag": "plain_text", "content": msg.Title},
+			"template": "red",
+		}
+	}
+	return map[string]interface{}{"msg_type": "interactive", "card": card}
+}
+
+// withMentions 按 option.at_users/at_mobiles 在群机器人消息中 @ 接收人
+func withMentions(way constants.AlertWay, message map[string]interface{}, option map[string]interface{}) map[string]interface{} {
+	users, _ := option["at_users"].(string)
+	mobiles, _ := option["at_mobiles"].(string)
+	userIds, phones := dtos.SplitNotifyTargets(users), dtos.SplitNotifyTargets(mobiles)
+	if len(userIds) == 0 && len(phones) == 0 {
+		return message
+	}
+	switch way {
+	case constants.QYweixin:
+		if text, ok := message["text"].(map[string]interface{}); ok {
+			text["mentioned_list"] = userIds
+			text["mentioned_mobile_list"] = phones
+		} else if md, ok := message["markdown"].(map[string]interface{}); ok {
+			content, _ := md["content"].(string)
+			for _, id := range userIds {
+				content += " <@" + id + ">"
+			}
+			md["content"] = content
+		}
+	case constants.DingDing:
+		// Markdown、卡片消息需在正文中包含 @手机号 才会高亮
+		message["at"] = map[string]interface{}{"atUserIds": userIds, "atMobiles": phones}
+		for _, key := range []string{"markdown", "actionCard"} {
+			if body, ok := message[key].(map[string]interface{}); ok {
+				text, _ := body["text"].(string)
+				for _, phone := range phones {
+					text += " @" + phone
+				}
+				for _, id := range userIds {
+					text += " @" + id
+				}
+				body["text"] = text
+			}
+		}
+	case constants.FeiShu:
+		if content, ok := message["content"].(map[string]interface{}); ok {
+			text, _ := content["text"].(string)
+			for _, id := range userIds {
+				text += `<at user_id="` + id + `"></at>`
+			}
+			content["text"] = text
+		} else if card, ok := message["card"].(map[string]interface{}); ok {
+			at := ""
+			for _, id := range userIds {
+				at += "<at id=" + id + "></at>"
+			}
+			if elements, ok := card["elements"].([]map[string]interface{}); ok && at != "" {
+				card["elements"] = append(elements, map[string]interface{}{
+					"tag": "div", "text": map[string]interface{}{"tag": "lark_md", "content": at},
+				})
+			}
+		}
+	}
+	return message
+}
+
+// sampleNotifyVars 预览用的示例告警
+func sampleNotifyVars(kind string) *notifyVars {
+	now := time.Now()
+	vars := &notifyVars{
+		Kind:        kind,
+		Rule:        "温度过高",
+		Level:       "紧急",
+		Trigger:     "设备数据触发",
+		Device:      "meter_01",
+		DeviceDesc:  "1号电表",
+		Property:    "温度",
+		Code:        "Temperature",
+		Value:       "45.6",
+		Type:        "原始值",
+		Cycle:       "5分钟周期",
+		WindowStart: now.Add(-5 * time.Minute).Format("2006-01-02 15:04:05"),
+		WindowEnd:   now.Format("2006-01-02 15:04:05"),
+		Time:        now.Format("2006-01-02 15:04:05"),
+		Position:    "1号楼/配电室",
+		Department:  "运维部",
+		Occurrences: 3,
+	}
+	vars.Text = fmt.Sprintf("【告警通知】设备：%s，属性：%s，告警等级：%s，触发类型：%s，告警时间：%s，当前值：%s，请及时处理！",
+		vars.Device, vars.Property, vars.Level, vars.Trigger, vars.WindowStart, vars.Value)
+	return vars
+}
+
+// toNotifyTemplate 校验请求并转为模板
+func toNotifyTemplate(o orm.Ormer, tenantId int64, req dtos.NotifyTemplateRequest) (*models.NotifyTemplate, error) {
+	if req.Content == "" {
+		return nil, fmt.Errorf("模板内容不能为空")
+	}
+	if req.Channel != "" && !constants.IsValidAlertWay(req.Channel) {
+		return nil, fmt.Errorf("通知方式非法")
+	}
+	switch req.Kind {
+	case models.NotifyKindAll, models.NotifyKindProperty, models.NotifyKindStatus, models.NotifyKindEvent, models.NotifyKindEscalation:
+	default:
+		return nil, fmt.Errorf("告警类型必须为空、property、status、event 或 escalation")
+	}
+	if req.Format == "" {
+		req.Format = models.NotifyFormatText
+	}
+	if req.Format != models.NotifyFormatText && req.Format != models.NotifyFormatMarkdown && req.Format != models.NotifyFormatCard {
+		return nil, fmt.Errorf("消息格式必须为 text、markdown 或 card")
+	}
+	if req.RuleId > 0 {
+		exist := o.QueryTable(new(models.AlertRule)).Filter("id", req.RuleId).Filter("department_id", tenantId).Exist()
+		if !exist {
+			return nil, fmt.Errorf("告警规则 %d 不存在", req.RuleId)
+		}
+	}
+	t := &models.NotifyTemplate{
+		Id:      req.Id,
+		Name:    req.Name,
+		RuleId:  req.RuleId,
+		Channel: req.Channel,
+		Kind:    req.Kind,
+		Format:  req.Format,
+		Title:   req.Title,
+		Content: req.Content,
+		Tenant:  tenantId,
+	}
+	if _, _, err := parseNotifyTemplate(t); err != nil {
+		return nil, err
+	}
+	// 以示例告警试渲染，提前暴露引用了不存在变量等错误
+	if _, err := renderNotifyTemplate(t, sampleNotifyVars(req.Kind)); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Save 新增或修改模板
+func (s *NotifyTemplateService) Save(tenantId int64, req dtos.NotifyTemplateRequest) (*models.NotifyTemplate, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("模板名称不能为空")
+	}
+	o := orm.NewOrm()
+	t, err := toNotifyTemplate(o, tenantId, req)
+	if err != nil {
+		return nil, err
+	}
+	if t.Id == 0 {
+		_ = t.BeforeInsert()
+		if _, err = o.Insert(t); err != nil {
+			return nil, fmt.Errorf("保存模板失败: %v", err)
+		}
+		return t, nil
+	}
+	old := models.NotifyTemplate{Id: t.Id}
+	if err = o.Read(&old); err != nil || old.Tenant != tenantId {
+		return nil, fmt.Errorf("模板 %d 不存在", t.Id)
+	}
+	t.Created = old.Created
+	_ = t.BeforeUpdate()
+	if _, err = o.Update(t); err != nil {
+		return nil, fmt.Errorf("保存模板失败: %v", err)
+	}
+	return t, nil
+}
+
+// List 分页查询模板
+func (s *NotifyTemplateService) List(tenantId, ruleId int64, channel string, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.NotifyTemplate)).Filter("tenant_id", tenantId).OrderBy("-id")
+	if ruleId > 0 {
+		qs = qs.Filter("rule_id", ruleId)
+	}
+	if channel != "" {
+		qs = qs.Filter("channel", channel)
+	}
+	var list []*models.NotifyTemplate
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// Delete 删除模板
+func (s *NotifyTemplateService) Delete(tenantId int64, ids []int64) error {
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(models.NotifyTemplate)).Filter("tenant_id", tenantId).Filter("id__in", ids).Delete()
+	return err
+}
+
+// Preview 以示例告警或指定告警渲染模板，返回各通道实际发送的消息体
+func (s *NotifyTemplateService) Preview(tenantId int64, req dtos.NotifyTemplatePreviewRequest) (map[string]interface{}, error) {
+	o := orm.NewOrm()
+	t, err := toNotifyTemplate(o, tenantId, req.NotifyTemplateRequest)
+	if err != nil {
+		return nil, err
+	}
+	vars := sampleNotifyVars(t.Kind)
+	if req.AlertId > 0 {
+		alert, err := getTenantAlert(o, tenantId, req.AlertId)
+		if err != nil {
+			return nil, err
+		}
+		if vars, err = alertNotifyVars(o, alert, t.Kind); err != nil {
+			return nil, err
+		}
+	}
+	msg, err := renderNotifyTemplate(t, vars)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"title":   msg.Title,
+		"content": msg.Content,
+		"format":  msg.Format,
+		"vars":    vars,
+	}
+	switch constants.AlertWay(t.Channel) {
+	case constants.QYweixin, constants.DingDing:
+		result["payload"] = robotMessage(constants.AlertWay(t.Channel), msg)
+	case constants.FeiShu:
+		result["payload"] = feishuMessage(msg)
+	case constants.EMAIL:
+		result["payload"] = alertMailBody(msg.Content)
+	}
+	return result, nil
+}
@@ -0,0 +1,520 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"strings"
+	"time"
+)
+
+// OnCallService 联系方式与值班表
+type OnCallService struct{}
+
+const defaultOnCallTimeZone = "Asia/Shanghai"
+
+// notifyContact 接收人解析后的联系方式
+type notifyContact struct {
+	UserId   int64  `json:"userId"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	WeComId  string `json:"wecomId"`
+	DingId   string `json:"dingId"`
+	FeishuId string `json:"feishuId"`
+}
+
+// onCallLocation 值班表时区，非法时使用默认时区
+func onCallLocation(tz string) *time.Location {
+	if tz == "" {
+		tz = defaultOnCallTimeZone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// onCallInEffect 按值班表时区判断是否处于生效时间段，未配置时全天生效
+func onCallInEffect(schedule *models.OnCallSchedule, local time.Time) bool {
+	start, end := schedule.StartEffectTime, schedule.EndEffectTime
+	if start == "" {
+		start = "00:00:00"
+	}
+	if end == "" {
+		end = "23:59:59"
+	}
+	return utils.IsInEffectiveTime(map[string]interface{}{
+		"start_effect_time": start,
+		"end_effect_time":   end,
+	}, local.Format("15:04:05"))
+}
+
+// onCallShiftIndex 计算 at 所在班次相对首个班次的序号
+// daily/weekly 按值班表时区的日历日计算，不受夏令时影响；custom 按固定时长计算
+func onCallShiftIndex(schedule *models.OnCallSchedule, at time.Time) (int, error) {
+	loc := onCallLocation(schedule.TimeZone)
+	handoff := schedule.HandoffTime
+	if handoff == "" {
+		handoff = "00:00:00"
+	}
+	anchor, err := time.ParseInLocation("2006-01-02 15:04:05", schedule.StartDate+" "+handoff, loc)
+	if err != nil {
+		return 0, fmt.Errorf("首个班次时间格式错误")
+	}
+	local := at.In(loc)
+
+	if schedule.Rotation == models.RotationCustom {
+		shift := time.Duration(schedule.ShiftHours) * time.Hour
+		if shift <= 0 {
+			return 0, fmt.Errorf("班次时长必须大于0")
+		}
+		return floorDiv(int(local.Sub(anchor)/time.Minute), int(shift/time.Minute)), nil
+	}
+
+	// 交接时间前仍属于前一天的班次
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	if local.Format("15:04:05") < handoff {
+		day = day.AddDate(0, 0, -1)
+	}
+	start := time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(day.Sub(start).Hours() / 24)
+	if schedule.Rotation == models.RotationWeekly {
+		return floorDiv(days, 7), nil
+	}
+	return days, nil
+}
+
+// floorDiv 向下取整的整数除法
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// currentOnCall 值班表在 at 时刻的值班人，替换优先于轮换，生效时间段外返回0
+func currentOnCall(o orm.Ormer, schedule *models.OnCallSchedule, at time.Time) (int64, bool, error) {
+	if !onCallInEffect(schedule, at.In(onCallLocation(schedule.TimeZone))) {
+		return 0, false, nil
+	}
+	var override models.OnCallOverride
+	err := o.QueryTable(new(models.OnCallOverride)).
+		Filter("Schedule__Id", schedule.Id).
+		Filter("start__lte", at.Unix()).
+		Filter("end__gt", at.Unix()).
+		OrderBy("-id").
+		Limit(1).
+		One(&override)
+	if err == nil {
+		return override.UserId, true, nil
+	}
+	members := schedule.DecodeMembers()
+	if len(members) == 0 {
+		return 0, false, nil
+	}
+	index, err := onCallShiftIndex(schedule, at)
+	if err != nil {
+		return 0, false, err
+	}
+	n := len(members)
+	return members[((index%n)+n)%n], false, nil
+}
+
+// notifyRecipients 通知配置中的接收人
+func notifyRecipients(notifyConfig map[string]interface{}) []models.NotifyRecipient {
+	raw, ok := notifyConfig["recipients"]
+	if !ok || raw == nil {
+		return nil
+	}
+	var recipients []models.NotifyRecipient
+	b, _ := json.Marshal(raw)
+	_ = json.Unmarshal(b, &recipients)
+	return recipients
+}
+
+// resolveRecipients 将用户、角色、部门、值班表解析为租户内去重后的联系方式
+func resolveRecipients(o orm.Ormer, tenantId int64, recipients []models.NotifyRecipient, at time.Time) []notifyContact {
+	var userIds []int64
+	seen := make(map[int64]bool)
+	add := func(ids ...int64) {
+		for _, id := range ids {
+			if id > 0 && !seen[id] {
+				seen[id] = true
+				userIds = append(userIds, id)
+			}
+		}
+	}
+	queryUsers := func(field string, value interface{}) {
+		var ids orm.ParamsList
+		if _, err := o.QueryTable(new(models.User)).Filter(field, value).ValuesFlat(&ids, "id"); err != nil {
+			logs.Error("查询通知接收人失败: %v", err)
+			return
+		}
+		for _, id := range ids {
+			if v, ok := toFloat(id); ok {
+				add(int64(v))
+			}
+		}
+	}
+
+	for _, r := range recipients {
+		switch r.Type {
+		case models.RecipientUser:
+			add(r.Id)
+		case models.RecipientRole:
+			queryUsers("Role__Id", r.Id)
+		case models.RecipientDepartment:
+			departmentService := DepartmentService{}
+			ids, err := departmentService.getDepartmentTreeIDs(r.Id)
+			if err != nil || len(ids) == 0 {
+				ids = []int64{r.Id}
+			}
+			queryUsers("Department__Id__in", ids)
+		case models.RecipientOnCall:
+			schedule := models.OnCallSchedule{Id: r.Id}
+			if err := o.Read(&schedule); err != nil || schedule.Tenant != tenantId {
+				continue
+			}
+			userId, _, err := currentOnCall(o, &schedule, at)
+			if err != nil {
+				logs.Error("值班表 %d 解析失败: %v", schedule.Id, err)
+				continue
+			}
+			add(userId)
+		}
+	}
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	// 仅通知本租户用户，保持接收人配置的顺序
+	var users []*models.User
+	if _, err := o.QueryTable(new(models.User)).Filter("id__in", userIds).Filter("Department__TenantId", tenantId).All(&users); err != nil {
+		logs.Error("查询通知接收人失败: %v", err)
+		return nil
+	}
+	var profiles []*models.ContactProfile
+	_, _ = o.QueryTable(new(models.ContactProfile)).Filter("user_id__in", userIds).All(&profiles)
+	profileOf := make(map[int64]*models.ContactProfile, len(profiles))
+	for _, p := range profiles {
+		profileOf[p.UserId] = p
+	}
+	userOf := make(map[int64]*models.User, len(users))
+	for _, u := range users {
+		userOf[u.Id] = u
+	}
+	contacts := make([]notifyContact, 0, len(users))
+	for _, id := range userIds {
+		u, ok := userOf[id]
+		if !ok {
+			continue
+		}
+		c := notifyContact{UserId: u.Id, Username: u.Username, Email: u.Email}
+		if p := profileOf[id]; p != nil {
+			if p.Email != "" {
+				c.Email = p.Email
+			}
+			c.Phone, c.WeComId, c.DingId, c.FeishuId = p.Phone, p.WeComId, p.DingId, p.FeishuId
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts
+}
+
+// applyRecipients 按接收人联系方式补充通知配置：邮件收件人、短信语音手机号、群机器人 @ 对象
+func applyRecipients(notifyConfig map[string]interface{}, contacts []notifyContact) map[string]interface{} {
+	option := make(map[string]interface{})
+	for k, v := range notifyOption(notifyConfig) {
+		option[k] = v
+	}
+	config := make(map[string]interface{}, len(notifyConfig))
+	for k, v := range notifyConfig {
+		config[k] = v
+	}
+	config["option"] = option
+
+	merge := func(key string, pick func(c notifyContact) string) {
+		existing, _ := option[key].(string)
+		values := dtos.SplitNotifyTargets(existing)
+		for _, c := range contacts {
+			if v := pick(c); v != "" {
+				values = append(values, v)
+			}
+		}
+		option[key] = strings.Join(uniqueStrings(values), ",")
+	}
+	name, _ := notifyConfig["name"].(string)
+	switch constants.AlertWay(name) {
+	case constants.EMAIL:
+		merge("email", func(c notifyContact) string { return c.Email })
+	case constants.SMS, constants.PHONE:
+		merge("phone", func(c notifyContact) string { return c.Phone })
+	case constants.QYweixin:
+		merge("at_users", func(c notifyContact) string { return c.WeComId })
+		merge("at_mobiles", func(c notifyContact) string { return c.Phone })
+	case constants.DingDing:
+		merge("at_users", func(c notifyContact) string { return c.DingId })
+		merge("at_mobiles", func(c notifyContact) string { return c.Phone })
+	case constants.FeiShu:
+		merge("at_users", func(c notifyContact) string { return c.FeishuId })
+	}
+	return config
+}
+
+// uniqueStrings 去重并保持顺序
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := values[:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// tenantUser 校验用户属于租户
+func tenantUser(o orm.Ormer, tenantId, userId int64) (*models.User, error) {
+	var user models.User
+	err := o.QueryTable(new(models.User)).Filter("id", userId).Filter("Department__TenantId", tenantId).One(&user)
+	if err != nil {
+		return nil, fmt.Errorf("用户 %d 不存在", userId)
+	}
+	return &user, nil
+}
+
+// SaveContact 保存用户联系方式
+func (s *OnCallService) SaveContact(tenantId int64, req dtos.ContactProfileRequest) (*models.ContactProfile, error) {
+	o := orm.NewOrm()
+	if _, err := tenantUser(o, tenantId, req.UserId); err != nil {
+		return nil, err
+	}
+	profile := models.ContactProfile{UserId: req.UserId}
+	exist := o.Read(&profile, "UserId") == nil
+	profile.Email = req.Email
+	profile.Phone = req.Phone
+	profile.WeComId = req.WeComId
+	profile.DingId = req.DingId
+	profile.FeishuId = req.FeishuId
+	profile.Tenant = tenantId
+	var err error
+	if exist {
+		_ = profile.BeforeUpdate()
+		_, err = o.Update(&profile)
+	} else {
+		_ = profile.BeforeInsert()
+		_, err = o.Insert(&profile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存联系方式失败: %v", err)
+	}
+	return &profile, nil
+}
+
+// ListContacts 分页查询联系方式
+func (s *OnCallService) ListContacts(tenantId int64, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.ContactProfile)).Filter("tenant_id", tenantId).OrderBy("-id")
+	var list []*models.ContactProfile
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// SaveSchedule 新增或修改值班表
+func (s *OnCallService) SaveSchedule(tenantId int64, req dtos.OnCallScheduleRequest) (*models.OnCallSchedule, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("值班表名称不能为空")
+	}
+	if len(req.Members) == 0 {
+		return nil, fmt.Errorf("轮换成员不能为空")
+	}
+	switch req.Rotation {
+	case models.RotationDaily, models.RotationWeekly:
+	case models.RotationCustom:
+		if req.ShiftHours <= 0 {
+			return nil, fmt.Errorf("custom 轮换的班次时长必须大于0")
+		}
+	default:
+		return nil, fmt.Errorf("轮换方式必须为 daily、weekly 或 custom")
+	}
+	if req.TimeZone == "" {
+		req.TimeZone = defaultOnCallTimeZone
+	}
+	if _, err := time.LoadLocation(req.TimeZone); err != nil {
+		return nil, fmt.Errorf("时区 %s 非法", req.TimeZone)
+	}
+	if req.HandoffTime == "" {
+		req.HandoffTime = "00:00:00"
+	}
+	if _, err := time.Parse("2006-01-02 15:04:05", req.StartDate+" "+req.HandoffTime); err != nil {
+		return nil, fmt.Errorf("首个班次日期或交接时间格式错误")
+	}
+	if req.StartEffectTime != "" || req.EndEffectTime != "" {
+		if err := dtos.ValidateTimeRange(req.StartEffectTime, req.EndEffectTime); err != nil {
+			return nil, fmt.Errorf("生效时间非法: %v", err)
+		}
+	}
+
+	o := orm.NewOrm()
+	for _, id := range req.Members {
+		if _, err := tenantUser(o, tenantId, id); err != nil {
+			return nil, err
+		}
+	}
+	schedule := &models.OnCallSchedule{
+		Id:              req.Id,
+		Name:            req.Name,
+		TimeZone:        req.TimeZone,
+		Rotation:        req.Rotation,
+		ShiftHours:      req.ShiftHours,
+		StartDate:       req.StartDate,
+		HandoffTime:     req.HandoffTime,
+		StartEffectTime: req.StartEffectTime,
+		EndEffectTime:   req.EndEffectTime,
+		Tenant:          tenantId,
+		MemberIds:       req.Members,
+	}
+	if schedule.Id == 0 {
+		if err := schedule.BeforeInsert(); err != nil {
+			return nil, err
+		}
+		if _, err := o.Insert(schedule); err != nil {
+			return nil, fmt.Errorf("保存值班表失败: %v", err)
+		}
+		return schedule, nil
+	}
+	old, err := getTenantSchedule(o, tenantId, schedule.Id)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Created = old.Created
+	if err = schedule.BeforeUpdate(); err != nil {
+		return nil, err
+	}
+	if _, err = o.Update(schedule); err != nil {
+		return nil, fmt.Errorf("保存值班表失败: %v", err)
+	}
+	return schedule, nil
+}
+
+// getTenantSchedule 校验值班表归属
+func getTenantSchedule(o orm.Ormer, tenantId, id int64) (*models.OnCallSchedule, error) {
+	schedule := &models.OnCallSchedule{Id: id}
+	if err := o.Read(schedule); err != nil || schedule.Tenant != tenantId {
+		return nil, fmt.Errorf("值班表 %d 不存在", id)
+	}
+	schedule.DecodeMembers()
+	return schedule, nil
+}
+
+// ListSchedules 分页查询值班表
+func (s *OnCallService) ListSchedules(tenantId int64, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.OnCallSchedule)).Filter("tenant_id", tenantId).OrderBy("-id")
+	var list []*models.OnCallSchedule
+	result, err := utils.Paginate(qs, page, size, &list)
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range list {
+		schedule.DecodeMembers()
+	}
+	return result, nil
+}
+
+// DeleteSchedules 删除值班表及其替换
+func (s *OnCallService) DeleteSchedules(tenantId int64, ids []int64) error {
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(models.OnCallSchedule)).Filter("tenant_id", tenantId).Filter("id__in", ids).Delete()
+	return err
+}
+
+// AddOverride 新增值班替换
+func (s *OnCallService) AddOverride(tenantId int64, req dtos.OnCallOverrideRequest) (*models.OnCallOverride, error) {
+	o := orm.NewOrm()
+	schedule, err := getTenantSchedule(o, tenantId, req.ScheduleId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tenantUser(o, tenantId, req.UserId); err != nil {
+		return nil, err
+	}
+	if req.End <= req.Start {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	override := &models.OnCallOverride{
+		Schedule: schedule,
+		UserId:   req.UserId,
+		Start:    req.Start,
+		End:      req.End,
+		Remark:   req.Remark,
+		Created:  time.Now().Unix(),
+	}
+	if _, err = o.Insert(override); err != nil {
+		return nil, fmt.Errorf("保存值班替换失败: %v", err)
+	}
+	return override, nil
+}
+
+// ListOverrides 值班表的替换记录
+func (s *OnCallService) ListOverrides(tenantId, scheduleId int64) ([]*models.OnCallOverride, error) {
+	o := orm.NewOrm()
+	if _, err := getTenantSchedule(o, tenantId, scheduleId); err != nil {
+		return nil, err
+	}
+	var list []*models.OnCallOverride
+	_, err := o.QueryTable(new(models.OnCallOverride)).Filter("Schedule__Id", scheduleId).OrderBy("start").All(&list)
+	return list, err
+}
+
+// DeleteOverrides 删除值班替换
+func (s *OnCallService) DeleteOverrides(tenantId int64, ids []int64) error {
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(models.OnCallOverride)).
+		Filter("Schedule__Tenant", tenantId).
+		Filter("id__in", ids).
+		Delete()
+	return err
+}
+
+// Current 值班表在指定时间(秒，0为当前)的值班人
+func (s *OnCallService) Current(tenantId, scheduleId, at int64) (map[string]interface{}, error) {
+	o := orm.NewOrm()
+	schedule, err := getTenantSchedule(o, tenantId, scheduleId)
+	if err != nil {
+		return nil, err
+	}
+	when := time.Now()
+	if at > 0 {
+		when = time.Unix(at, 0)
+	}
+	userId, override, err := currentOnCall(o, schedule, when)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"scheduleId": schedule.Id,
+		"time":       when.In(onCallLocation(schedule.TimeZone)).Format("2006-01-02 15:04:05 MST"),
+		"userId":     userId,
+		"override":   override,
+	}
+	if userId > 0 {
+		if user, err := tenantUser(o, tenantId, userId); err == nil {
+			result["username"] = user.Username
+		}
+	}
+	return result, nil
+}
+
+// Resolve 预览接收人在当前时间解析出的联系方式
+func (s *OnCallService) Resolve(tenantId int64, recipients []models.NotifyRecipient) []notifyContact {
+	return resolveRecipients(orm.NewOrm(), tenantId, recipients, time.Now())
+}
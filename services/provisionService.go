@@ -0,0 +1,414 @@
+package services
+
+import (
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/utils"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 同一未注册设备的上报最多每隔该时间落库一次
+const provisionRecordInterval = time.Minute
+
+var (
+	provisionOnce    sync.Once
+	provisionEnabled bool
+	pendingSeen      = sync.Map{} // 设备名 -> *pendingState
+)
+
+// pendingState 未注册设备在两次落库之间累积的上报信息
+type pendingState struct {
+	mu      sync.Mutex
+	last    time.Time
+	reports int64
+	desc    string
+	keys    map[string]bool
+}
+
+// ProvisionService 未注册设备的待审批收件箱及自动注册规则
+type ProvisionService struct{}
+
+// autoProvisionEnabled 是否开启未注册设备收件箱，对应配置 deviceAutoProvision
+func autoProvisionEnabled() bool {
+	provisionOnce.Do(func() {
+		provisionEnabled = beego.AppConfig.DefaultBool("deviceAutoProvision", false)
+	})
+	return provisionEnabled
+}
+
+// observeUnknownDevice 记录未注册设备的上报，节流落库后按网关规则尝试自动注册
+func observeUnknownDevice(sn string, msg MqttMessage) {
+	if !autoProvisionEnabled() || msg.Dn == "" || msg.Dn == "system" {
+		return
+	}
+
+	v, _ := pendingSeen.LoadOrStore(msg.Dn, &pendingState{keys: make(map[string]bool)})
+	state := v.(*pendingState)
+	state.mu.Lock()
+	state.reports++
+	if msg.Desc != "" {
+		state.desc = msg.Desc
+	}
+	for k := range msg.Properties {
+		state.keys[k] = true
+	}
+	if time.Since(state.last) < provisionRecordInterval {
+		state.mu.Unlock()
+		return
+	}
+	reports, desc, keys := state.reports, state.desc, state.keys
+	state.last = time.Now()
+	state.reports = 0
+	state.keys = make(map[string]bool)
+	state.mu.Unlock()
+
+	pending, err := recordPendingDevice(sn, msg.Dn, desc, keys, reports)
+	if err != nil {
+		log.Printf("记录未注册设备 %s 失败: %v", msg.Dn, err)
+		return
+	}
+	if pending != nil && pending.Status == models.PendingDeviceWaiting {
+		go tryAutoProvision(pending)
+	}
+}
+
+// recordPendingDevice 新增或更新待审批设备，已忽略的设备返回nil
+func recordPendingDevice(sn, dn, desc string, keys map[string]bool, reports int64) (*models.PendingDevice, error) {
+	o := orm.NewOrm()
+	now := time.Now().Unix()
+	pending := models.PendingDevice{Name: dn}
+	if err := o.Read(&pending, "name"); err != nil {
+		pending = models.PendingDevice{
+			Name:        dn,
+			GWSN:        sn,
+			Description: desc,
+			Keys:        mergeKeys("", keys),
+			Reports:     reports,
+			FirstSeen:   now,
+			LastSeen:    now,
+			Status:      models.PendingDeviceWaiting,
+			Tenant:      gatewayTenant(sn),
+		}
+		_ = pending.BeforeInsert()
+		if _, err := o.Insert(&pending); err != nil {
+			return nil, err
+		}
+		log.Printf("发现未注册设备 %s (网关 %s)，已加入待审批列表", dn, sn)
+		return &pending, nil
+	}
+
+	if pending.Status == models.PendingDeviceIgnored {
+		return nil, nil
+	}
+	// 已注册的设备被删除后重新上报，重新进入待审批
+	if pending.Status == models.PendingDeviceApproved {
+		if o.QueryTable(new(models.Device)).Filter("name", dn).Exist() {
+			return nil, nil
+		}
+		pending.Status = models.PendingDeviceWaiting
+		pending.ProductId = 0
+		pending.Rule = 0
+	}
+	pending.GWSN = sn
+	if desc != "" {
+		pending.Description = desc
+	}
+	pending.Keys = mergeKeys(pending.Keys, keys)
+	pending.Reports += reports
+	pending.LastSeen = now
+	if pending.Tenant == 0 {
+		pending.Tenant = gatewayTenant(sn)
+	}
+	_ = pending.BeforeUpdate()
+	if _, err := o.Update(&pending); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+// mergeKeys 合并属性列表并排序
+func mergeKeys(existing string, keys map[string]bool) string {
+	all := make(map[string]bool, len(keys))
+	for _, k := range strings.Split(existing, ",") {
+		if k != "" {
+			all[k] = true
+		}
+	}
+	for k := range keys {
+		all[k] = true
+	}
+	list := make([]string, 0, len(all))
+	for k := range all {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// gatewayTenant 根据网关的接入凭证或网关下已注册的设备推断租户，未知返回0
+func gatewayTenant(sn string) int64 {
+	if sn == "" {
+		return 0
+	}
+	o := orm.NewOrm()
+	var cred models.DeviceCredential
+	if err := o.QueryTable(new(models.DeviceCredential)).Filter("kind", models.CredentialGateway).Filter("name", sn).
+		Filter("status", models.CredentialActive).Exclude("tenant_id", 0).Limit(1).One(&cred, "Tenant"); err == nil {
+		return cred.Tenant
+	}
+	var device models.Device
+	if err := o.QueryTable(new(models.Device)).Filter("sn", sn).Exclude("tenant_id", 0).Limit(1).One(&device, "Tenant"); err == nil {
+		return device.Tenant
+	}
+	var pending models.PendingDevice
+	if err := o.QueryTable(new(models.PendingDevice)).Filter("sn", sn).Filter("status", models.PendingDeviceApproved).
+		Exclude("tenant_id", 0).Limit(1).One(&pending, "Tenant"); err == nil {
+		return pending.Tenant
+	}
+	return 0
+}
+
+// matchRule 按优先级查找命中的自动注册规则
+func matchRule(pending *models.PendingDevice) *models.ProvisionRule {
+	var rules []*models.ProvisionRule
+	_, err := orm.NewOrm().QueryTable(new(models.ProvisionRule)).
+		Filter("enabled", true).Filter("sn__in", pending.GWSN, "*").
+		OrderBy("-priority", "id").All(&rules)
+	if err != nil {
+		return nil
+	}
+	for _, rule := range rules {
+		// 规则只作用于本租户的网关，租户未知的设备只能人工处理
+		if rule.Tenant != pending.Tenant {
+			continue
+		}
+		if ok, _ := path.Match(rule.Pattern, pending.Name); ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// tryAutoProvision 命中规则时自动注册设备
+func tryAutoProvision(pending *models.PendingDevice) {
+	rule := matchRule(pending)
+	if rule == nil || rule.Product == nil {
+		return
+	}
+	if err := approvePendingDevice(pending, rule.Product.Id, rule.PositionId, rule.GroupId, rule.Id); err != nil {
+		log.Printf("设备 %s 自动注册失败: %v", pending.Name, err)
+		pending.Error = err.Error()
+		_ = pending.BeforeUpdate()
+		_, _ = orm.NewOrm().Update(pending, "error", "modified")
+		return
+	}
+	log.Printf("设备 %s 命中规则 %d，已自动注册到产品 %d", pending.Name, rule.Id, rule.Product.Id)
+}
+
+// approvePendingDevice 通过设备绑定流程把待审批设备注册到产品
+func approvePendingDevice(pending *models.PendingDevice, productId, positionId, groupId, ruleId int64) error {
+	o := orm.NewOrm()
+	product := models.Product{Id: productId}
+	if err := o.Read(&product); err != nil {
+		return fmt.Errorf("产品ID无效")
+	}
+	if product.Department == nil {
+		return fmt.Errorf("产品未归属租户")
+	}
+
+	tags := map[string]string{}
+	if positionId > 0 {
+		tags["positionId"] = strconv.FormatInt(positionId, 10)
+	}
+	if groupId > 0 {
+		tags["groupId"] = strconv.FormatInt(groupId, 10)
+	}
+	if pending.Description != "" {
+		tags["description"] = pending.Description
+	}
+	tenantId := product.Department.Id
+	if err := BindDeviceTags(tagService, tenantId, []string{pending.Name}, product.Id, product.Name, product.Key, product.CategoryId, tags); err != nil {
+		return err
+	}
+	// 记录所属网关，供下发控制使用
+	_, _ = o.QueryTable(new(models.Device)).Filter("name", pending.Name).Update(orm.Params{"sn": pending.GWSN})
+
+	pending.Status = models.PendingDeviceApproved
+	pending.ProductId = product.Id
+	pending.Rule = ruleId
+	pending.Tenant = tenantId
+	pending.Error = ""
+	_ = pending.BeforeUpdate()
+	if _, err := o.Update(pending, "status", "product_id", "rule_id", "tenant_id", "error", "modified"); err != nil {
+		return fmt.Errorf("更新待审批设备失败: %v", err)
+	}
+	pendingSeen.Delete(pending.Name)
+	adoptDeadLetters(o, pending.Name, tenantId)
+
+	// 加载超级表缓存，后续上报即可入库
+	return LoadAllDeviceCategoryKeys()
+}
+
+// ListPending 分页查询本租户网关下的待审批设备，未能推断租户的设备不可见
+func (s *ProvisionService) ListPending(tenantId int64, sn, name, status string, page, size int) (*utils.PageResult, error) {
+	var list []*models.PendingDevice
+	qs := orm.NewOrm().QueryTable(new(models.PendingDevice)).Filter("tenant_id", tenantId)
+	if sn != "" {
+		qs = qs.Filter("sn", sn)
+	}
+	if name != "" {
+		qs = qs.Filter("name__icontains", name)
+	}
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	qs = qs.OrderBy("-last_seen", "-id")
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// Approve 人工审批待注册设备到产品，返回成功与失败数量
+func (s *ProvisionService) Approve(tenantId int64, ids []int64, productId, positionId, groupId int64) (int, int, error) {
+	o := orm.NewOrm()
+	product := models.Product{Id: productId}
+	if err := o.Read(&product); err != nil || product.Department == nil || product.Department.Id != tenantId {
+		return 0, 0, fmt.Errorf("产品不存在或无操作权限")
+	}
+
+	var list []*models.PendingDevice
+	_, err := o.QueryTable(new(models.PendingDevice)).Filter("tenant_id", tenantId).
+		Filter("id__in", ids).Exclude("status", models.PendingDeviceApproved).All(&list)
+	if err != nil {
+		return 0, 0, fmt.Errorf("查询待审批设备失败: %v", err)
+	}
+
+	succeeded, failed := 0, 0
+	for _, pending := range list {
+		if err := approvePendingDevice(pending, productId, positionId, groupId, 0); err != nil {
+			log.Printf("设备 %s 注册失败: %v", pending.Name, err)
+			failed++
+			continue
+		}
+		succeeded++
+	}
+	return succeeded, failed, nil
+}
+
+// Ignore 忽略待审批设备，之后的上报不再记录
+func (s *ProvisionService) Ignore(tenantId int64, ids []int64) error {
+	_, err := orm.NewOrm().QueryTable(new(models.PendingDevice)).Filter("tenant_id", tenantId).
+		Filter("id__in", ids).Filter("status", models.PendingDeviceWaiting).
+		Update(orm.Params{"status": models.PendingDeviceIgnored, "modified": time.Now().Unix()})
+	return err
+}
+
+// DeletePending 删除待审批记录，设备再次上报时会重新出现
+func (s *ProvisionService) DeletePending(tenantId int64, ids []int64) error {
+	o := orm.NewOrm()
+	var list []*models.PendingDevice
+	qs := o.QueryTable(new(models.PendingDevice)).Filter("tenant_id", tenantId).Filter("id__in", ids)
+	if _, err := qs.All(&list, "Name"); err != nil {
+		return err
+	}
+	if _, err := qs.Delete(); err != nil {
+		return err
+	}
+	for _, pending := range list {
+		pendingSeen.Delete(pending.Name)
+	}
+	return nil
+}
+
+// ListRules 查询租户的自动注册规则
+func (s *ProvisionService) ListRules(tenantId int64, sn string) ([]*models.ProvisionRule, error) {
+	var rules []*models.ProvisionRule
+	qs := orm.NewOrm().QueryTable(new(models.ProvisionRule)).Filter("tenant_id", tenantId).RelatedSel("Product")
+	if sn != "" {
+		qs = qs.Filter("sn", sn)
+	}
+	if _, err := qs.OrderBy("-priority", "id").All(&rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.Product != nil {
+			rule.ProductId = rule.Product.Id
+			rule.ProductName = rule.Product.Name
+		}
+	}
+	return rules, nil
+}
+
+// SaveRule 新增或修改自动注册规则，保存后对现有待审批设备立即生效
+func (s *ProvisionService) SaveRule(tenantId int64, rule *models.ProvisionRule) error {
+	if rule.GWSN == "" {
+		return fmt.Errorf("网关SN不能为空")
+	}
+	if rule.Pattern == "" {
+		return fmt.Errorf("设备名称匹配规则不能为空")
+	}
+	if _, err := path.Match(rule.Pattern, ""); err != nil {
+		return fmt.Errorf("设备名称匹配规则无效: %v", err)
+	}
+
+	// 指定网关时须为本租户的网关，防止把其他租户网关下的设备注册到本租户
+	if rule.GWSN != "*" && gatewayTenant(rule.GWSN) != tenantId {
+		return fmt.Errorf("网关不存在或不属于当前租户")
+	}
+
+	o := orm.NewOrm()
+	product := models.Product{Id: rule.ProductId}
+	if err := o.Read(&product); err != nil || product.Department == nil || product.Department.Id != tenantId {
+		return fmt.Errorf("产品不存在或无操作权限")
+	}
+	rule.Product = &product
+	rule.Tenant = tenantId
+
+	if rule.Id > 0 {
+		old := models.ProvisionRule{Id: rule.Id}
+		if err := o.Read(&old); err != nil || old.Tenant != tenantId {
+			return fmt.Errorf("规则不存在或无操作权限")
+		}
+		rule.Created = old.Created
+		_ = rule.BeforeUpdate()
+		if _, err := o.Update(rule); err != nil {
+			return fmt.Errorf("保存规则失败: %v", err)
+		}
+	} else {
+		_ = rule.BeforeInsert()
+		if _, err := o.Insert(rule); err != nil {
+			return fmt.Errorf("保存规则失败: %v", err)
+		}
+	}
+
+	if rule.Enabled {
+		go s.applyRules(tenantId)
+	}
+	return nil
+}
+
+// applyRules 对租户下现有的待审批设备重新匹配规则
+func (s *ProvisionService) applyRules(tenantId int64) {
+	var list []*models.PendingDevice
+	_, err := orm.NewOrm().QueryTable(new(models.PendingDevice)).Filter("tenant_id", tenantId).
+		Filter("status", models.PendingDeviceWaiting).All(&list)
+	if err != nil {
+		log.Printf("查询待审批设备失败: %v", err)
+		return
+	}
+	for _, pending := range list {
+		tryAutoProvision(pending)
+	}
+}
+
+// DeleteRule 删除自动注册规则
+func (s *ProvisionService) DeleteRule(tenantId int64, ids []int64) error {
+	_, err := orm.NewOrm().QueryTable(new(models.ProvisionRule)).Filter("tenant_id", tenantId).Filter("id__in", ids).Delete()
+	return err
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"sort"
+	"time"
+)
+
+// 单个设备回测读取的最大数据点数，超出部分不参与回测
+var backtestMaxPoints = beego.AppConfig.DefaultInt("backtestMaxPoints", 100000)
+
+// RuleBacktestService 告警规则回测
+type RuleBacktestService struct{}
+
+// backtestPoint 回测数据点，聚合触发时为一个窗口
+type backtestPoint struct {
+	Dn    string
+	Time  int64 // 毫秒，聚合触发为窗口结束时间
+	Value interface{}
+}
+
+// BacktestAlert 回测期间会产生的一条告警
+type BacktestAlert struct {
+	Dn          string `json:"dn"`
+	Time        int64  `json:"time"`        // 触发时间(毫秒)
+	Value       string `json:"value"`       // 触发值
+	Occurrences int    `json:"occurrences"` // 未恢复期间累计触发次数
+	Recovered   int64  `json:"recovered"`   // 恢复时间(毫秒)，0为回测结束时仍未恢复
+}
+
+// BacktestResult 回测结果
+type BacktestResult struct {
+	Points     int              `json:"points"`     // 参与判断的数据点或窗口数
+	Hits       int              `json:"hits"`       // 满足判断条件的次数
+	Fired      int              `json:"fired"`      // 产生的告警数
+	Folded     int              `json:"folded"`     // 告警未恢复而累加的次数
+	Silenced   int              `json:"silenced"`   // 静默期内跳过的次数
+	Incomplete bool             `json:"incomplete"` // 数据点超出上限，结果不完整
+	Truncated  bool             `json:"truncated"`  // 告警明细超出返回条数
+	Alerts     []*BacktestAlert `json:"alerts"`
+}
+
+// simulateBacktest 按时间顺序重放数据点，与告警回调一致：
+// 未恢复的告警只累加次数，新告警需超过规则静默时间；原始值不再满足条件即恢复，聚合触发连续两个周期未命中恢复
+func simulateBacktest(points []backtestPoint, cond string, silence, window int64, limit int) *BacktestResult {
+	result := &BacktestResult{Alerts: []*BacktestAlert{}}
+	open := make(map[string]*BacktestAlert)
+	lastHit := make(map[string]int64)
+	lastFired := int64(-1)
+	for _, p := range points {
+		alert := open[p.Dn]
+		if alert != nil && window > 0 && p.Time-lastHit[p.Dn] > 2*window {
+			alert.Recovered = lastHit[p.Dn] + 2*window
+			delete(open, p.Dn)
+			alert = nil
+		}
+		matched, ok := evalDecideCondition(cond, p.Value)
+		if !ok {
+			continue
+		}
+		result.Points++
+		if !matched {
+			if alert != nil && window == 0 {
+				alert.Recovered = p.Time
+				delete(open, p.Dn)
+			}
+			continue
+		}
+		result.Hits++
+		lastHit[p.Dn] = p.Time
+		if alert != nil {
+			alert.Occurrences++
+			result.Folded++
+			continue
+		}
+		if silence > 0 && lastFired >= 0 && p.Time-lastFired < silence {
+			result.Silenced++
+			continue
+		}
+		alert = &BacktestAlert{Dn: p.Dn, Time: p.Time, Value: InterfaceToString(p.Value), Occurrences: 1}
+		open[p.Dn] = alert
+		lastFired = p.Time
+		result.Fired++
+		if len(result.Alerts) < limit {
+			result.Alerts = append(result.Alerts, alert)
+		} else {
+			result.Truncated = true
+		}
+	}
+	return result
+}
+
+// queryBacktestPoints 读取设备在时间范围内的历史值，聚合触发按周期在 TDengine 中聚合
+func queryBacktestPoints(t *TDengineService, productKey, dn, code, valueType string, window int64, start, end time.Time) ([]backtestPoint, bool, error) {
+	var query string
+	if window > 0 {
+		query = fmt.Sprintf("SELECT _wend, %s(`%s`) FROM %s.`%s` WHERE tbname = '%s' AND ts >= %d AND ts < %d INTERVAL(%ds) LIMIT %d",
+			valueType, code, DBName, productKey, dn, start.UnixMilli(), end.UnixMilli(), window/1000, backtestMaxPoints+1)
+	} else {
+		query = fmt.Sprintf("SELECT `ts`, `%s` FROM %s.`%s` WHERE tbname = '%s' AND ts >= %d AND ts <= %d AND `%s` IS NOT NULL ORDER BY ts ASC LIMIT %d",
+			code, DBName, productKey, dn, start.UnixMilli(), end.UnixMilli(), code, backtestMaxPoints+1)
+	}
+	utils.DebugLog("%s", query)
+	rows, err := t.db.Query(query)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	var points []backtestPoint
+	for rows.Next() {
+		var ts time.Time
+		var value interface{}
+		if err := rows.Scan(&ts, &value); err != nil {
+			logs.Warn("扫描设备 %s 回测数据失败: %v", dn, err)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		points = append(points, backtestPoint{Dn: dn, Time: ts.UnixMilli(), Value: value})
+	}
+	if len(points) > backtestMaxPoints {
+		return points[:backtestMaxPoints], true, rows.Err()
+	}
+	return points, false, rows.Err()
+}
+
+// Backtest 以历史数据回测设备数据触发子规则，返回时间范围内会产生的告警
+func (s *RuleBacktestService) Backtest(tenantId int64, req dtos.RuleBacktestRequest) (*BacktestResult, error) {
+	sub := req.SubRule
+	if sub.Trigger != string(constants.DeviceDataTrigger) {
+		return nil, fmt.Errorf("仅支持设备数据触发的子规则回测")
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04:05", req.StartTime, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("开始时间格式错误: %v", err)
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04:05", req.EndTime, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("结束时间格式错误: %v", err)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+
+	o := orm.NewOrm()
+	var property models.Properties
+	if err = o.QueryTable(new(models.Properties)).Filter("code", sub.Option["code"]).Filter("product_id", sub.ProductId).One(&property); err != nil {
+		return nil, fmt.Errorf("属性类型不存在")
+	}
+	var specs map[string]string
+	if err = json.Unmarshal([]byte(property.TypeSpec), &specs); err != nil {
+		return nil, fmt.Errorf("属性类型有误")
+	}
+	// 与配置规则相同的校验
+	check := dtos.RuleUpdateRequest{
+		Name:        "backtest",
+		Condition:   constants.WorkerConditionAnyone,
+		SubRule:     []models.SubRule{sub},
+		SilenceTime: req.SilenceTime,
+	}
+	if err = dtos.ValidateRuleUpdateRequest(&check, []string{specs["type"]}); err != nil {
+		return nil, err
+	}
+
+	var devices []*models.Device
+	if _, err = o.QueryTable(new(models.Device)).Filter("tenant_id", tenantId).Filter("name__in", sub.DeviceId).All(&devices); err != nil {
+		return nil, fmt.Errorf("查询设备失败: %v", err)
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("设备不存在")
+	}
+
+	// 文本、布尔类型只按原始值触发
+	valueType := sub.Option["value_type"]
+	var window int64
+	if valueType != string(constants.Original) && (specs["type"] == "int" || specs["type"] == "float") {
+		window = int64(windowSeconds(sub.Option["value_cycle"])) * 1000
+	}
+
+	t, err := NewTDengineService()
+	if err != nil {
+		return nil, fmt.Errorf("连接TDengine失败: %v", err)
+	}
+	defer t.Close()
+
+	var points []backtestPoint
+	incomplete := false
+	for _, device := range devices {
+		list, capped, err := queryBacktestPoints(t, device.CategoryKey, device.Name, sub.Option["code"], valueType, window, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("查询设备 %s 历史数据失败: %v", device.Name, err)
+		}
+		incomplete = incomplete || capped
+		points = append(points, list...)
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	result := simulateBacktest(points, sub.Option["decide_condition"], constants.ReturnSilenceTimestamp(req.SilenceTime), window, limit)
+	result.Incomplete = incomplete
+	return result, nil
+}
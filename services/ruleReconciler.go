@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/common"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eKuiper 规则与本地记录的核对间隔(秒)，0为仅启动时核对
+var ekuiperReconcileInterval = beego.AppConfig.DefaultInt("ekuiperReconcileInterval", 300)
+
+// 规则漂移类型
+const (
+	DriftMissing   = "missing"   // 本地有定义，eKuiper 中不存在
+	DriftStatus    = "status"    // 运行状态不一致
+	DriftOrphan    = "orphan"    // eKuiper 中的告警/场景/规则引擎规则在本地已不存在
+	DriftUnmanaged = "unmanaged" // eKuiper 中无法识别来源的规则，仅报告不处理
+)
+
+// RuleDrift 单条规则的漂移
+type RuleDrift struct {
+	RuleId string `json:"ruleId"` // eKuiper 规则ID
+	Kind   string `json:"kind"`   // alert/scene/engine，无法识别为空
+	Name   string `json:"name"`   // 本地规则、场景或规则引擎名称
+	Local  string `json:"local"`  // 本地状态
+	Remote string `json:"remote"` // eKuiper 状态，不存在为空
+	Issue  string `json:"issue"`
+	Action string `json:"action"` // 已执行的修复：recreated/started/stopped/deleted，未修复为空
+	Error  string `json:"error,omitempty"`
+}
+
+// ReconcileReport 一次核对结果
+type ReconcileReport struct {
+	Time   int64        `json:"time"`   // 核对时间(毫秒)
+	Fix    bool         `json:"fix"`    // 是否执行修复
+	Local  int          `json:"local"`  // 本地应存在的 eKuiper 规则数
+	Remote int          `json:"remote"` // eKuiper 中的规则数
+	Drifts []*RuleDrift `json:"drifts"`
+}
+
+// RuleReconcileService 本地规则与 eKuiper 规则核对
+type RuleReconcileService struct{}
+
+// managedRule 本地记录对应的一条 eKuiper 规则
+type managedRule struct {
+	id      string
+	kind    string
+	name    string
+	running bool
+	create  func(ctx context.Context) error
+}
+
+var lastReconcile = struct {
+	sync.Mutex
+	report *ReconcileReport
+}{}
+
+// StartRuleReconciler 启动时核对一次，之后按间隔定期核对并修复
+func StartRuleReconciler() {
+	service := RuleReconcileService{}
+	if _, err := service.Reconcile(true); err != nil {
+		logs.Error("eKuiper 规则核对失败: %v", err)
+	}
+	if ekuiperReconcileInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(ekuiperReconcileInterval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := service.Reconcile(true); err != nil {
+			logs.Error("eKuiper 规则核对失败: %v", err)
+		}
+	}
+}
+
+// alertCallbackUrl 告警回调地址，与配置告警规则时一致
+func alertCallbackUrl() string {
+	if common.LocalHost != "" {
+		return "http://" + common.LocalHost + ":" + common.Port + "/api/ekuiper/callback"
+	}
+	return common.CallBackUrl + "/api/ekuiper/callback"
+}
+
+// managedRules 按本地告警规则、场景、规则引擎列出应存在的 eKuiper 规则
+func managedRules(o orm.Ormer) ([]*managedRule, error) {
+	var rules []*managedRule
+	running := string(constants.RuleStart)
+
+	var alertRules []*models.AlertRule
+	if _, err := o.QueryTable(new(models.AlertRule)).All(&alertRules); err != nil {
+		return nil, fmt.Errorf("查询告警规则失败: %v", err)
+	}
+	for _, rule := range alertRules {
+		subRules := rule.SubRules()
+		req := dtos.RuleUpdateRequest{Name: rule.Name, SubRule: subRules}
+		for i, sub := range subRules {
+			index, sub := i, sub
+			id := models.AlertEkuiperRuleId(rule.Name, i)
+			rules = append(rules, &managedRule{
+				id:      id,
+				kind:    streamAlert,
+				name:    rule.Name,
+				running: rule.Status == running,
+				create: func(ctx context.Context) error {
+					dataType := ""
+					if sub.Trigger == string(constants.DeviceDataTrigger) {
+						var property models.Properties
+						if err := o.QueryTable(new(models.Properties)).Filter("code", sub.Option["code"]).Filter("product_id", sub.ProductId).One(&property); err != nil {
+							return fmt.Errorf("子规则%d属性类型不存在", index+1)
+						}
+						var specs map[string]string
+						if err := json.Unmarshal([]byte(property.TypeSpec), &specs); err != nil {
+							return fmt.Errorf("子规则%d属性类型有误", index+1)
+						}
+						dataType = specs["type"]
+					}
+					sql := req.BuildSubRuleSql(index, dataType)
+					if sql == "" {
+						return fmt.Errorf("子规则%d SQL 生成失败", index+1)
+					}
+					return common.Ekuiper.CreateRule(ctx, common.GetRuleAlertEkuiperActions(alertCallbackUrl()), id, sql)
+				},
+			})
+		}
+	}
+
+	var scenes []*models.Scene
+	if _, err := o.QueryTable(new(models.Scene)).All(&scenes); err != nil {
+		return nil, fmt.Errorf("查询场景失败: %v", err)
+	}
+	for _, scene := range scenes {
+		var conditions []dtos.Condition
+		if err := json.Unmarshal([]byte(scene.Condition), &conditions); err != nil {
+			continue
+		}
+		if trigger, ok := dtos.SceneTrigger(conditions); !ok || trigger.ConditionType != string(constants.ConditionTypeNotify) {
+			continue
+		}
+		name := scene.Name
+		rules = append(rules, &managedRule{
+			id:      name,
+			kind:    streamScene,
+			name:    name,
+			running: scene.Status == running,
+			create: func(ctx context.Context) error {
+				return BuildEkuiperRule(ctx, dtos.SceneUpdateRequest{Condition: conditions}, name)
+			},
+		})
+	}
+
+	var engines []*models.RuleEngine
+	if _, err := o.QueryTable(new(models.RuleEngine)).All(&engines); err != nil {
+		return nil, fmt.Errorf("查询规则引擎失败: %v", err)
+	}
+	for _, engine := range engines {
+		var filter dtos.Filters
+		if err := json.Unmarshal([]byte(engine.Filter), &filter); err != nil || strings.TrimSpace(filter.SQL) == "" {
+			continue
+		}
+		id := engine.Name + "__Engine"
+		rules = append(rules, &managedRule{
+			id:      id,
+			kind:    streamEngine,
+			name:    engine.Name,
+			running: engine.Status == running,
+			create: func(ctx context.Context) error {
+				actions := common.GetRuleAlertEkuiperActions(common.CallBackUrl + "/api/ekuiper/callback3")
+				return common.Ekuiper.CreateRule(ctx, actions, id, filter.SQL)
+			},
+		})
+	}
+	return rules, nil
+}
+
+// sceneCallbackPath 场景规则的回调路径，与 BuildEkuiperRule 一致
+const sceneCallbackPath = "/api/ekuiper/callback2"
+
+// isSceneRule 场景规则ID即场景名称，无固定后缀，按规则动作是否回调场景接口识别
+func isSceneRule(ctx context.Context, ruleId string) bool {
+	rule, err := common.Ekuiper.GetRule(ctx, ruleId)
+	if err != nil {
+		return false
+	}
+	actions, _ := rule["actions"].([]interface{})
+	for _, action := range actions {
+		action, _ := action.(map[string]interface{})
+		rest, _ := action["rest"].(map[string]interface{})
+		if url, _ := rest["url"].(string); strings.HasSuffix(url, sceneCallbackPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// localStatus 本地状态描述
+func localStatus(running bool) string {
+	if running {
+		return string(constants.RuleStart)
+	}
+	return string(constants.RuleStop)
+}
+
+// Reconcile 比对本地记录与 eKuiper 规则，fix 为 true 时重建缺失规则、同步运行状态并删除孤立规则
+func (s *RuleReconcileService) Reconcile(fix bool) (*ReconcileReport, error) {
+	if common.UseBuiltinStream() {
+		return nil, fmt.Errorf("当前使用内置流规则计算，无需核对 eKuiper")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	remoteRules, err := common.Ekuiper.GetAllRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("查询 eKuiper 规则失败: %v", err)
+	}
+	remote := make(map[string]string, len(remoteRules))
+	for _, r := range remoteRules {
+		remote[r.Id] = r.Status
+	}
+	locals, err := managedRules(orm.NewOrm())
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{Time: time.Now().UnixMilli(), Fix: fix, Local: len(locals), Remote: len(remoteRules), Drifts: []*RuleDrift{}}
+	known := make(map[string]bool, len(locals))
+	for _, local := range locals {
+		known[local.id] = true
+		status, exists := remote[local.id]
+		remoteRunning := strings.HasPrefix(strings.ToLower(status), "running")
+		if exists && remoteRunning == local.running {
+			continue
+		}
+		drift := &RuleDrift{RuleId: local.id, Kind: local.kind, Name: local.name, Local: localStatus(local.running), Remote: status, Issue: DriftStatus}
+		if !exists {
+			drift.Issue = DriftMissing
+		}
+		report.Drifts = append(report.Drifts, drift)
+		if !fix {
+			continue
+		}
+		switch {
+		case !exists:
+			if err = local.create(ctx); err == nil && local.running {
+				err = common.Ekuiper.StartRule(ctx, local.id)
+			}
+			drift.Action = "recreated"
+		case local.running:
+			err = common.Ekuiper.StartRule(ctx, local.id)
+			drift.Action = "started"
+		default:
+			err = common.Ekuiper.StopRule(ctx, local.id)
+			drift.Action = "stopped"
+		}
+		if err != nil {
+			drift.Action = ""
+			drift.Error = err.Error()
+		}
+	}
+
+	for _, r := range remoteRules {
+		if known[r.Id] {
+			continue
+		}
+		drift := &RuleDrift{RuleId: r.Id, Remote: r.Status, Issue: DriftUnmanaged}
+		switch {
+		case strings.Contains(r.Id, "__Rule"):
+			drift.Kind, drift.Issue = streamAlert, DriftOrphan
+			drift.Name, _ = models.ParseAlertEkuiperRuleId(r.Id)
+		case strings.HasSuffix(r.Id, "__Engine"):
+			drift.Kind, drift.Issue = streamEngine, DriftOrphan
+			drift.Name = strings.TrimSuffix(r.Id, "__Engine")
+		case isSceneRule(ctx, r.Id):
+			// 场景已删除或已不再由设备触发
+			drift.Kind, drift.Issue = streamScene, DriftOrphan
+			drift.Name = r.Id
+		}
+		report.Drifts = append(report.Drifts, drift)
+		if fix && drift.Issue == DriftOrphan {
+			if err := common.Ekuiper.DeleteRule(ctx, r.Id); err != nil {
+				drift.Error = err.Error()
+			} else {
+				drift.Action = "deleted"
+			}
+		}
+	}
+
+	if len(report.Drifts) > 0 {
+		logs.Warn("eKuiper 规则核对发现 %d 处不一致", len(report.Drifts))
+	}
+	lastReconcile.Lock()
+	lastReconcile.report = report
+	lastReconcile.Unlock()
+	return report, nil
+}
+
+// LastReport 最近一次核对结果，未核对过返回 nil
+func (s *RuleReconcileService) LastReport() *ReconcileReport {
+	lastReconcile.Lock()
+	defer lastReconcile.Unlock()
+	return lastReconcile.report
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	beego "github.com/beego/beego/v2/server/web"
+	"io"
+	"iotServer/common"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 场景等待动作的最大秒数
+var sceneMaxDelay = beego.AppConfig.DefaultInt("sceneMaxDelay", 3600)
+
+// 场景 webhook 动作的请求超时
+const sceneWebhookTimeout = 10 * time.Second
+
+// ValidateSceneActions 校验场景动作配置
+func ValidateSceneActions(actions []dtos.Action) error {
+	return validateSceneActions(actions, "")
+}
+
+func validateSceneActions(actions []dtos.Action, prefix string) error {
+	for i, action := range actions {
+		path := sceneActionPath(prefix, i)
+		if err := validateSceneAction(action, path); err != nil {
+			return fmt.Errorf("动作%s: %v", path, err)
+		}
+		for j, branch := range action.Branches {
+			if err := validateSceneActions(branch, path+"."+strconv.Itoa(j)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSceneAction(action dtos.Action, path string) error {
+	if !constants.IsSceneActionTypeValid(action.Type) {
+		return fmt.Errorf("非法的动作类型: %s", action.Type)
+	}
+	switch sceneActionType(action) {
+	case constants.SceneActionProperty:
+		if action.DeviceName == "" || action.Code == "" {
+			return fmt.Errorf("设备名称和属性不能为空")
+		}
+	case constants.SceneActionDelay:
+		if action.Delay <= 0 || action.Delay > sceneMaxDelay {
+			return fmt.Errorf("等待时间须在1~%d秒之间", sceneMaxDelay)
+		}
+	case constants.SceneActionNotify:
+		if len(action.Notify) == 0 {
+			return fmt.Errorf("通知方式不能为空")
+		}
+		if action.Content == "" {
+			return fmt.Errorf("通知内容不能为空")
+		}
+		for _, notify := range action.Notify {
+			if err := dtos.ValidateNotify(notify); err != nil {
+				return err
+			}
+		}
+	case constants.SceneActionWebhook:
+		u, err := url.Parse(action.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("请求地址须为 http/https 地址")
+		}
+		switch strings.ToUpper(action.Method) {
+		case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return fmt.Errorf("不支持的请求方法: %s", action.Method)
+		}
+	case constants.SceneActionScene, constants.SceneActionAlertRule:
+		if action.Target == "" {
+			return fmt.Errorf("目标名称不能为空")
+		}
+		if action.Operation != "start" && action.Operation != "stop" {
+			return fmt.Errorf("操作必须为 start 或 stop")
+		}
+	case constants.SceneActionService:
+		if action.DeviceName == "" || action.Service == "" {
+			return fmt.Errorf("设备名称和服务标识不能为空")
+		}
+	case constants.SceneActionParallel:
+		if len(action.Branches) == 0 {
+			return fmt.Errorf("并行分支不能为空")
+		}
+		for j, branch := range action.Branches {
+			if len(branch) == 0 {
+				return fmt.Errorf("分支%s.%d没有动作", path, j)
+			}
+		}
+	}
+	return nil
+}
+
+// sceneActionType 动作类型，为空按写设备属性处理
+func sceneActionType(action dtos.Action) constants.SceneActionType {
+	if action.Type == "" {
+		return constants.SceneActionProperty
+	}
+	return constants.SceneActionType(action.Type)
+}
+
+// sceneActionPath 动作位置，顶层为序号，并行分支内为 动作.分支.动作
+func sceneActionPath(prefix string, index int) string {
+	if prefix == "" {
+		return strconv.Itoa(index)
+	}
+	return prefix + "." + strconv.Itoa(index)
+}
+
+// sceneRun 一次场景执行，并行分支共享执行结果
+type sceneRun struct {
+	scene    *models.Scene
+	userId   int64
+	tenantId int64
+
+	mu       sync.Mutex
+	results  []dtos.SceneActionResult
+	index    map[string]int // 动作位置 -> 结果下标
+	firstErr error
+	abort    chan struct{} // 未配置继续执行时，首个失败即关闭，中止所有分支
+	aborted  bool
+}
+
+func newSceneRun(scene *models.Scene, userId, tenantId int64, actions []dtos.Action) *sceneRun {
+	r := &sceneRun{scene: scene, userId: userId, tenantId: tenantId, index: make(map[string]int), abort: make(chan struct{})}
+	r.prepare(actions, "")
+	return r
+}
+
+// prepare 按执行顺序为每个动作预置未执行的结果，并行动作只记录其分支内的动作
+func (r *sceneRun) prepare(actions []dtos.Action, prefix string) {
+	for i, action := range actions {
+		path := sceneActionPath(prefix, i)
+		kind := sceneActionType(action)
+		if kind == constants.SceneActionParallel {
+			for j, branch := range action.Branches {
+				r.prepare(branch, path+"."+strconv.Itoa(j))
+			}
+			continue
+		}
+		result := dtos.SceneActionResult{
+			Index:      len(r.results),
+			Path:       path,
+			Type:       string(kind),
+			DeviceName: action.DeviceName,
+			Code:       action.Code,
+			Value:      action.Value,
+			Status:     models.SceneActionSkipped,
+		}
+		switch kind {
+		case constants.SceneActionDelay:
+			result.Value = strconv.Itoa(action.Delay)
+		case constants.SceneActionNotify:
+			result.Value = action.Title
+		case constants.SceneActionWebhook:
+			result.Value = action.Url
+		case constants.SceneActionScene, constants.SceneActionAlertRule:
+			result.Code, result.Value = action.Operation, action.Target
+		case constants.SceneActionService:
+			result.Code, result.Value = action.Service, ""
+			if len(action.Params) > 0 {
+				params, _ := json.Marshal(action.Params)
+				result.Value = string(params)
+			}
+		}
+		r.index[path] = len(r.results)
+		r.results = append(r.results, result)
+	}
+}
+
+// stopped 是否已因失败中止
+func (r *sceneRun) stopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.aborted
+}
+
+// record 记录动作结果，失败且未配置继续执行时中止后续动作
+func (r *sceneRun) record(path, status, seq string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.index[path]
+	if !ok {
+		return
+	}
+	r.results[i].Status = status
+	r.results[i].Seq = seq
+	if err == nil {
+		return
+	}
+	r.results[i].Status = models.WriteLogFail
+	r.results[i].Error = err.Error()
+	if r.firstErr == nil {
+		r.firstErr = fmt.Errorf("动作%s执行失败: %v", path, err)
+	}
+	if !r.scene.ContinueOnError && !r.aborted {
+		r.aborted = true
+		close(r.abort)
+	}
+}
+
+// runSequence 按顺序执行动作，并行动作的各分支同时执行，全部结束后继续
+func (r *sceneRun) runSequence(actions []dtos.Action, prefix string) {
+	for i, action := range actions {
+		if r.stopped() {
+			return
+		}
+		path := sceneActionPath(prefix, i)
+		if sceneActionType(action) == constants.SceneActionParallel {
+			var wg sync.WaitGroup
+			for j, branch := range action.Branches {
+				wg.Add(1)
+				go func(branch []dtos.Action, prefix string) {
+					defer wg.Done()
+					defer func() {
+						if rec := recover(); rec != nil {
+							logs.Error("场景 %s 分支 %s 执行异常: %v", r.scene.Name, prefix, rec)
+						}
+					}()
+					r.runSequence(branch, prefix)
+				}(branch, path+"."+strconv.Itoa(j))
+			}
+			wg.Wait()
+			continue
+		}
+		status, seq, err := r.runAction(action)
+		r.record(path, status, seq, err)
+	}
+}
+
+// runAction 执行单个动作，返回结果状态及控制命令或服务调用序号
+func (r *sceneRun) runAction(action dtos.Action) (string, string, error) {
+	switch sceneActionType(action) {
+	case constants.SceneActionProperty:
+		// 记录到设备影子的期望状态
+		if _, err := setShadowDesired(action.DeviceName, map[string]interface{}{action.Code: action.Value}, 0); err != nil {
+			log.Printf("更新设备影子失败: %v", err)
+		}
+		// 调用设备控制接口，下发失败时 Deal 已将控制记录置为失败
+		seq, err := Processor.Deal(action.DeviceName, action.Code, action.Value, "场景控制", r.userId, r.tenantId)
+		if err != nil {
+			return "", seq, fmt.Errorf("设备控制失败: %v", err)
+		}
+		return models.WriteLogWait, seq, nil
+	case constants.SceneActionDelay:
+		select {
+		case <-time.After(time.Duration(action.Delay) * time.Second):
+			return models.WriteLogSuccess, "", nil
+		case <-r.abort:
+			return models.SceneActionSkipped, "", nil
+		}
+	case constants.SceneActionNotify:
+		return models.WriteLogSuccess, "", r.notify(action)
+	case constants.SceneActionWebhook:
+		return models.WriteLogSuccess, "", sceneWebhook(action)
+	case constants.SceneActionScene:
+		return models.WriteLogSuccess, "", r.operateScene(action.Target, action.Operation)
+	case constants.SceneActionAlertRule:
+		return models.WriteLogSuccess, "", r.operateAlertRule(action.Target, action.Operation)
+	case constants.SceneActionService:
+		invoke, err := (&InvokeService{}).Invoke(r.tenantId, r.userId, dtos.InvokeRequest{Name: action.DeviceName, Service: action.Service, Params: action.Params})
+		if err != nil {
+			return "", "", err
+		}
+		if invoke.Status == models.WriteLogFail || invoke.Status == models.WriteLogTimeout {
+			return "", invoke.Seq, fmt.Errorf("服务调用%s: %s", invoke.Status, invoke.Error)
+		}
+		return invoke.Status, invoke.Seq, nil
+	}
+	return "", "", fmt.Errorf("非法的动作类型: %s", action.Type)
+}
+
+// notify 通过告警通知方式发送场景通知，任一通知方式失败即为失败
+func (r *sceneRun) notify(action dtos.Action) error {
+	var configs []map[string]interface{}
+	raw, _ := json.Marshal(action.Notify)
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return fmt.Errorf("通知方式解析失败: %v", err)
+	}
+	title := action.Title
+	if title == "" {
+		title = "【场景通知】" + r.scene.Name
+	}
+	msg := notifyMessage{Title: title, Content: action.Content, Format: models.NotifyFormatText}
+
+	o := orm.NewOrm()
+	now := time.Now()
+	service := &AlertService{}
+	var failed []string
+	for _, notifyConfig := range configs {
+		name, _ := notifyConfig["name"].(string)
+		if ok, reason := notifyInEffect(o, r.tenantId, notifyConfig, now); !ok {
+			logs.Info("场景 %s 通知 %s: %s，跳过发送", r.scene.Name, name, reason)
+			continue
+		}
+		if recipients := notifyRecipients(notifyConfig); len(recipients) > 0 {
+			notifyConfig = applyRecipients(notifyConfig, resolveRecipients(o, r.tenantId, recipients, now))
+		}
+		if _, err := service.dispatchNotify(msg, notifyConfig, nil); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("通知发送失败: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// sceneWebhook 调用 HTTP 接口，响应状态码非 2xx 为失败
+func sceneWebhook(action dtos.Action) error {
+	method := strings.ToUpper(action.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, strings.TrimSpace(action.Url), strings.NewReader(action.Body))
+	if err != nil {
+		return fmt.Errorf("构造请求失败: %v", err)
+	}
+	if action.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range action.Headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: sceneWebhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("响应状态 %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// operateScene 启动或停止同租户下的场景，已处于目标状态视为成功
+func (r *sceneRun) operateScene(name, operation string) error {
+	o := orm.NewOrm()
+	var scene models.Scene
+	if err := o.QueryTable(new(models.Scene)).Filter("name", name).Filter("department_id", r.tenantId).One(&scene); err != nil {
+		return fmt.Errorf("场景 %s 不存在或无操作权限", name)
+	}
+	if operation == "start" {
+		if scene.Status == string(constants.RuleStart) {
+			return nil
+		}
+		return GlobalSceneService.StartScene(scene.Id, r.userId)
+	}
+	if scene.Status != string(constants.RuleStart) {
+		return nil
+	}
+	return GlobalSceneService.StopScene(scene.Id, r.userId)
+}
+
+// operateAlertRule 启动或停止同租户下的告警规则及其全部子规则
+func (r *sceneRun) operateAlertRule(name, operation string) error {
+	o := orm.NewOrm()
+	rule := models.AlertRule{Name: name}
+	if err := o.Read(&rule, "Name"); err != nil || rule.Department == nil || rule.Department.Id != r.tenantId {
+		return fmt.Errorf("告警规则 %s 不存在或无操作权限", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	operate, status := common.Ekuiper.StartRule, string(constants.RuleStart)
+	if operation == "stop" {
+		operate, status = common.Ekuiper.StopRule, string(constants.RuleStop)
+	}
+	for _, ruleId := range rule.EkuiperRuleIds() {
+		if err := operate(ctx, ruleId); err != nil {
+			return fmt.Errorf("告警规则 %s 操作失败: %v", ruleId, err)
+		}
+	}
+	rule.Status = status
+	rule.BeforeUpdate()
+	if _, err := o.Update(&rule, "Status", "Modified"); err != nil {
+		return fmt.Errorf("更新告警规则状态失败: %v", err)
+	}
+	return nil
+}
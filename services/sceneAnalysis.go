@@ -0,0 +1,319 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 启动场景时发现循环触发、冲突写入的处理方式：reject 拒绝启动，warn 仅提示
+var (
+	sceneLoopPolicy     = beego.AppConfig.DefaultString("sceneLoopPolicy", SceneIssueReject)
+	sceneConflictPolicy = beego.AppConfig.DefaultString("sceneConflictPolicy", SceneIssueWarn)
+)
+
+// 单个场景每分钟最多执行次数(手动执行不计)，0为不限制
+var sceneMaxRunsPerMinute = beego.AppConfig.DefaultInt("sceneMaxRunsPerMinute", 30)
+
+// 场景问题类型
+const (
+	SceneIssueLoop     = "loop"     // 场景动作写入的属性会再次触发自身或形成触发环
+	SceneIssueConflict = "conflict" // 多个运行中的场景向同一属性写入不同的值
+)
+
+// 场景问题处理方式
+const (
+	SceneIssueReject = "reject"
+	SceneIssueWarn   = "warn"
+)
+
+// SceneIssue 场景静态分析发现的问题
+type SceneIssue struct {
+	Kind    string   `json:"kind"`    // loop/conflict
+	Level   string   `json:"level"`   // reject/warn
+	Scenes  []string `json:"scenes"`  // 涉及的场景，循环时按触发顺序
+	Target  string   `json:"target"`  // 设备.属性
+	Message string   `json:"message"` // 问题描述
+}
+
+// SceneAnalysis 场景与租户内运行中场景的触发关系分析结果
+type SceneAnalysis struct {
+	SceneId  int64         `json:"sceneId"`
+	Rejected bool          `json:"rejected"` // 存在需拒绝启动的问题
+	Issues   []*SceneIssue `json:"issues"`
+}
+
+// sceneWrite 场景动作写入的属性
+type sceneWrite struct {
+	keys     []string // 设备名称.属性、设备ID.属性
+	value    string
+	path     string
+	parallel string // 所在并行动作的位置，顶层为空
+	branch   string // 所在并行分支
+}
+
+// sceneNode 触发关系图中的场景
+type sceneNode struct {
+	scene     models.Scene
+	trigger   string // 设备数据触发的 设备.属性，其他触发方式为空
+	condition string // 设备数据触发的判断条件
+	aggregate bool   // 按周期聚合值触发
+	writes    []sceneWrite
+}
+
+// sceneWrites 列出动作中的属性写入，含并行分支
+func sceneWrites(actions []dtos.Action, prefix, parallel, branch string) []sceneWrite {
+	var writes []sceneWrite
+	for i, action := range actions {
+		path := sceneActionPath(prefix, i)
+		switch sceneActionType(action) {
+		case constants.SceneActionProperty:
+			w := sceneWrite{value: action.Value, path: path, parallel: parallel, branch: branch}
+			w.keys = append(w.keys, action.DeviceName+"."+action.Code)
+			if action.DeviceId != "" && action.DeviceId != action.DeviceName {
+				w.keys = append(w.keys, action.DeviceId+"."+action.Code)
+			}
+			writes = append(writes, w)
+		case constants.SceneActionParallel:
+			for j, b := range action.Branches {
+				branchPath := fmt.Sprintf("%s.%d", path, j)
+				writes = append(writes, sceneWrites(b, branchPath, path, branchPath)...)
+			}
+		}
+	}
+	return writes
+}
+
+// newSceneNode 解析场景的触发条件与属性写入
+func newSceneNode(scene models.Scene) *sceneNode {
+	node := &sceneNode{scene: scene}
+	var conditions []dtos.Condition
+	if err := json.Unmarshal([]byte(scene.Condition), &conditions); err == nil {
+		if trigger, ok := dtos.SceneTrigger(conditions); ok && trigger.ConditionType == string(constants.ConditionTypeNotify) &&
+			trigger.Option["trigger"] == string(constants.DeviceDataTrigger) {
+			node.trigger = trigger.Option["device_id"] + "." + trigger.Option["code"]
+			node.condition = trigger.Option["decide_condition"]
+			valueType := trigger.Option["value_type"]
+			node.aggregate = valueType != "" && valueType != string(constants.Original)
+		}
+	}
+	var actions []dtos.Action
+	if err := json.Unmarshal([]byte(scene.Action), &actions); err == nil {
+		node.writes = sceneWrites(actions, "", "", "")
+	}
+	return node
+}
+
+// triggers 写入是否会触发该场景，写入值不满足判断条件时不会触发；聚合触发无法静态判断，按会触发处理
+func (n *sceneNode) triggers(w sceneWrite) bool {
+	if n.trigger == "" {
+		return false
+	}
+	for _, key := range w.keys {
+		if key != n.trigger {
+			continue
+		}
+		if n.aggregate {
+			return true
+		}
+		matched, ok := evalDecideCondition(n.condition, w.value)
+		return matched || !ok
+	}
+	return false
+}
+
+// findSceneLoop 从 start 出发沿触发关系查找回到 start 的路径
+func findSceneLoop(nodes []*sceneNode, start int) ([]int, string) {
+	visited := make(map[int]bool)
+	var path []int
+	var target string
+	var dfs func(i int) bool
+	dfs = func(i int) bool {
+		path = append(path, i)
+		for _, w := range nodes[i].writes {
+			for j, next := range nodes {
+				if !next.triggers(w) {
+					continue
+				}
+				if j == start {
+					target = next.trigger
+					return true
+				}
+				if visited[j] {
+					continue
+				}
+				visited[j] = true
+				if dfs(j) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if dfs(start) {
+		return path, target
+	}
+	return nil, ""
+}
+
+// analyzeScenes 分析 nodes[0] 与其他运行中场景的循环触发及冲突写入
+func analyzeScenes(nodes []*sceneNode) *SceneAnalysis {
+	candidate := nodes[0]
+	analysis := &SceneAnalysis{SceneId: candidate.scene.Id, Issues: []*SceneIssue{}}
+	add := func(issue *SceneIssue) {
+		issue.Level = sceneIssueLevel(issue.Kind)
+		if issue.Level == SceneIssueReject {
+			analysis.Rejected = true
+		}
+		analysis.Issues = append(analysis.Issues, issue)
+	}
+
+	if path, target := findSceneLoop(nodes, 0); path != nil {
+		names := make([]string, 0, len(path)+1)
+		for _, i := range path {
+			names = append(names, nodes[i].scene.Name)
+		}
+		names = append(names, candidate.scene.Name)
+		message := fmt.Sprintf("场景动作写入 %s 会再次触发场景自身", target)
+		if len(path) > 1 {
+			message = fmt.Sprintf("场景之间形成触发环: %s", strings.Join(names, " → "))
+		}
+		add(&SceneIssue{Kind: SceneIssueLoop, Scenes: names, Target: target, Message: message})
+	}
+
+	// 同一并行动作的不同分支写入同一属性
+	for i, a := range candidate.writes {
+		for _, b := range candidate.writes[i+1:] {
+			if a.parallel == "" || a.parallel != b.parallel || a.branch == b.branch || a.keys[0] != b.keys[0] || a.value == b.value {
+				continue
+			}
+			add(&SceneIssue{
+				Kind:    SceneIssueConflict,
+				Scenes:  []string{candidate.scene.Name},
+				Target:  a.keys[0],
+				Message: fmt.Sprintf("并行分支 %s、%s 同时写入 %s 不同的值 %s/%s", a.branch, b.branch, a.keys[0], a.value, b.value),
+			})
+		}
+	}
+
+	// 与其他运行中场景写入同一属性的不同值
+	reported := make(map[string]bool)
+	for _, other := range nodes[1:] {
+		for _, a := range candidate.writes {
+			for _, b := range other.writes {
+				if a.keys[0] != b.keys[0] || a.value == b.value {
+					continue
+				}
+				key := other.scene.Name + "|" + a.keys[0]
+				if reported[key] {
+					continue
+				}
+				reported[key] = true
+				add(&SceneIssue{
+					Kind:    SceneIssueConflict,
+					Scenes:  []string{candidate.scene.Name, other.scene.Name},
+					Target:  a.keys[0],
+					Message: fmt.Sprintf("与运行中的场景 %s 向 %s 写入不同的值 %s/%s", other.scene.Name, a.keys[0], a.value, b.value),
+				})
+			}
+		}
+	}
+	return analysis
+}
+
+// sceneIssueLevel 按配置确定问题的处理方式
+func sceneIssueLevel(kind string) string {
+	policy := sceneConflictPolicy
+	if kind == SceneIssueLoop {
+		policy = sceneLoopPolicy
+	}
+	if policy == SceneIssueReject {
+		return SceneIssueReject
+	}
+	return SceneIssueWarn
+}
+
+// analyzeScene 以场景当前配置与租户内其他运行中的场景构建触发关系并分析
+func analyzeScene(o orm.Ormer, scene models.Scene, tenantId int64) (*SceneAnalysis, error) {
+	var running []models.Scene
+	if _, err := o.QueryTable(new(models.Scene)).Filter("department_id", tenantId).Filter("status", string(constants.RuleStart)).
+		Exclude("id", scene.Id).All(&running); err != nil {
+		return nil, fmt.Errorf("查询运行中的场景失败: %v", err)
+	}
+	nodes := []*sceneNode{newSceneNode(scene)}
+	for _, s := range running {
+		nodes = append(nodes, newSceneNode(s))
+	}
+	return analyzeScenes(nodes), nil
+}
+
+// AnalyzeScene 分析场景启动后与运行中场景的循环触发及冲突写入
+func (s *SceneService) AnalyzeScene(tenantId, id int64) (*SceneAnalysis, error) {
+	o := orm.NewOrm()
+	scene := models.Scene{Id: id}
+	if err := o.Read(&scene); err != nil || scene.Department == nil || scene.Department.Id != tenantId {
+		return nil, fmt.Errorf("scene not found or no permission")
+	}
+	return analyzeScene(o, scene, tenantId)
+}
+
+// sceneIssueError 汇总需拒绝启动的问题
+func sceneIssueError(analysis *SceneAnalysis) error {
+	var messages []string
+	for _, issue := range analysis.Issues {
+		if issue.Level == SceneIssueReject {
+			messages = append(messages, issue.Message)
+		}
+	}
+	return fmt.Errorf("场景存在问题，拒绝启动: %s", strings.Join(messages, "; "))
+}
+
+// sceneRates 场景每分钟执行次数
+var sceneRates = struct {
+	sync.Mutex
+	m map[int64]*sceneRate
+}{m: make(map[int64]*sceneRate)}
+
+type sceneRate struct {
+	minute  int64
+	count   int
+	limited bool // 本分钟是否已记录过限流
+}
+
+// allowSceneRun 按分钟计数，超过上限时拒绝执行，first 表示本分钟首次被限流
+func allowSceneRun(sceneId int64, now time.Time) (allowed, first bool) {
+	if sceneMaxRunsPerMinute <= 0 {
+		return true, false
+	}
+	minute := now.Unix() / 60
+	sceneRates.Lock()
+	defer sceneRates.Unlock()
+	rate := sceneRates.m[sceneId]
+	if rate == nil || rate.minute != minute {
+		rate = &sceneRate{minute: minute}
+		sceneRates.m[sceneId] = rate
+	}
+	if rate.count >= sceneMaxRunsPerMinute {
+		first = !rate.limited
+		rate.limited = true
+		return false, first
+	}
+	rate.count++
+	return true, false
+}
+
+// warnSceneIssues 记录允许启动的场景存在的问题
+func warnSceneIssues(scene models.Scene, analysis *SceneAnalysis) {
+	for _, issue := range analysis.Issues {
+		log.Printf("场景 %s: %s", scene.Name, issue.Message)
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidateSceneConditions 校验场景条件：有且仅有一个触发条件，限制条件参数完整
+func ValidateSceneConditions(conditions []dtos.Condition) error {
+	triggers := 0
+	for i, condition := range conditions {
+		switch constants.ConditionType(condition.ConditionType) {
+		case constants.ConditionTypeNotify:
+			triggers++
+		case constants.ConditionTypeTimer:
+			triggers++
+			if tz := condition.Option["time_zone"]; tz != "" {
+				if _, err := time.LoadLocation(tz); err != nil {
+					return fmt.Errorf("条件%d: 时区 %s 非法", i+1, tz)
+				}
+			}
+			if err := validateCalendarOption(condition.Option); err != nil {
+				return fmt.Errorf("条件%d: %v", i+1, err)
+			}
+		case constants.ConditionTypeTimeRange:
+			if _, _, err := parseSceneTimeRange(condition.Option); err != nil {
+				return fmt.Errorf("条件%d: %v", i+1, err)
+			}
+			if _, err := parseSceneWeekdays(condition.Option["weekdays"]); err != nil {
+				return fmt.Errorf("条件%d: %v", i+1, err)
+			}
+			if err := validateCalendarOption(condition.Option); err != nil {
+				return fmt.Errorf("条件%d: %v", i+1, err)
+			}
+		case constants.ConditionTypeDeviceState:
+			if condition.Option["device_name"] == "" || condition.Option["code"] == "" {
+				return fmt.Errorf("条件%d: 设备名称和属性不能为空", i+1)
+			}
+			if _, ok := evalDecideCondition(condition.Option["decide_condition"], 0); !ok {
+				return fmt.Errorf("条件%d: 判断条件格式错误: %s", i+1, condition.Option["decide_condition"])
+			}
+		default:
+			return fmt.Errorf("条件%d: 非法的条件类型: %s", i+1, condition.ConditionType)
+		}
+	}
+	if triggers != 1 {
+		return fmt.Errorf("场景须有且仅有一个定时或设备触发条件")
+	}
+	return nil
+}
+
+// calendarOption 条件引用的工作日历，day_type 为空表示工作日
+func calendarOption(option map[string]string) (int64, string, bool) {
+	id, err := strconv.ParseInt(option["calendar_id"], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", false
+	}
+	return id, option["day_type"], true
+}
+
+func validateCalendarOption(option map[string]string) error {
+	if option["calendar_id"] == "" {
+		return nil
+	}
+	if _, _, ok := calendarOption(option); !ok {
+		return fmt.Errorf("日历ID格式错误: %s", option["calendar_id"])
+	}
+	switch option["day_type"] {
+	case "", models.CalendarWorkday, models.CalendarHoliday:
+		return nil
+	}
+	return fmt.Errorf("日期类型必须为 workday 或 holiday")
+}
+
+// parseClock 解析 HH:MM 或 HH:MM:SS 为当天秒数
+func parseClock(value string) (int, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Hour()*3600 + t.Minute()*60 + t.Second(), nil
+		}
+	}
+	return 0, fmt.Errorf("时间格式错误: %s", value)
+}
+
+// parseSceneTimeRange 时间段的开始、结束秒数，结束早于开始表示跨天
+func parseSceneTimeRange(option map[string]string) (int, int, error) {
+	start, err := parseClock(option["start_time"])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(option["end_time"])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseSceneWeekdays 解析生效星期，0为周日，为空不限制
+func parseSceneWeekdays(value string) (map[time.Weekday]bool, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	days := make(map[time.Weekday]bool)
+	for _, item := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || day < 0 || day > 6 {
+			return nil, fmt.Errorf("星期格式错误: %s", item)
+		}
+		days[time.Weekday(day)] = true
+	}
+	return days, nil
+}
+
+// checkSceneGuards 按触发时刻校验全部限制条件及定时条件引用的日历，返回首个不满足的原因
+// 时间按租户时区计算，定时条件指定时区时其日历按该时区计算
+func checkSceneGuards(conditions []dtos.Condition, tenantId int64, now time.Time) (bool, string) {
+	o := orm.NewOrm()
+	local := now.In(tenantLocation(o, tenantId))
+	for _, condition := range conditions {
+		var ok bool
+		var reason string
+		switch constants.ConditionType(condition.ConditionType) {
+		case constants.ConditionTypeTimer:
+			calendarId, dayType, exists := calendarOption(condition.Option)
+			if !exists {
+				continue
+			}
+			at := local
+			if tz := condition.Option["time_zone"]; tz != "" {
+				if loc, err := time.LoadLocation(tz); err == nil {
+					at = now.In(loc)
+				}
+			}
+			ok, reason = checkCalendar(o, tenantId, calendarId, dayType, at)
+		case constants.ConditionTypeTimeRange:
+			if ok, reason = guardTimeRange(condition.Option, local); ok {
+				if calendarId, dayType, exists := calendarOption(condition.Option); exists {
+					ok, reason = checkCalendar(o, tenantId, calendarId, dayType, local)
+				}
+			}
+		case constants.ConditionTypeDeviceState:
+			ok, reason = guardDeviceState(condition.Option, tenantId)
+		default:
+			continue
+		}
+		if !ok {
+			return false, reason
+		}
+	}
+	return true, ""
+}
+
+// guardTimeRange 当前时间是否在生效星期及时间段内，跨天时间段的星期以开始当天为准
+func guardTimeRange(option map[string]string, now time.Time) (bool, string) {
+	start, end, err := parseSceneTimeRange(option)
+	if err != nil {
+		return false, err.Error()
+	}
+	days, err := parseSceneWeekdays(option["weekdays"])
+	if err != nil {
+		return false, err.Error()
+	}
+	clock := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	day := now.Weekday()
+	var in bool
+	if start <= end {
+		in = clock >= start && clock <= end
+	} else {
+		in = clock >= start || clock <= end
+		if clock <= end {
+			day = (day + 6) % 7
+		}
+	}
+	if !in {
+		return false, fmt.Sprintf("当前时间不在 %s~%s 内", option["start_time"], option["end_time"])
+	}
+	if days != nil && !days[day] {
+		return false, fmt.Sprintf("星期%d不在生效星期 %s 内", day, option["weekdays"])
+	}
+	return true, ""
+}
+
+// guardDeviceState 按设备影子中最新上报值判断属性条件
+func guardDeviceState(option map[string]string, tenantId int64) (bool, string) {
+	dn, code := option["device_name"], option["code"]
+	entry, err := loadShadow(dn)
+	if err != nil {
+		return false, err.Error()
+	}
+	entry.mu.Lock()
+	value, exists := entry.reported[code]
+	tenant := entry.model.Tenant
+	entry.mu.Unlock()
+	if tenant != tenantId {
+		return false, fmt.Sprintf("设备 %s 不存在或无权限", dn)
+	}
+	if !exists {
+		return false, fmt.Sprintf("设备 %s 属性 %s 尚无上报值", dn, code)
+	}
+	matched, ok := evalDecideCondition(option["decide_condition"], value)
+	if !ok {
+		return false, fmt.Sprintf("设备 %s 属性 %s 无法按 %s 判断", dn, code, option["decide_condition"])
+	}
+	if !matched {
+		return false, fmt.Sprintf("设备 %s 属性 %s 当前值 %s 不满足 %s", dn, code, InterfaceToString(value), option["decide_condition"])
+	}
+	return true, ""
+}
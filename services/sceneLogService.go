@@ -0,0 +1,172 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"iotServer/utils"
+	"time"
+)
+
+// startSceneLog 记录一次场景执行的开始
+func startSceneLog(o orm.Ormer, scene *models.Scene, source string) *models.SceneLog {
+	sceneLog := &models.SceneLog{
+		SceneId:   scene.Id,
+		Name:      scene.Name,
+		Source:    source,
+		Status:    models.SceneRunRunning,
+		StartTime: time.Now().UnixMilli(),
+	}
+	if scene.Department != nil {
+		sceneLog.Tenant = scene.Department.Id
+	}
+	_ = sceneLog.BeforeInsert()
+	if _, err := o.Insert(sceneLog); err != nil {
+		logs.Error("记录场景 %s 执行日志失败: %v", scene.Name, err)
+	}
+	return sceneLog
+}
+
+// sceneRunStatus 按动作结果汇总执行结果，仅继续执行模式下部分成功记为 partial
+func sceneRunStatus(results []dtos.SceneActionResult, continueOnError bool) (string, string) {
+	var sent, failed, skipped int
+	for _, result := range results {
+		switch result.Status {
+		case models.WriteLogFail:
+			failed++
+		case models.SceneActionSkipped:
+			skipped++
+		default:
+			sent++
+		}
+	}
+	message := fmt.Sprintf("共%d个动作，成功%d个，失败%d个，未执行%d个", len(results), sent, failed, skipped)
+	switch {
+	case failed == 0 && skipped == 0:
+		return models.SceneRunSuccess, message
+	case continueOnError && sent > 0:
+		return models.SceneRunPartial, message
+	default:
+		return models.SceneRunFailed, message
+	}
+}
+
+// finishSceneLog 记录场景执行结束，message 非空时表示执行前即失败
+func finishSceneLog(o orm.Ormer, sceneLog *models.SceneLog, results []dtos.SceneActionResult, continueOnError bool, message string) {
+	sceneLog.EndTime = time.Now().UnixMilli()
+	if message != "" {
+		sceneLog.Status = models.SceneRunFailed
+		sceneLog.ExecRes = message
+	} else {
+		sceneLog.Status, sceneLog.ExecRes = sceneRunStatus(results, continueOnError)
+	}
+	if results != nil {
+		actions, _ := json.Marshal(results)
+		sceneLog.Actions = string(actions)
+	}
+	if sceneLog.Id == 0 {
+		return
+	}
+	if _, err := o.Update(sceneLog, "Status", "EndTime", "ExecRes", "Actions"); err != nil {
+		logs.Error("更新场景执行日志 %d 失败: %v", sceneLog.Id, err)
+	}
+}
+
+// skipSceneLog 记录限制条件不满足而跳过的执行
+func skipSceneLog(o orm.Ormer, sceneLog *models.SceneLog, reason string) {
+	if sceneLog.Id == 0 {
+		return
+	}
+	sceneLog.EndTime = time.Now().UnixMilli()
+	sceneLog.Status = models.SceneRunSkipped
+	sceneLog.ExecRes = "限制条件不满足: " + reason
+	if _, err := o.Update(sceneLog, "Status", "EndTime", "ExecRes"); err != nil {
+		logs.Error("更新场景执行日志 %d 失败: %v", sceneLog.Id, err)
+	}
+}
+
+// SceneLogList 分页查询场景执行记录
+func (s *SceneService) SceneLogList(tenantId, sceneId int64, status, source string, page, size int) (*utils.PageResult, error) {
+	o := orm.NewOrm()
+	qs := o.QueryTable(new(models.SceneLog)).Filter("tenant_id", tenantId).OrderBy("-id")
+	if sceneId > 0 {
+		qs = qs.Filter("scene_id", sceneId)
+	}
+	if status != "" {
+		qs = qs.Filter("status", status)
+	}
+	if source != "" {
+		qs = qs.Filter("source", source)
+	}
+	var list []*models.SceneLog
+	return utils.Paginate(qs, page, size, &list)
+}
+
+// SceneLogDetail 场景执行详情，动作状态以控制记录或服务调用记录的最新状态为准
+func (s *SceneService) SceneLogDetail(tenantId, id int64) (*dtos.SceneLogDetailResponse, error) {
+	o := orm.NewOrm()
+	var sceneLog models.SceneLog
+	if err := o.QueryTable(new(models.SceneLog)).Filter("tenant_id", tenantId).Filter("id", id).One(&sceneLog); err != nil {
+		return nil, fmt.Errorf("场景执行记录不存在")
+	}
+	detail := &dtos.SceneLogDetailResponse{
+		SceneLogResponse: dtos.SceneLogResponse{
+			Id:      sceneLog.Id,
+			SceneId: sceneLog.SceneId,
+			Name:    sceneLog.Name,
+			ExecRes: sceneLog.ExecRes,
+			Created: sceneLog.Created,
+		},
+		Source:    sceneLog.Source,
+		Status:    sceneLog.Status,
+		StartTime: sceneLog.StartTime,
+		EndTime:   sceneLog.EndTime,
+		Actions:   []dtos.SceneActionResult{},
+	}
+	if sceneLog.Actions != "" {
+		if err := json.Unmarshal([]byte(sceneLog.Actions), &detail.Actions); err != nil {
+			return nil, fmt.Errorf("动作结果解析失败: %v", err)
+		}
+	}
+
+	var seqs, invokeSeqs []string
+	for _, action := range detail.Actions {
+		if action.Seq == "" {
+			continue
+		}
+		if action.Type == string(constants.SceneActionService) {
+			invokeSeqs = append(invokeSeqs, action.Seq)
+		} else {
+			seqs = append(seqs, action.Seq)
+		}
+	}
+	statuses := make(map[string]string, len(seqs)+len(invokeSeqs))
+	if len(seqs) > 0 {
+		var writeLogs []*models.WriteLog
+		if _, err := o.QueryTable(new(models.WriteLog)).Filter("seq__in", seqs).All(&writeLogs); err != nil {
+			return nil, fmt.Errorf("查询控制记录失败: %v", err)
+		}
+		for _, w := range writeLogs {
+			statuses[w.Seq] = w.Status
+		}
+	}
+	if len(invokeSeqs) > 0 {
+		var invokes []*models.ServiceInvoke
+		if _, err := o.QueryTable(new(models.ServiceInvoke)).Filter("seq__in", invokeSeqs).All(&invokes); err != nil {
+			return nil, fmt.Errorf("查询服务调用记录失败: %v", err)
+		}
+		for _, v := range invokes {
+			statuses[v.Seq] = v.Status
+		}
+	}
+	for i, action := range detail.Actions {
+		if status, ok := statuses[action.Seq]; ok {
+			detail.Actions[i].Status = status
+		}
+	}
+	return detail, nil
+}
@@ -14,6 +14,7 @@ import (
 	"iotServer/utils"
 	"log"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -35,6 +36,9 @@ func NewSceneService() *SceneService {
 	return &service
 }
 
+// GlobalSceneService 全局场景服务，场景动作启停其他场景时使用
+var GlobalSceneService = NewSceneService()
+
 // SceneList 获取场景列表
 func (s *SceneService) SceneList(req dtos.SceneQueryRequest) (*dtos.SceneListResponse, error) {
 	o := orm.NewOrm()
@@ -108,6 +112,16 @@ func (s *SceneService) StartScene(id, userId int64) error {
 		return fmt.Errorf("场景已在运行中，请停止后编辑")
 	}
 
+	// 分析与租户内运行中场景的循环触发、冲突写入
+	analysis, err := analyzeScene(o, scene, tenantId)
+	if err != nil {
+		return err
+	}
+	if analysis.Rejected {
+		return sceneIssueError(analysis)
+	}
+	warnSceneIssues(scene, analysis)
+
 	// 解析条件，加载定时场景
 	if err := s.loadSceneToCron(scene, userId); err != nil {
 		return fmt.Errorf("请重新配置该场景，Reason：" + err.Error())
@@ -116,7 +130,7 @@ func (s *SceneService) StartScene(id, userId int64) error {
 	scene.Status = "running"
 	scene.BeforeUpdate()
 
-	_, err := o.Update(&scene)
+	_, err = o.Update(&scene)
 	return err
 }
 
@@ -172,8 +186,8 @@ func (s *SceneService) DeleteScene(id, userId int64) error {
 	return err
 }
 
-// ExecuteScene 执行场景动作
-func ExecuteScene(id, userId int64) error {
+// ExecuteScene 执行场景动作，source 为触发来源，每次执行记录到场景日志
+func ExecuteScene(id, userId int64, source string) error {
 	o := orm.NewOrm()
 	scene := models.Scene{Id: id}
 	tenantId, _ := models.GetUserTenantId(userId)
@@ -181,37 +195,50 @@ func ExecuteScene(id, userId int64) error {
 		return fmt.Errorf("scene not found or no permission")
 	}
 
+	// 限制每分钟执行次数，防止场景间相互触发时无限执行，每分钟仅记录一次限流日志
+	if source != models.SceneSourceManual {
+		if allowed, first := allowSceneRun(scene.Id, time.Now()); !allowed {
+			reason := fmt.Sprintf("场景每分钟执行超过 %d 次，已限流", sceneMaxRunsPerMinute)
+			if first {
+				skipSceneLog(o, startSceneLog(o, &scene, source), reason)
+			}
+			log.Printf("场景 %s: %s", scene.Name, reason)
+			return fmt.Errorf("%s", reason)
+		}
+	}
+	sceneLog := startSceneLog(o, &scene, source)
+
+	// 定时、设备触发时按触发时刻校验限制条件，手动执行用于测试不校验
+	if source != models.SceneSourceManual {
+		var conditions []dtos.Condition
+		if err := json.Unmarshal([]byte(scene.Condition), &conditions); err != nil {
+			finishSceneLog(o, sceneLog, nil, false, "解析条件失败: "+err.Error())
+			return fmt.Errorf("解析条件失败: %v", err)
+		}
+		if ok, reason := checkSceneGuards(conditions, tenantId, time.Now()); !ok {
+			skipSceneLog(o, sceneLog, reason)
+			return nil
+		}
+	}
+
 	// 解析动作
 	var actions []dtos.Action
 	err := json.Unmarshal([]byte(scene.Action), &actions)
 	if err != nil {
+		finishSceneLog(o, sceneLog, nil, false, "解析动作失败: "+err.Error())
 		return fmt.Errorf("解析动作失败: %v", err)
 	}
 
-	// 执行动作
-	var results []string
-	var writeLog models.WriteLog
-	for _, action := range actions {
-		// 调用设备控制接口
-		seq, err := Processor.Deal(action.DeviceName, action.Code, action.Value, "场景控制", userId, tenantId)
-		if err != nil {
-			//更新SEQ失败状态
-			writeLog.Seq = seq
-			writeLog.Status = "FAIL"
-			o.Update(&writeLog, "Status")
-			return fmt.Errorf("设备控制失败: %v", err)
-		}
-		result := fmt.Sprintf("SEQ:[%s] ; 执行动作: 设备[%s] 属性[%s] 值[%s]", seq,
-			action.DeviceName, action.Code, action.Value)
-		results = append(results, result)
-	}
-	log.Println(results)
-	return nil
+	// 按顺序执行动作，默认首个失败即中止(含其他并行分支)，场景配置继续执行时执行全部动作
+	run := newSceneRun(&scene, userId, tenantId, actions)
+	run.runSequence(actions, "")
+	finishSceneLog(o, sceneLog, run.results, scene.ContinueOnError, "")
+	return run.firstErr
 }
 
 // RestartScene 手动执行场景
 func (s *SceneService) RestartScene(id, userId int64) error {
-	err := ExecuteScene(id, userId)
+	err := ExecuteScene(id, userId, models.SceneSourceManual)
 	if err != nil {
 		return err
 	}
@@ -285,10 +312,14 @@ func (s *SceneService) loadSceneToCron(scene models.Scene, userId int64) error {
 	for _, condition := range conditions {
 		if condition.ConditionType == "timer" {
 			if cronExpr, ok := condition.Option["cron_expression"]; ok {
+				// 按条件或租户时区计算触发时间，未配置时使用服务器时区
+				if tz := sceneTimerZone(condition, scene); tz != "" && !strings.HasPrefix(cronExpr, "CRON_TZ=") && !strings.HasPrefix(cronExpr, "TZ=") {
+					cronExpr = "CRON_TZ=" + tz + " " + cronExpr
+				}
 				// 添加定时任务
 				entryID, err := s.cron.AddFunc(cronExpr, func() {
 					log.Printf("定时任务触发: 场景ID=%d, 名称=%s", scene.Id, scene.Name)
-					ExecuteScene(scene.Id, userId)
+					ExecuteScene(scene.Id, userId, models.SceneSourceCron)
 				})
 				if err != nil {
 					return fmt.Errorf("添加定时任务失败: %v", err)
@@ -316,23 +347,73 @@ func (s *SceneService) loadSceneToCron(scene models.Scene, userId int64) error {
 	return fmt.Errorf("场景 %d 没有找到有效的定时条件", scene.Id)
 }
 
+// sceneTimerZone 定时条件的时区，条件未指定时使用租户时区
+func sceneTimerZone(condition dtos.Condition, scene models.Scene) string {
+	if tz := condition.Option["time_zone"]; tz != "" {
+		return tz
+	}
+	if scene.Department == nil {
+		return ""
+	}
+	return tenantTimeZone(orm.NewOrm(), scene.Department.Id)
+}
+
+// ReloadTenantTimers 重新加载租户运行中的定时场景，租户时区变更后调用
+func (s *SceneService) ReloadTenantTimers(tenantId int64) {
+	o := orm.NewOrm()
+	var scenes []models.Scene
+	if _, err := o.QueryTable(new(models.Scene)).Filter("department_id", tenantId).Filter("status", string(constants.RuleStart)).All(&scenes); err != nil {
+		log.Printf("查询租户 %d 运行中的场景失败: %v", tenantId, err)
+		return
+	}
+	for _, scene := range scenes {
+		var conditions []dtos.Condition
+		if err := json.Unmarshal([]byte(scene.Condition), &conditions); err != nil {
+			continue
+		}
+		if trigger, ok := dtos.SceneTrigger(conditions); !ok || trigger.ConditionType != string(constants.ConditionTypeTimer) {
+			continue
+		}
+		s.mu.Lock()
+		if entryID, exists := s.jobs[scene.Id]; exists {
+			s.cron.Remove(entryID)
+			delete(s.jobs, scene.Id)
+		}
+		s.mu.Unlock()
+		if err := s.loadSceneToCron(scene, scene.UserId); err != nil {
+			log.Printf("重新加载场景 %d 失败: %v", scene.Id, err)
+		}
+	}
+}
+
+// sceneSubRule 设备触发的场景条件转换为子规则
+func sceneSubRule(condition dtos.Condition) models.SubRule {
+	productId, _ := strconv.ParseInt(condition.Option["product_id"], 10, 64)
+	return models.SubRule{
+		ProductId: productId,
+		DeviceId:  []string{condition.Option["device_id"]},
+		Trigger:   condition.Option["trigger"],
+		Option: map[string]string{
+			"code":             condition.Option["code"],
+			"name":             condition.Option["name"],
+			"value_type":       condition.Option["value_type"],
+			"value_cycle":      condition.Option["value_cycle"],
+			"decide_condition": condition.Option["decide_condition"],
+			"status":           condition.Option["status"],
+		},
+	}
+}
+
 func BuildEkuiperRule(ctx context.Context, params dtos.SceneUpdateRequest, sceneName string) error {
 	var req dtos.RuleUpdateRequest
-	var deviceArray []string
 
 	req.Name = sceneName
-	deviceIDs := append(deviceArray, params.Condition[0].Option["device_id"])
-	productId, _ := strconv.ParseInt(params.Condition[0].Option["product_id"], 10, 64)
-	req.SubRule = make([]models.SubRule, 1)
-	req.SubRule[0].ProductId = productId
-	req.SubRule[0].DeviceId = deviceIDs
-	req.SubRule[0].Trigger = params.Condition[0].Option["trigger"]
-	req.SubRule[0].Option = make(map[string]string)
-	req.SubRule[0].Option["code"] = params.Condition[0].Option["code"]
-	req.SubRule[0].Option["name"] = params.Condition[0].Option["name"]
-	req.SubRule[0].Option["value_type"] = params.Condition[0].Option["value_type"]
-	req.SubRule[0].Option["value_cycle"] = params.Condition[0].Option["value_cycle"]
-	req.SubRule[0].Option["decide_condition"] = params.Condition[0].Option["decide_condition"]
+	trigger, ok := dtos.SceneTrigger(params.Condition)
+	if !ok || trigger.ConditionType != string(constants.ConditionTypeNotify) {
+		return fmt.Errorf("场景没有设备触发条件")
+	}
+	req.SubRule = []models.SubRule{sceneSubRule(trigger)}
+	deviceIDs := req.SubRule[0].DeviceId
 
 	var sql string
 
@@ -359,7 +440,7 @@ func BuildEkuiperRule(ctx context.Context, params dtos.SceneUpdateRequest, scene
 		sql = req.BuildMultiDeviceStatusSql(deviceIDs)
 	}
 
-	actions := common.GetRuleAlertEkuiperActions(common.CallBackUrl + "/api/ekuiper/callback2")
+	actions := common.GetRuleAlertEkuiperActions(common.CallBackUrl + sceneCallbackPath)
 
 	if err := common.Ekuiper.RuleExist(ctx, req.Name); err == nil {
 		err = common.Ekuiper.UpdateRule(ctx, actions, req.Name, sql)
@@ -388,21 +469,15 @@ func (s *SceneService) DeviceStatusCron() error {
 	deviceMap := make(map[string]struct{})
 	// 查找定时条件
 	for _, rule := range rules {
-		var subRule []models.SubRule
-		if err := json.Unmarshal([]byte(rule.SubRule), &subRule); err != nil {
-			continue
-		}
-		if subRule[0].Trigger != string(constants.DeviceStatusTrigger) {
-			continue
-		}
-		var deviceIds []string
-		if err := json.Unmarshal([]byte(rule.DeviceId), &deviceIds); err != nil {
-			continue
-		}
-
-		// 遍历 deviceId 数组，将每个 ID 添加到 map 中去重
-		for _, deviceId := range deviceIds {
-			deviceMap[deviceId] = struct{}{}
+		// 只检测设备状态触发的子规则所涉及的设备
+		for _, subRule := range rule.SubRules() {
+			if subRule.Trigger != string(constants.DeviceStatusTrigger) {
+				continue
+			}
+			// 遍历 deviceId 数组，将每个 ID 添加到 map 中去重
+			for _, deviceId := range subRule.DeviceId {
+				deviceMap[deviceId] = struct{}{}
+			}
 		}
 	}
 	// 当前时间戳
@@ -483,8 +558,11 @@ func ExecCallBack(req map[string]interface{}) error {
 	if err := o.Read(&scene, "Name"); err != nil {
 		return fmt.Errorf(err.Error())
 	}
-	if err := ExecuteScene(scene.Id, scene.UserId); err != nil {
-		return fmt.Errorf(err.Error())
-	}
+	// 场景动作可能包含等待，异步执行避免阻塞回调，结果记录在场景日志
+	go func() {
+		if err := ExecuteScene(scene.Id, scene.UserId, models.SceneSourceCallback); err != nil {
+			log.Printf("场景 %s 执行失败: %v", scene.Name, err)
+		}
+	}()
 	return nil
 }
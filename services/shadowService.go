@@ -0,0 +1,364 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"iotServer/models"
+	"iotServer/utils"
+	"log"
+	"sync"
+	"time"
+)
+
+// 上报状态的落库间隔，期望状态修改时立即落库
+const shadowFlushInterval = 5 * time.Second
+
+// 未注册设备的查询结果缓存时间，避免其每条上报都查询数据库
+const shadowMissingTTL = 10 * time.Second
+
+// ErrShadowVersionConflict 修改时携带的版本号与影子当前版本不一致
+var ErrShadowVersionConflict = errors.New("影子版本冲突，请刷新后重试")
+
+var (
+	shadows       = sync.Map{} // 设备名 -> *shadowEntry
+	shadowMissing = sync.Map{} // 未注册的设备名 -> 缓存过期时间
+	shadowLoadMu  sync.Mutex
+)
+
+// ShadowMetadata 各属性最近一次更新的时间戳(秒)
+type ShadowMetadata struct {
+	Reported map[string]int64 `json:"reported"`
+	Desired  map[string]int64 `json:"desired"`
+}
+
+// ShadowDocument 设备影子文档
+type ShadowDocument struct {
+	Name      string                 `json:"name"`
+	Reported  map[string]interface{} `json:"reported"`
+	Desired   map[string]interface{} `json:"desired"`
+	Delta     map[string]interface{} `json:"delta"` // 期望与上报不一致的属性
+	Metadata  ShadowMetadata         `json:"metadata"`
+	Version   int64                  `json:"version"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+// shadowEntry 内存中的设备影子，上报频繁，按间隔批量落库
+type shadowEntry struct {
+	mu       sync.Mutex
+	saveMu   sync.Mutex // 串行化落库，写库时不持有 mu
+	model    models.DeviceShadow
+	reported map[string]interface{}
+	desired  map[string]interface{}
+	meta     ShadowMetadata
+	dirty    bool
+	rev      uint64 // 每次标记变化时递增，落库期间有新变化时保留脏标记
+}
+
+// ShadowService 设备影子管理
+type ShadowService struct{}
+
+// loadShadow 获取设备影子，不存在时为已注册设备创建
+func loadShadow(dn string) (*shadowEntry, error) {
+	if v, ok := shadows.Load(dn); ok {
+		return v.(*shadowEntry), nil
+	}
+	if expire, ok := shadowMissing.Load(dn); ok && time.Now().Before(expire.(time.Time)) {
+		return nil, fmt.Errorf("设备 %s 不存在", dn)
+	}
+	shadowLoadMu.Lock()
+	defer shadowLoadMu.Unlock()
+	if v, ok := shadows.Load(dn); ok {
+		return v.(*shadowEntry), nil
+	}
+
+	o := orm.NewOrm()
+	entry := &shadowEntry{
+		reported: map[string]interface{}{},
+		desired:  map[string]interface{}{},
+		meta:     ShadowMetadata{Reported: map[string]int64{}, Desired: map[string]int64{}},
+	}
+	entry.model.Name = dn
+	if err := o.Read(&entry.model, "name"); err == nil {
+		_ = json.Unmarshal([]byte(entry.model.Reported), &entry.reported)
+		_ = json.Unmarshal([]byte(entry.model.Desired), &entry.desired)
+		_ = json.Unmarshal([]byte(entry.model.Metadata), &entry.meta)
+		if entry.meta.Reported == nil {
+			entry.meta.Reported = map[string]int64{}
+		}
+		if entry.meta.Desired == nil {
+			entry.meta.Desired = map[string]int64{}
+		}
+	} else {
+		device := models.Device{Name: dn}
+		if err := o.Read(&device, "name"); err != nil {
+			shadowMissing.Store(dn, time.Now().Add(shadowMissingTTL))
+			return nil, fmt.Errorf("设备 %s 不存在", dn)
+		}
+		entry.model = models.DeviceShadow{Name: dn, Tenant: device.Tenant}
+		entry.markDirty()
+	}
+	shadowMissing.Delete(dn)
+	shadows.Store(dn, entry)
+	return entry, nil
+}
+
+// shadowValueEqual 上报值与期望值按字符串比较，避免数字类型差异
+func shadowValueEqual(a, b interface{}) bool {
+	return utils.InterfaceToString(a) == utils.InterfaceToString(b)
+}
+
+// document 生成影子文档，调用方需持有锁
+func (e *shadowEntry) document() *ShadowDocument {
+	doc := &ShadowDocument{
+		Name:      e.model.Name,
+		Reported:  make(map[string]interface{}, len(e.reported)),
+		Desired:   make(map[string]interface{}, len(e.desired)),
+		Delta:     make(map[string]interface{}),
+		Metadata:  ShadowMetadata{Reported: make(map[string]int64), Desired: make(map[string]int64)},
+		Version:   e.model.Version,
+		Timestamp: time.Now().Unix(),
+	}
+	for k, v := range e.reported {
+		doc.Reported[k] = v
+	}
+	for k, v := range e.desired {
+		doc.Desired[k] = v
+		if reported, ok := e.reported[k]; !ok || !shadowValueEqual(reported, v) {
+			doc.Delta[k] = v
+		}
+	}
+	for k, v := range e.meta.Reported {
+		doc.Metadata.Reported[k] = v
+	}
+	for k, v := range e.meta.Desired {
+		doc.Metadata.Desired[k] = v
+	}
+	return doc
+}
+
+// markDirty 标记影子有变化待落库，调用方需持有锁
+func (e *shadowEntry) markDirty() {
+	e.dirty = true
+	e.rev++
+}
+
+// snapshot 复制待落库的影子记录，调用方需持有锁
+func (e *shadowEntry) snapshot() models.DeviceShadow {
+	reported, _ := json.Marshal(e.reported)
+	desired, _ := json.Marshal(e.desired)
+	meta, _ := json.Marshal(e.meta)
+	model := e.model
+	model.Reported = string(reported)
+	model.Desired = string(desired)
+	model.Metadata = string(meta)
+	return model
+}
+
+// save 在锁内复制影子、锁外写库，避免写库期间阻塞上报；调用方不能持有锁
+func (e *shadowEntry) save() error {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	e.mu.Lock()
+	if !e.dirty {
+		e.mu.Unlock()
+		return nil
+	}
+	model := e.snapshot()
+	rev := e.rev
+	e.mu.Unlock()
+
+	o := orm.NewOrm()
+	var err error
+	if model.Id == 0 {
+		_ = model.BeforeInsert()
+		_, err = o.Insert(&model)
+	} else {
+		_ = model.BeforeUpdate()
+		_, err = o.Update(&model)
+	}
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.model.Id = model.Id
+	e.model.Created = model.Created
+	e.model.Modified = model.Modified
+	if e.rev == rev {
+		e.dirty = false
+	}
+	e.mu.Unlock()
+	return nil
+}
+
+// updateShadowReported 用属性上报更新影子的上报状态
+func updateShadowReported(msg MqttMessage) {
+	if len(msg.Properties) == 0 {
+		return
+	}
+	entry, err := loadShadow(msg.Dn)
+	if err != nil {
+		return
+	}
+	ts := msg.Time
+	if ts == 0 {
+		ts = time.Now().Unix()
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	changed := false
+	for k, v := range msg.Properties {
+		// 乱序到达的旧数据不覆盖
+		if ts < entry.meta.Reported[k] {
+			continue
+		}
+		if old, ok := entry.reported[k]; !ok || !shadowValueEqual(old, v) {
+			entry.reported[k] = v
+			changed = true
+		}
+		entry.meta.Reported[k] = ts
+	}
+	// 仅时间戳变化时不落库，随下次值变化一并保存
+	if changed {
+		entry.model.Version++
+		entry.markDirty()
+	}
+}
+
+// shadowFlushLoop 定期落库有变化的影子
+func shadowFlushLoop() {
+	ticker := time.NewTicker(shadowFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		shadows.Range(func(key, value interface{}) bool {
+			if err := value.(*shadowEntry).save(); err != nil {
+				log.Printf("设备影子 %s 保存失败: %v", key, err)
+			}
+			return true
+		})
+	}
+}
+
+// setShadowDesired 合并期望状态，值为nil时删除该属性；version不为0时做乐观锁校验
+func setShadowDesired(dn string, patch map[string]interface{}, version int64) (*ShadowDocument, error) {
+	entry, err := loadShadow(dn)
+	if err != nil {
+		return nil, err
+	}
+	entry.mu.Lock()
+	if version != 0 && version != entry.model.Version {
+		entry.mu.Unlock()
+		return nil, ErrShadowVersionConflict
+	}
+	now := time.Now().Unix()
+	for k, v := range patch {
+		if v == nil {
+			delete(entry.desired, k)
+			delete(entry.meta.Desired, k)
+			continue
+		}
+		entry.desired[k] = v
+		entry.meta.Desired[k] = now
+	}
+	entry.model.Version++
+	entry.markDirty()
+	doc := entry.document()
+	entry.mu.Unlock()
+	if err := entry.save(); err != nil {
+		return nil, fmt.Errorf("保存设备影子失败: %v", err)
+	}
+	return doc, nil
+}
+
+// SyncShadowDelta 将期望与上报不一致的属性下发到网关，设备上线时调用
+func SyncShadowDelta(dn string) (int, error) {
+	entry, err := loadShadow(dn)
+	if err != nil {
+		return 0, err
+	}
+	entry.mu.Lock()
+	doc := entry.document()
+	tenantId := entry.model.Tenant
+	entry.mu.Unlock()
+	if len(doc.Delta) == 0 {
+		return 0, nil
+	}
+	if Processor == nil {
+		return 0, fmt.Errorf("MQTT未初始化")
+	}
+
+	sent := 0
+	for k, v := range doc.Delta {
+		if _, err := Processor.Deal(dn, k, utils.InterfaceToString(v), "设备影子", 0, tenantId); err != nil {
+			log.Printf("设备影子 %s 下发 %s 失败: %v", dn, k, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("设备影子 %s 已下发 %d/%d 个差异属性", dn, sent, len(doc.Delta))
+	return sent, nil
+}
+
+// deleteShadow 删除设备时清理影子
+func deleteShadow(dn string) {
+	shadows.Delete(dn)
+	_, _ = orm.NewOrm().QueryTable(new(models.DeviceShadow)).Filter("name", dn).Delete()
+}
+
+// checkShadowDevice 校验设备归属
+func checkShadowDevice(tenantId int64, dn string) error {
+	if !orm.NewOrm().QueryTable(new(models.Device)).Filter("name", dn).Filter("tenant_id", tenantId).Exist() {
+		return fmt.Errorf("设备不存在或无操作权限")
+	}
+	return nil
+}
+
+// Get 获取设备影子文档
+func (s *ShadowService) Get(tenantId int64, dn string) (*ShadowDocument, error) {
+	if err := checkShadowDevice(tenantId, dn); err != nil {
+		return nil, err
+	}
+	entry, err := loadShadow(dn)
+	if err != nil {
+		return nil, err
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return entry.document(), nil
+}
+
+// Version 获取影子当前版本，供轮询推送判断变化
+func (s *ShadowService) Version(dn string) int64 {
+	if v, ok := shadows.Load(dn); ok {
+		entry := v.(*shadowEntry)
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		return entry.model.Version
+	}
+	return 0
+}
+
+// PatchDesired 修改期望状态并立即下发差异
+func (s *ShadowService) PatchDesired(tenantId int64, dn string, patch map[string]interface{}, version int64) (*ShadowDocument, error) {
+	if err := checkShadowDevice(tenantId, dn); err != nil {
+		return nil, err
+	}
+	doc, err := setShadowDesired(dn, patch, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Delta) > 0 {
+		go SyncShadowDelta(dn)
+	}
+	return doc, nil
+}
+
+// Sync 手动重新下发差异
+func (s *ShadowService) Sync(tenantId int64, dn string) (int, error) {
+	if err := checkShadowDevice(tenantId, dn); err != nil {
+		return 0, err
+	}
+	return SyncShadowDelta(dn)
+}
@@ -0,0 +1,552 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"iotServer/common"
+	"iotServer/models"
+	"iotServer/models/constants"
+	"iotServer/models/dtos"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置流规则计算的输出去向，对应 eKuiper 的三个回调
+const (
+	streamAlert  = "alert"
+	streamScene  = "scene"
+	streamEngine = "engine"
+)
+
+const (
+	streamReloadInterval = 30 * time.Second
+	streamReloadDelay    = time.Second // 规则变更后延迟加载，等待数据库状态写入
+	streamFlushInterval  = time.Second
+)
+
+// streamField 规则引擎 SELECT 的字段
+type streamField struct {
+	path  []string
+	alias string
+}
+
+// streamPredicate 规则引擎 WHERE 中以 AND 连接的单个比较
+type streamPredicate struct {
+	path []string
+	cond string
+}
+
+// streamWindow 单个设备当前的滚动窗口
+type streamWindow struct {
+	start int64
+	sum   float64
+	count int
+	max   float64
+	min   float64
+}
+
+// streamRule 编译后的流规则，id 与 eKuiper 规则ID一致
+type streamRule struct {
+	id        string
+	target    string
+	signature string // 配置摘要，未变化时重新加载保留窗口状态
+
+	// 告警、场景的设备触发
+	trigger string
+	devices map[string]bool
+	code    string
+	cond    string
+	status  string
+	agg     string // avg/max/min/sum，空为原始值
+	window  int64  // 毫秒
+	windows map[string]*streamWindow
+
+	// 规则引擎
+	fields []streamField // 为空表示 SELECT *
+	where  []streamPredicate
+
+	recordsIn      int64
+	recordsOut     int64
+	lastInvocation int64
+}
+
+// streamOutput 规则输出，字段与 eKuiper 回调一致
+type streamOutput struct {
+	target string
+	data   map[string]interface{}
+}
+
+// streamEvaluator 内置流规则计算，消费 /edge/stream 消息并调用告警、场景、规则引擎回调
+type streamEvaluator struct {
+	mu     sync.Mutex
+	rules  map[string]*streamRule
+	reload chan struct{}
+	out    chan streamOutput
+}
+
+var builtinStream *streamEvaluator
+
+// StartStreamEvaluator 启动内置流规则计算并注册到 common，替代 eKuiper
+func StartStreamEvaluator() {
+	e := &streamEvaluator{
+		rules:  make(map[string]*streamRule),
+		reload: make(chan struct{}, 1),
+		out:    make(chan streamOutput, 1024),
+	}
+	e.load()
+	builtinStream = e
+	common.BuiltinStream = e
+	go e.reloadLoop()
+	go e.flushLoop()
+	go e.dispatchLoop()
+	logs.Info("内置流规则计算已启动，共加载 %d 条规则", len(e.rules))
+}
+
+// feedStreamMessage 将 /edge/stream 消息交给内置流规则计算
+func feedStreamMessage(payload string) {
+	if builtinStream == nil {
+		return
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return
+	}
+	builtinStream.feed(msg, time.Now())
+}
+
+// Reload 规则变更后重新加载
+func (e *streamEvaluator) Reload() {
+	select {
+	case e.reload <- struct{}{}:
+	default:
+	}
+}
+
+// RuleStats 单条规则的运行统计
+func (e *streamEvaluator) RuleStats(ruleId string) (map[string]interface{}, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.rules[ruleId]
+	if !ok {
+		return nil, false
+	}
+	return r.stats(), true
+}
+
+// AllRuleStats 全部规则的运行统计
+func (e *streamEvaluator) AllRuleStats() map[string]interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	all := make(map[string]interface{}, len(e.rules))
+	for id, r := range e.rules {
+		all[id] = r.stats()
+	}
+	return all
+}
+
+func (r *streamRule) stats() map[string]interface{} {
+	return map[string]interface{}{
+		"status":            "running",
+		"records_in_total":  r.recordsIn,
+		"records_out_total": r.recordsOut,
+		"last_invocation":   r.lastInvocation,
+	}
+}
+
+func (e *streamEvaluator) reloadLoop() {
+	ticker := time.NewTicker(streamReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.reload:
+			time.Sleep(streamReloadDelay)
+		}
+		e.load()
+	}
+}
+
+func (e *streamEvaluator) flushLoop() {
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		e.flush(now)
+	}
+}
+
+// dispatchLoop 按输出顺序逐条回调，与 eKuiper 逐条推送一致
+func (e *streamEvaluator) dispatchLoop() {
+	for output := range e.out {
+		var err error
+		switch output.target {
+		case streamAlert:
+			service := AlertService{}
+			err = service.AddAlert(output.data)
+		case streamScene:
+			err = ExecCallBack(output.data)
+		case streamEngine:
+			err = EngineCallBack(output.data)
+		}
+		if err != nil {
+			logs.Error("内置规则 %v 回调失败: %v", output.data["rule_id"], err)
+		}
+	}
+}
+
+// load 从数据库加载运行中的告警规则、场景和规则引擎，配置未变的规则保留窗口与统计
+func (e *streamEvaluator) load() {
+	rules := loadStreamRules(orm.NewOrm())
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, r := range rules {
+		if old, ok := e.rules[id]; ok && old.signature == r.signature {
+			rules[id] = old
+		}
+	}
+	e.rules = rules
+}
+
+// loadStreamRules 编译运行中的规则
+func loadStreamRules(o orm.Ormer) map[string]*streamRule {
+	rules := make(map[string]*streamRule)
+	dataTypes := make(map[string]string)
+	dataType := func(sub models.SubRule) string {
+		key := fmt.Sprintf("%d|%s", sub.ProductId, sub.Option["code"])
+		if t, ok := dataTypes[key]; ok {
+			return t
+		}
+		var property models.Properties
+		var specs map[string]string
+		if err := o.QueryTable(new(models.Properties)).Filter("code", sub.Option["code"]).Filter("product_id", sub.ProductId).One(&property); err == nil {
+			_ = json.Unmarshal([]byte(property.TypeSpec), &specs)
+		}
+		dataTypes[key] = specs["type"]
+		return specs["type"]
+	}
+
+	var alertRules []*models.AlertRule
+	if _, err := o.QueryTable(new(models.AlertRule)).Filter("status", string(constants.RuleStart)).All(&alertRules); err != nil {
+		logs.Error("加载告警规则失败: %v", err)
+	}
+	for _, rule := range alertRules {
+		for i, sub := range rule.SubRules() {
+			id := models.AlertEkuiperRuleId(rule.Name, i)
+			if r := compileSubRule(id, streamAlert, sub, dataType(sub)); r != nil {
+				rules[id] = r
+			}
+		}
+	}
+
+	var scenes []*models.Scene
+	if _, err := o.QueryTable(new(models.Scene)).Filter("status", string(constants.RuleStart)).All(&scenes); err != nil {
+		logs.Error("加载场景失败: %v", err)
+	}
+	for _, scene := range scenes {
+		var conditions []dtos.Condition
+		if err := json.Unmarshal([]byte(scene.Condition), &conditions); err != nil || len(conditions) == 0 {
+			continue
+		}
+		// 与 BuildEkuiperRule 一致，取触发条件
+		trigger, ok := dtos.SceneTrigger(conditions)
+		if !ok || trigger.ConditionType != string(constants.ConditionTypeNotify) {
+			continue
+		}
+		sub := sceneSubRule(trigger)
+		if r := compileSubRule(scene.Name, streamScene, sub, dataType(sub)); r != nil {
+			rules[scene.Name] = r
+		}
+	}
+
+	var engines []*models.RuleEngine
+	if _, err := o.QueryTable(new(models.RuleEngine)).Filter("status", string(constants.RuleStart)).All(&engines); err != nil {
+		logs.Error("加载规则引擎失败: %v", err)
+	}
+	for _, engine := range engines {
+		var filter dtos.Filters
+		if err := json.Unmarshal([]byte(engine.Filter), &filter); err != nil {
+			continue
+		}
+		id := engine.Name + "__Engine"
+		r, err := compileEngineRule(id, filter)
+		if err != nil {
+			logs.Warn("规则引擎 %s 无法由内置流规则计算执行: %v", engine.Name, err)
+			continue
+		}
+		rules[id] = r
+	}
+	return rules
+}
+
+// compileSubRule 编译设备数据、事件、状态触发的子规则，聚合值仅对数值类型生效
+func compileSubRule(id, target string, sub models.SubRule, dataType string) *streamRule {
+	if !constants.IsTriggerValid(sub.Trigger) {
+		return nil
+	}
+	r := &streamRule{
+		id:      id,
+		target:  target,
+		trigger: sub.Trigger,
+		devices: make(map[string]bool, len(sub.DeviceId)),
+		code:    sub.Option["code"],
+		cond:    sub.Option["decide_condition"],
+		status:  sub.Option["status"],
+		windows: make(map[string]*streamWindow),
+	}
+	for _, dn := range sub.DeviceId {
+		r.devices[dn] = true
+	}
+	valueType := sub.Option["value_type"]
+	if sub.Trigger == string(constants.DeviceDataTrigger) && valueType != "" && valueType != string(constants.Original) &&
+		(dataType == "int" || dataType == "float") {
+		r.agg = valueType
+		r.window = int64(windowSeconds(sub.Option["value_cycle"])) * 1000
+	}
+	signature, _ := json.Marshal(sub)
+	r.signature = target + "|" + dataType + "|" + string(signature)
+	return r
+}
+
+var (
+	streamAndPattern   = regexp.MustCompile(`(?i)\s+AND\s+`)
+	streamOrPattern    = regexp.MustCompile(`(?i)\s+OR\s+|\(`)
+	streamPredPattern  = regexp.MustCompile(`^([A-Za-z_][\w.\->]*)\s*(?i:(>=|<=|!=|<>|=|>|<|NOT\s+LIKE|LIKE))\s*(.+)$`)
+	streamFieldPattern = regexp.MustCompile(`^([A-Za-z_][\w.\->]*)(?:\s+(?i:AS)\s+(\w+))?$`)
+)
+
+// streamPath 解析 data->code->value 或 data.code.value 形式的字段路径
+func streamPath(expr string) []string {
+	return strings.Split(strings.ReplaceAll(expr, "->", "."), ".")
+}
+
+// compileEngineRule 编译规则引擎的筛选条件，支持 SELECT * 或字段列表，WHERE 为 AND 连接的比较
+func compileEngineRule(id string, filter dtos.Filters) (*streamRule, error) {
+	r := &streamRule{id: id, target: streamEngine, signature: streamEngine + "|" + filter.SelectName + "|" + filter.Condition}
+	selectName := strings.TrimSpace(filter.SelectName)
+	if selectName != "*" {
+		for _, item := range strings.Split(selectName, ",") {
+			m := streamFieldPattern.FindStringSubmatch(strings.TrimSpace(item))
+			if m == nil {
+				return nil, fmt.Errorf("不支持的查询字段: %s", item)
+			}
+			path := streamPath(m[1])
+			alias := m[2]
+			if alias == "" {
+				alias = path[len(path)-1]
+			}
+			r.fields = append(r.fields, streamField{path: path, alias: alias})
+		}
+	}
+	condition := strings.TrimSpace(filter.Condition)
+	if condition == "" {
+		return r, nil
+	}
+	if streamOrPattern.MatchString(condition) {
+		return nil, fmt.Errorf("仅支持 AND 连接的比较条件")
+	}
+	for _, term := range streamAndPattern.Split(condition, -1) {
+		m := streamPredPattern.FindStringSubmatch(strings.TrimSpace(term))
+		if m == nil {
+			return nil, fmt.Errorf("不支持的条件: %s", term)
+		}
+		op := strings.ToUpper(strings.Join(strings.Fields(m[2]), " "))
+		if op == "<>" {
+			op = "!="
+		}
+		literal := strings.TrimSpace(m[3])
+		if strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") && len(literal) >= 2 {
+			literal = `"` + literal[1:len(literal)-1] + `"`
+		}
+		r.where = append(r.where, streamPredicate{path: streamPath(m[1]), cond: op + " " + literal})
+	}
+	return r, nil
+}
+
+// streamLookup 按路径取消息字段
+func streamLookup(msg map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = msg
+	for _, key := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// feed 处理一条流消息
+func (e *streamEvaluator) feed(msg map[string]interface{}, now time.Time) {
+	e.mu.Lock()
+	var outputs []streamOutput
+	for _, r := range e.rules {
+		r.recordsIn++
+		var data []map[string]interface{}
+		if r.target == streamEngine {
+			data = r.evalEngine(msg)
+		} else {
+			data = r.evalSubRule(msg, now.UnixMilli())
+		}
+		for _, d := range data {
+			outputs = append(outputs, r.emit(d, now))
+		}
+	}
+	e.mu.Unlock()
+	for _, output := range outputs {
+		e.out <- output
+	}
+}
+
+// flush 关闭已到期的窗口
+func (e *streamEvaluator) flush(now time.Time) {
+	e.mu.Lock()
+	var outputs []streamOutput
+	for _, r := range e.rules {
+		for dn, w := range r.windows {
+			if now.UnixMilli() < w.start+r.window {
+				continue
+			}
+			delete(r.windows, dn)
+			if d := r.closeWindow(dn, w); d != nil {
+				outputs = append(outputs, r.emit(d, now))
+			}
+		}
+	}
+	e.mu.Unlock()
+	for _, output := range outputs {
+		e.out <- output
+	}
+}
+
+func (r *streamRule) emit(data map[string]interface{}, now time.Time) streamOutput {
+	r.recordsOut++
+	r.lastInvocation = now.UnixMilli()
+	data["rule_id"] = r.id
+	return streamOutput{target: r.target, data: data}
+}
+
+// evalEngine 规则引擎按条件筛选后输出所选字段
+func (r *streamRule) evalEngine(msg map[string]interface{}) []map[string]interface{} {
+	for _, p := range r.where {
+		v, ok := streamLookup(msg, p.path)
+		if !ok {
+			return nil
+		}
+		if matched, ok := evalDecideCondition(p.cond, v); !ok || !matched {
+			return nil
+		}
+	}
+	data := make(map[string]interface{})
+	if len(r.fields) == 0 {
+		for k, v := range msg {
+			data[k] = v
+		}
+	}
+	for _, f := range r.fields {
+		if v, ok := streamLookup(msg, f.path); ok {
+			data[f.alias] = v
+		}
+	}
+	return []map[string]interface{}{data}
+}
+
+// evalSubRule 按触发方式判断消息，输出字段与 RuleUpdateRequest 生成的 SQL 一致
+func (r *streamRule) evalSubRule(msg map[string]interface{}, now int64) []map[string]interface{} {
+	dn, _ := msg["dn"].(string)
+	if !r.devices[dn] {
+		return nil
+	}
+	messageType, _ := msg["messageType"].(string)
+	data, _ := msg["data"].(map[string]interface{})
+	switch r.trigger {
+	case string(constants.DeviceStatusTrigger):
+		if messageType != "DEVICE_STATUS" || msg["status"] != r.status {
+			return nil
+		}
+		return []map[string]interface{}{{"report_time": msg["time"], "deviceId": dn, "messageType": messageType}}
+	case string(constants.DeviceEventTrigger):
+		point, ok := data[r.code].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		return []map[string]interface{}{{"report_time": point["time"], "alert_event": point["event"], "alert_type": point["type"], "deviceId": dn, "messageType": messageType}}
+	}
+
+	if messageType != "PROPERTY_REPORT" {
+		return nil
+	}
+	point, ok := data[r.code].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	value := point["value"]
+	if r.window == 0 {
+		if matched, ok := evalDecideCondition(r.cond, value); !ok || !matched {
+			return nil
+		}
+		return []map[string]interface{}{{"report_time": point["time"], "alert_value": value, "deviceId": dn, "messageType": messageType}}
+	}
+
+	v, ok := toFloat(value)
+	if !ok {
+		return nil
+	}
+	var result []map[string]interface{}
+	start := now - now%r.window
+	w := r.windows[dn]
+	if w != nil && w.start != start {
+		delete(r.windows, dn)
+		if d := r.closeWindow(dn, w); d != nil {
+			result = append(result, d)
+		}
+		w = nil
+	}
+	if w == nil {
+		w = &streamWindow{start: start, max: v, min: v}
+		r.windows[dn] = w
+	}
+	w.sum += v
+	w.count++
+	if v > w.max {
+		w.max = v
+	}
+	if v < w.min {
+		w.min = v
+	}
+	return result
+}
+
+// closeWindow 计算窗口聚合值，满足判断条件时输出
+func (r *streamRule) closeWindow(dn string, w *streamWindow) map[string]interface{} {
+	if w.count == 0 {
+		return nil
+	}
+	var value float64
+	switch r.agg {
+	case string(constants.Avg):
+		value = w.sum / float64(w.count)
+	case string(constants.Max):
+		value = w.max
+	case string(constants.Min):
+		value = w.min
+	case string(constants.Sum):
+		value = w.sum
+	default:
+		return nil
+	}
+	if matched, ok := evalDecideCondition(r.cond, value); !ok || !matched {
+		return nil
+	}
+	return map[string]interface{}{
+		"window_start": float64(w.start),
+		"window_end":   float64(w.start + r.window),
+		"deviceId":     dn,
+		"alert_value":  value,
+		"messageType":  "PROPERTY_REPORT",
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"iotServer/common"
 	"iotServer/iotp"
 	"iotServer/models"
+	"iotServer/models/constants"
 	"iotServer/utils"
 	"log"
 	"net"
@@ -96,12 +97,19 @@ type PropertySetProcessor struct {
 func NewPropertySetProcessor(mqttClient common.MqttConnector, switchService *SwitchService) *PropertySetProcessor {
 	service, _ := NewTDengineService()
 	writer := service.NewTDengineWriter(2*time.Second, 300)
-	initWorkerPool()
-	return &PropertySetProcessor{
+	p := &PropertySetProcessor{
 		mqttClient:    mqttClient,
 		switchService: switchService,
 		tdWriter:      writer,
 	}
+	initWorkerPool(p)
+	go rejectedFlushLoop()
+	go shadowFlushLoop()
+	go commandSweepLoop()
+	go alertLifecycleLoop()
+	go notifyRetryLoop()
+	interruptBatches()
+	return p
 }
 
 // 初始化订阅
@@ -130,6 +138,12 @@ func (p *PropertySetProcessor) Init() error {
 	} else {
 		log.Println("已订阅实时数据主题: /edge/stream/+/post")
 	}
+	//订阅物模型服务调用响应
+	if err := p.mqttClient.Subscribe(serviceReplyTopic, 0, p.handleMessage); err != nil {
+		return fmt.Errorf("订阅失败: %v", err)
+	} else {
+		log.Println("已订阅服务调用响应主题: " + serviceReplyTopic)
+	}
 	return nil
 }
 
@@ -153,26 +167,20 @@ func (p *PropertySetProcessor) handleMessage(client mqtt.Client, msg mqtt.Messag
 		jobType = "property_message"
 	} else if strings.HasPrefix(topic, "/edge/stream/") && strings.HasSuffix(topic, "/post") {
 		jobType = "stream_message"
+	} else if strings.HasPrefix(topic, "/edge/service/") && strings.HasSuffix(topic, "/reply") {
+		jobType = "service_reply"
 	} else {
 		log.Printf("未知的主题类型: %s", topic)
 		return
 	}
 
-	// 将任务提交到工作池
-	job := Job{
+	// 将任务提交到工作池，内存队列满时落盘
+	submitJob(Job{
 		Topic:     topic,
 		Payload:   payload,
 		Type:      jobType,
-		Processor: Processor,
-	}
-
-	// 非阻塞地提交任务，如果队列满了就丢弃并记录
-	select {
-	case jobQueue <- job:
-		utils.DebugLog("任务已提交到队列: %s", topic)
-	default:
-		log.Printf("任务队列已满，丢弃消息: %s", topic)
-	}
+		Processor: p,
+	})
 }
 
 // 处理控制响应
@@ -211,27 +219,43 @@ func (p *PropertySetProcessor) handlePropertyMessage(topic, payload string) erro
 		return fmt.Errorf("JSON解析失败:%v", err)
 	}
 
-	// 或者完全异步处理，不等待写入完成
+	// 按物模型校验后，按上报顺序写入缓冲，落库由写入器的单独协程完成
+	valid := arr[:0]
 	for _, m := range arr {
-		go func(msg MqttMessage) {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("TDengine 写入 panic: %v", r)
-				}
-			}()
-			p.tdWriter.Add(msg)
-		}(m)
+		// 未注册设备进入待审批收件箱
+		_, registered := GetDeviceCategoryKeyFromCache(m.Dn)
+		if !registered {
+			observeUnknownDevice(sn, m)
+		}
+		if ValidateMessage(&m) > 0 && len(m.Properties) == 0 {
+			continue
+		}
+		p.tdWriter.Add(m)
+		if registered {
+			updateShadowReported(m)
+			observeAlertRecovery(m)
+		}
+		valid = append(valid, m)
 	}
 
 	// 为每个item创建转发任务
-	for _, item := range arr {
+	for _, item := range valid {
 		// 转换为 eKuiper 友好格式
+		bad := make(map[string]bool)
+		if item.Quality != "" {
+			for _, code := range strings.Split(item.Quality, ",") {
+				bad[code] = true
+			}
+		}
 		data := make(map[string]map[string]interface{})
 		for k, v := range item.Properties {
 			data[k] = map[string]interface{}{
 				"value": v,
 				"time":  item.Time,
 			}
+			if bad[k] {
+				data[k]["quality"] = "Bad"
+			}
 		}
 		out := map[string]interface{}{
 			"dn":          item.Dn,
@@ -280,10 +304,15 @@ func (p *PropertySetProcessor) handleStreamMessage(topic, payload string) error
 		Dn          string                            `json:"dn"`
 		Desc        string                            `json:"desc"`
 		MessageType string                            `json:"messageType"`
+		Status      string                            `json:"status"`
 	}
 	if err := json.Unmarshal([]byte(payload), &message); err != nil {
 		return fmt.Errorf("JSON解析失败:%v", err)
 	}
+	// 未使用 eKuiper 时由内置流规则计算处理告警、场景及规则引擎
+	if common.UseBuiltinStream() {
+		feedStreamMessage(payload)
+	}
 	// 属性上报更新设备状态
 	if message.MessageType == "PROPERTY_REPORT" {
 		dn := message.Dn
@@ -292,7 +321,13 @@ func (p *PropertySetProcessor) handleStreamMessage(topic, payload string) error
 			dn = dn + sn
 		}
 		// - 数据持久化 使用线程服务更新设备状态，避免频繁查询
-		UpdateDeviceStatus(sn, dn, message.Desc, tagService)
+		if UpdateDeviceStatus(sn, dn, message.Desc, tagService) {
+			// 设备重新上线，下发影子中未同步的期望状态，并恢复离线告警
+			go SyncShadowDelta(dn)
+			observeStatusRecovery(dn, string(constants.DeviceOnline))
+		}
+	} else if message.MessageType == "DEVICE_STATUS" && message.Status == string(constants.DeviceOffline) {
+		observeStatusRecovery(message.Dn, string(constants.DeviceOffline))
 	}
 
 	return nil
@@ -315,16 +350,18 @@ func (p *PropertySetProcessor) Deal(dn, tag, val, channel string, userId, tenant
 	writeLog(seq, "WAIT", sn, dn, tag, val, channel, userId, tenantId)
 
 	if err != nil || sn == "" || device.Tenant != tenantId {
+		finishCommand(seq, models.WriteLogFail)
 		return seq, fmt.Errorf("the device does not contain gateway information or no permission")
 	}
 
-	topic := fmt.Sprintf("lm/iot/ctrlRequest/%s", sn)
-	body := fmt.Sprintf("[{\"seq\":\"%s\",\"deviceCode\":\"%s\", \"tagCode\": \"%s\", \"val\": \"%s\"}]", seq, dn, tag, val)
-
-	if err := p.mqttClient.Publish(topic, 0, []byte(body)); err != nil {
+	// 先加入跟踪再下发，避免响应先于跟踪到达
+	timeout, retries := commandPolicy(device)
+	trackCommand(&trackedCommand{seq: seq, sn: sn, dn: dn, tag: tag, val: val, maxAttempts: retries + 1, timeout: timeout})
+	if err := p.publishCommand(sn, seq, dn, tag, val); err != nil {
+		finishCommand(seq, models.WriteLogFail)
 		return seq, fmt.Errorf("写入控制命令失败: %v", err)
 	}
-	log.Printf("已发布控制命令: %s", topic)
+	log.Printf("已发布控制命令: lm/iot/ctrlRequest/%s", sn)
 	return seq, nil
 }
 
@@ -367,8 +404,9 @@ func writeLog(seq, status, sn, dn, tag, val, channel string, userId, tenantId in
 			Dn:         dn,
 			Tag:        tag,
 			Val:        val,
-			Status:     "WAIT",
+			Status:     models.WriteLogWait,
 			Channel:    channel,
+			Attempts:   1,
 			UserId:     userId,
 			Department: &models.Department{Id: tenantId},
 		}
@@ -378,23 +416,14 @@ func writeLog(seq, status, sn, dn, tag, val, channel string, userId, tenantId in
 			log.Println("命令写入失败", err.Error())
 		}
 	} else {
-		var writeLog models.WriteLog
-		writeLog.Seq = seq
-		err := o.Read(&writeLog)
-		if err != nil {
-			log.Println("未查询到该响应seq")
+		// 响应到达，结束命令跟踪；超时或过期后到达的响应不再改变状态
+		if status == "true" {
+			status = models.WriteLogSuccess
 		} else {
-			if status == "true" {
-				writeLog.Status = "SUCCESS"
-			} else {
-				writeLog.Status = "FAIL"
-			}
-			_ = writeLog.BeforeUpdate()
-			if _, err := o.Update(&writeLog); err != nil {
-				log.Println("命令状态更新失败：", err)
-			} else {
-				log.Println("命令状态更新成功")
-			}
+			status = models.WriteLogFail
+		}
+		if finishCommand(seq, status) {
+			log.Println("命令状态更新成功")
 		}
 	}
 }
@@ -10,6 +10,7 @@ import (
 	_ "github.com/taosdata/driver-go/v3/taosRestful"
 	"iotServer/models"
 	"iotServer/utils"
+	"log"
 	"strings"
 	"sync"
 	"time"
@@ -20,14 +21,21 @@ var Label string = "productId BIGINT"
 var SubLabel string = "productId"
 var DBName string = "power"
 
+// 批量写入失败重试参数
+const (
+	flushMaxRetries   = 3
+	flushRetryBackoff = 500 * time.Millisecond
+)
+
 type TDengineService struct {
 	db *sql.DB
 }
 type MqttMessage struct {
-	Dn         string                 `json:"dn"`         // 超级表名
-	Desc       string                 `json:"desc"`       // 设备描述
-	Properties map[string]interface{} `json:"properties"` // 列和值
-	Time       int64                  `json:"time"`       // 时间戳
+	Dn         string                 `json:"dn"`                // 超级表名
+	Desc       string                 `json:"desc"`              // 设备描述
+	Properties map[string]interface{} `json:"properties"`        // 列和值
+	Time       int64                  `json:"time"`              // 时间戳
+	Quality    string                 `json:"quality,omitempty"` // 质量为Bad的属性code，逗号分隔
 }
 type Tag struct {
 	Key   string
@@ -55,6 +63,7 @@ type TDengineWriter struct {
 	mu            sync.Mutex
 	flushInterval time.Duration
 	maxBatchSize  int
+	flushCh       chan struct{} // 缓冲满时通知落库协程
 }
 
 // Writer
@@ -64,6 +73,7 @@ func (t *TDengineService) NewTDengineWriter(flushInterval time.Duration, maxBatc
 		buffer:        make([]MqttMessage, 0, maxBatch),
 		flushInterval: flushInterval,
 		maxBatchSize:  maxBatch,
+		flushCh:       make(chan struct{}, 1),
 	}
 	go w.startFlushLoop()
 	return w
@@ -125,21 +135,38 @@ func (w *TDengineWriter) Add(msg MqttMessage) {
 	w.mu.Unlock()
 
 	if needFlush {
-		// 在锁外执行 flush（避免死锁）
-		w.flush()
+		// 通知落库协程，不在调用方协程中执行 flush，保证批次按顺序写入
+		select {
+		case w.flushCh <- struct{}{}:
+		default:
+		}
 	}
 }
 
-// 定时器自动落库
+// 定时器自动落库，所有 flush 都在该协程中串行执行
 func (w *TDengineWriter) startFlushLoop() {
 	ticker := time.NewTicker(w.flushInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		w.flush()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.flushCh:
+		}
+		w.safeFlush()
 	}
 }
 
+// safeFlush 捕获 flush 中的 panic，避免落库协程退出
+func (w *TDengineWriter) safeFlush() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("TDengine 写入 panic: %v", r)
+		}
+	}()
+	w.flush()
+}
+
 func (w *TDengineWriter) flush() {
 	// 先把要处理的数据取出来（通过交换 slice）
 	w.mu.Lock()
@@ -153,9 +180,7 @@ func (w *TDengineWriter) flush() {
 	w.mu.Unlock()
 
 	// 下面在锁外处理 old，不会阻塞 Add
-	// 按表名分组
-	tableMessages := make(map[string][]MqttMessage)
-	validMsgCount := 0
+	valid := make([]MqttMessage, 0, len(old))
 	for _, msg := range old {
 		// 检查超级表是否存在
 		_, ok := GetDeviceCategoryKeyFromCache(msg.Dn)
@@ -166,12 +191,74 @@ func (w *TDengineWriter) flush() {
 		if len(msg.Properties) == 0 {
 			continue
 		}
-		tableMessages[msg.Dn] = append(tableMessages[msg.Dn], msg)
-		validMsgCount++
+		valid = append(valid, msg)
+	}
+	if len(valid) == 0 {
+		return
+	}
+
+	w.writeBatch(valid)
+}
+
+// writeBatch 批量写入，失败时按退避重试；仍失败则拆分定位问题数据并写入死信
+func (w *TDengineWriter) writeBatch(msgs []MqttMessage) {
+	sqlStr, count := buildInsertSql(msgs)
+	if count == 0 {
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt < flushMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(flushRetryBackoff << (attempt - 1))
+		}
+		if _, err = w.db.Exec(sqlStr); err == nil {
+			utils.DebugLog("批量插入成功: %d 条记录\n", count)
+			return
+		}
 	}
-	if validMsgCount == 0 {
+	log.Printf("批量插入失败(已重试%d次): %v", flushMaxRetries, err)
+
+	// TDengine 不可用时不再拆分，整批进入死信等待重放
+	if pingErr := w.db.Ping(); pingErr != nil {
+		saveDeadLetters(msgs, err, flushMaxRetries)
 		return
 	}
+	w.isolate(msgs, err)
+}
+
+// isolate 二分拆分失败批次，只有单条仍失败的数据进入死信
+func (w *TDengineWriter) isolate(msgs []MqttMessage, cause error) {
+	if len(msgs) <= 1 {
+		saveDeadLetters(msgs, cause, flushMaxRetries)
+		return
+	}
+	mid := len(msgs) / 2
+	for _, part := range [][]MqttMessage{msgs[:mid], msgs[mid:]} {
+		sqlStr, count := buildInsertSql(part)
+		if count == 0 {
+			continue
+		}
+		if _, err := w.db.Exec(sqlStr); err != nil {
+			w.isolate(part, err)
+		}
+	}
+}
+
+// buildInsertSql 构建跨表批量插入SQL，返回SQL及写入的消息数
+func buildInsertSql(msgs []MqttMessage) (string, int) {
+	// 按表名分组，保持首次出现的顺序
+	tableMessages := make(map[string][]MqttMessage)
+	var tableNames []string
+	for _, msg := range msgs {
+		if len(msg.Properties) == 0 {
+			continue
+		}
+		if _, ok := tableMessages[msg.Dn]; !ok {
+			tableNames = append(tableNames, msg.Dn)
+		}
+		tableMessages[msg.Dn] = append(tableMessages[msg.Dn], msg)
+	}
 
 	// 构建跨表批量插入SQL
 	var sqlBuilder strings.Builder
@@ -179,10 +266,8 @@ func (w *TDengineWriter) flush() {
 	firstTable := true
 	insertedCount := 0
 
-	for tableName, tableMsgs := range tableMessages {
-		if len(tableMsgs) == 0 {
-			continue
-		}
+	for _, tableName := range tableNames {
+		tableMsgs := tableMessages[tableName]
 		if !firstTable {
 			sqlBuilder.WriteString(" ")
 		}
@@ -190,11 +275,15 @@ func (w *TDengineWriter) flush() {
 
 		var cols []string
 		var values []string
-
+		hasQuality := false
 		for _, msg := range tableMsgs {
-			if len(msg.Properties) == 0 {
-				continue
+			if msg.Quality != "" {
+				hasQuality = true
+				break
 			}
+		}
+
+		for _, msg := range tableMsgs {
 			var valParts []string
 			valParts = append(valParts, fmt.Sprintf("%d", msg.Time*1000)) // ts
 
@@ -203,10 +292,21 @@ func (w *TDengineWriter) flush() {
 				for k := range msg.Properties {
 					cols = append(cols, fmt.Sprintf("`%s`", k))
 				}
+				if hasQuality {
+					cols = append(cols, fmt.Sprintf("`%s`", QualityColumn))
+				}
 			}
 
 			for _, k := range cols[1:] {
 				key := strings.Trim(k, "`")
+				if hasQuality && key == QualityColumn {
+					if msg.Quality == "" {
+						valParts = append(valParts, "NULL")
+					} else {
+						valParts = append(valParts, fmt.Sprintf("'%s'", strings.ReplaceAll(msg.Quality, "'", "''")))
+					}
+					continue
+				}
 				v, ok := msg.Properties[key]
 				if !ok {
 					valParts = append(valParts, "NULL")
@@ -224,24 +324,12 @@ func (w *TDengineWriter) flush() {
 			}
 			values = append(values, fmt.Sprintf("(%s)", strings.Join(valParts, ",")))
 		}
-		if len(values) == 0 {
-			continue
-		}
 		fmt.Fprintf(&sqlBuilder, "%s.`%s` (%s) VALUES %s",
 			DBName, tableName, strings.Join(cols, ","), strings.Join(values, ","))
 		insertedCount += len(tableMsgs)
 	}
 
-	if insertedCount == 0 {
-		return
-	}
-
-	sqlStr := sqlBuilder.String()
-	if _, err := w.db.Exec(sqlStr); err != nil {
-		fmt.Printf("批量插入失败: %v\nSQL: %s\n", err, sqlStr)
-	} else {
-		utils.DebugLog("批量插入成功: %d 条记录\n", insertedCount)
-	}
+	return sqlBuilder.String(), insertedCount
 }
 
 // 查询数据
@@ -302,6 +390,7 @@ func (t *TDengineService) UpdateSuperTableSchema(dbName, stableName string, newP
 		// 如果是表不存在的错误，则创建超级表
 		if strings.Contains(err.Error(), "not exist") || strings.Contains(err.Error(), "doesn't exist") {
 			schema := GenerateSchemaFromProperties(newProperties)
+			schema += fmt.Sprintf(", `%s` BINARY(255)", QualityColumn)
 			// 使用全局标签变量
 			err = t.CreateStable(dbName, stableName, schema, Label)
 			if err != nil {
@@ -325,6 +414,13 @@ func (t *TDengineService) UpdateSuperTableSchema(dbName, stableName string, newP
 
 	}
 
+	// 质量列，用于记录校验不合规但仍入库的属性
+	if !containsColumn(existingColumns, QualityColumn) {
+		if err = t.AlterStableAddColumnIfNotExists(dbName, stableName, QualityColumn, "BINARY(255)"); err != nil {
+			return fmt.Errorf("添加列 %s 失败: %v", QualityColumn, err)
+		}
+	}
+
 	return nil
 }
 
@@ -393,6 +489,9 @@ func LoadAllDeviceCategoryKeys() error {
 	// 将结果存入缓存
 	for _, device := range devices {
 		StableCache.Store(device.Name, device.CategoryKey)
+		if device.Product != nil {
+			DeviceProductCache.Store(device.Name, device.Product.Id)
+		}
 	}
 
 	return nil
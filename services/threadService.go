@@ -5,20 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+	"hash/fnv"
+	"iotServer/common"
 	"iotServer/iotp"
 	"iotServer/models"
 	"iotServer/models/constants"
 	"iotServer/utils"
 	"log"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 定义全局的工作池参数
 var (
-	workerPoolSize = 100                   // 工作协程数量
-	jobQueue       = make(chan Job, 10000) // 任务队列
+	workerPoolSize = 100               // 工作协程数量（即分片数）
+	shardQueueSize = 100               // 单个分片内存队列容量，仅磁盘队列不可用时使用
+	shardQueues    []chan Job          // 分片内存队列，同一网关的任务固定进入同一分片
+	shardLogs      []*common.DiskQueue // 分片预写磁盘队列，任务先落盘，处理完成后出队；不可用时为 nil
 	// 设备状态缓存相关
 	deviceStatusCache = make(map[string]int64) // 设备ID -> 最后更新时间戳
 	cacheMutex        sync.RWMutex             // 保护缓存的读写锁
@@ -26,8 +33,33 @@ var (
 	maxCacheSize      = 10000                  // 缓存最大条目数
 	eventCache        = sync.Map{}             // 事件缓存
 	StableCache       = sync.Map{}             // 超级表缓存
+	// 磁盘队列相关
+	enqueuedCount int64 // 累计写入磁盘队列任务数
+	replayedCount int64 // 累计从磁盘处理完成任务数
+	droppedCount  int64 // 累计丢弃任务数（磁盘队列不可用且内存队列满，或落盘失败时）
+	timeoutCount  int64 // 累计超时后放弃等待的任务数
 )
 
+// JobQueueStats 任务队列统计
+type JobQueueStats struct {
+	MemoryDepth    int   `json:"memory_depth"`    // 各分片内存队列当前长度之和
+	MemoryCapacity int   `json:"memory_capacity"` // 各分片内存队列容量之和
+	DiskEnabled    bool  `json:"disk_enabled"`    // 磁盘队列是否可用
+	DiskDepth      int64 `json:"disk_depth"`      // 各分片磁盘队列未处理完成的任务数之和
+	LagMs          int64 `json:"lag_ms"`          // 磁盘队首任务最长等待时长（毫秒）
+	Enqueued       int64 `json:"enqueued"`        // 累计写入磁盘队列数，崩溃后未处理完成的任务会重放，至少处理一次
+	Replayed       int64 `json:"replayed"`        // 累计从磁盘处理完成数
+	Dropped        int64 `json:"dropped"`         // 累计丢弃数
+	TimedOut       int64 `json:"timed_out"`       // 累计超时后放弃等待数
+}
+
+// spilledJob 落盘的任务内容，Processor 在读取时重新注入
+type spilledJob struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	Type    string `json:"type"`
+}
+
 // 定义消息处理任务结构
 type Job struct {
 	Topic     string
@@ -36,58 +68,205 @@ type Job struct {
 	Processor *PropertySetProcessor
 }
 
-// 初始化消息处理工作池
-func initWorkerPool() {
+// 初始化消息处理工作池：按网关SN分片，每个分片一个协程顺序处理，各分片独立落盘互不阻塞
+func initWorkerPool(p *PropertySetProcessor) {
+	shardQueues = make([]chan Job, workerPoolSize)
+	shardLogs = make([]*common.DiskQueue, workerPoolSize)
 	for i := 0; i < workerPoolSize; i++ {
-		go worker(jobQueue)
+		shardQueues[i] = make(chan Job, shardQueueSize)
+		shardLogs[i] = openJobLog(i)
+		if shardLogs[i] != nil {
+			go logWorker(p, shardLogs[i])
+		} else {
+			go worker(shardQueues[i])
+		}
 	}
 	log.Printf("已启动 %d 个工作协程处理MQTT消息", workerPoolSize)
 }
 
-// 在 worker 函数中根据任务类型处理不同业务
+// CloseJobQueues 停止服务时同步并关闭各分片磁盘队列，未处理完成的任务在下次启动时继续处理
+func CloseJobQueues() {
+	for _, queue := range shardLogs {
+		if queue == nil {
+			continue
+		}
+		if err := queue.Close(); err != nil {
+			log.Printf("关闭磁盘任务队列失败: %v", err)
+		}
+	}
+}
+
+// jobShard 计算任务所属分片，同一网关（及其下设备）的消息始终落在同一分片以保证顺序
+func jobShard(job Job) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(jobShardKey(job.Topic)))
+	return int(h.Sum32() % uint32(len(shardQueues)))
+}
+
+// jobShardKey 从主题中提取网关SN：/edge/{type}/{SN}/post、lm/gw/ctrlResponse/{SN}
+func jobShardKey(topic string) string {
+	parts := strings.Split(topic, "/")
+	if strings.HasPrefix(topic, "/edge/") && len(parts) >= 5 {
+		return parts[3]
+	}
+	return parts[len(parts)-1]
+}
+
+// openJobLog 打开分片的预写磁盘队列，上次未处理完成的任务由 logWorker 继续处理
+func openJobLog(shard int) *common.DiskQueue {
+	dir := beego.AppConfig.DefaultString("jobQueueDir", "./database/queue")
+	segmentMB := beego.AppConfig.DefaultInt64("jobQueueSegmentMB", 64)
+
+	queue, err := common.NewDiskQueue(filepath.Join(dir, fmt.Sprintf("shard-%03d", shard)), segmentMB*1024*1024)
+	if err != nil {
+		log.Printf("[WARN] 分片 %d 磁盘任务队列初始化失败，改用内存队列，队列满时将丢弃消息: %v", shard, err)
+		return nil
+	}
+	if depth := queue.Depth(); depth > 0 {
+		log.Printf("分片 %d 磁盘任务队列存在 %d 条未处理完成的任务，继续处理", shard, depth)
+	}
+	return queue
+}
+
+// submitJob 提交任务到所属分片：先写入该分片的磁盘队列再返回，磁盘队列不可用时进入内存队列
+func submitJob(job Job) {
+	shard := jobShard(job)
+	queue := shardLogs[shard]
+	if queue == nil {
+		select {
+		case shardQueues[shard] <- job:
+			utils.DebugLog("任务已提交到队列: %s", job.Topic)
+		default:
+			atomic.AddInt64(&droppedCount, 1)
+			log.Printf("任务队列已满，丢弃消息: %s", job.Topic)
+		}
+		return
+	}
+
+	data, _ := json.Marshal(spilledJob{Topic: job.Topic, Payload: job.Payload, Type: job.Type})
+	if err := queue.Put(data); err != nil {
+		atomic.AddInt64(&droppedCount, 1)
+		log.Printf("任务落盘失败，丢弃消息: %s, %v", job.Topic, err)
+		return
+	}
+	atomic.AddInt64(&enqueuedCount, 1)
+	utils.DebugLog("任务已落盘: %s", job.Topic)
+}
+
+// logWorker 按写入顺序处理分片磁盘队列中的任务，处理完成后才出队，崩溃或重启后从未完成的任务继续
+func logWorker(p *PropertySetProcessor, queue *common.DiskQueue) {
+	for {
+		data, _, err := queue.Peek()
+		if err == common.ErrDiskQueueClosed {
+			return
+		}
+		if err != nil {
+			log.Printf("读取磁盘任务失败: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var sj spilledJob
+		if err := json.Unmarshal(data, &sj); err != nil {
+			log.Printf("磁盘任务解析失败，跳过: %v", err)
+			queue.Commit()
+			continue
+		}
+		runJob(Job{Topic: sj.Topic, Payload: sj.Payload, Type: sj.Type, Processor: p})
+		queue.Commit()
+		atomic.AddInt64(&replayedCount, 1)
+	}
+}
+
+// GetJobQueueStats 获取任务队列的积压与延迟统计
+func GetJobQueueStats() JobQueueStats {
+	stats := JobQueueStats{
+		Enqueued: atomic.LoadInt64(&enqueuedCount),
+		Replayed: atomic.LoadInt64(&replayedCount),
+		Dropped:  atomic.LoadInt64(&droppedCount),
+		TimedOut: atomic.LoadInt64(&timeoutCount),
+	}
+	for i, jobs := range shardQueues {
+		stats.MemoryDepth += len(jobs)
+		stats.MemoryCapacity += cap(jobs)
+		queue := shardLogs[i]
+		if queue == nil {
+			continue
+		}
+		stats.DiskEnabled = true
+		stats.DiskDepth += queue.Depth()
+		if oldest := queue.OldestTime(); !oldest.IsZero() {
+			if lag := time.Since(oldest).Milliseconds(); lag > stats.LagMs {
+				stats.LagMs = lag
+			}
+		}
+	}
+	return stats
+}
+
+// worker 顺序处理分片内存队列中的任务
 func worker(jobs <-chan Job) {
 	for job := range jobs {
-		start := time.Now()
+		runJob(job)
+	}
+}
 
-		// 用 context 控制超时
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		done := make(chan error, 1)
+// runJob 根据任务类型处理不同业务，超时后放弃等待，避免单个卡住的任务阻塞整个分片
+func runJob(job Job) {
+	start := time.Now()
 
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("Worker panic: %v, topic=%s", r, job.Topic)
-					done <- fmt.Errorf("panic: %v", r)
-				}
-			}()
-
-			var err error
-			switch job.Type {
-			case "control_response":
-				err = job.Processor.processControlResponse(job.Topic, job.Payload)
-			case "alert_event":
-				err = processAlertEventJob(job.Topic, job.Payload)
-			case "property_message":
-				err = job.Processor.handlePropertyMessage(job.Topic, job.Payload)
-			case "stream_message":
-				err = job.Processor.handleStreamMessage(job.Topic, job.Payload)
-			default:
-				err = fmt.Errorf("未知任务类型: %s", job.Type)
+	// 用 context 控制超时
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Worker panic: %v, topic=%s", r, job.Topic)
+				done <- fmt.Errorf("panic: %v", r)
 			}
-			done <- err
 		}()
 
-		select {
-		case err := <-done:
-			if err != nil {
-				log.Printf("[Worker] 任务失败: %v, 类型=%s", err, job.Type)
+		var err error
+		switch job.Type {
+		case "control_response":
+			err = job.Processor.processControlResponse(job.Topic, job.Payload)
+		case "alert_event":
+			err = processAlertEventJob(job.Topic, job.Payload)
+		case "property_message":
+			err = job.Processor.handlePropertyMessage(job.Topic, job.Payload)
+		case "stream_message":
+			err = job.Processor.handleStreamMessage(job.Topic, job.Payload)
+		case "service_reply":
+			err = job.Processor.handleServiceReply(job.Topic, job.Payload)
+		default:
+			err = fmt.Errorf("未知任务类型: %s", job.Type)
+		}
+		done <- err
+	}()
+
+	// 正常情况下等待任务结束后再处理同一分片的下一条以保证顺序；超时后记录任务内容并继续处理后续任务，
+	// 磁盘队列中的该任务随即出队，超时任务在后台结束时仅记录日志
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		atomic.AddInt64(&timeoutCount, 1)
+		log.Printf("[Worker] 任务超时 [%s]，放弃等待继续处理后续任务, 类型=%s, 内容=%s", job.Topic, job.Type, job.Payload)
+		go func() {
+			if err := <-done; err != nil {
+				log.Printf("[Worker] 超时任务最终失败 [%s]: %v, 耗时=%v", job.Topic, err, time.Since(start))
 			} else {
-				utils.DebugLog("[Worker] 任务完成 [%s], 耗时=%v", job.Topic, time.Since(start))
+				log.Printf("[Worker] 超时任务最终完成 [%s], 耗时=%v", job.Topic, time.Since(start))
 			}
-		case <-ctx.Done():
-			log.Printf("[Worker] 任务超时 [%s]", job.Topic)
-		}
-		cancel()
+		}()
+		return
+	}
+	if err != nil {
+		log.Printf("[Worker] 任务失败: %v, 类型=%s", err, job.Type)
+	} else {
+		utils.DebugLog("[Worker] 任务完成 [%s], 耗时=%v", job.Topic, time.Since(start))
 	}
 }
 
@@ -293,12 +472,45 @@ func processAlertEventJob(topic string, alerts string) error {
 	}
 
 	// 构建告警记录，网关事件直接存入Alert_List
+	dn, _ := out["dn"].(string)
+	code, _ := out["code"].(string)
+	value := InterfaceToString(out["value"])
+	fingerprint := alertFingerprint(0, out, nil)
+	// 解除事件恢复对应的未恢复告警，本条记录仅作留档
+	recovered := out["trigger"] == "网关事件解除"
+	if !recovered {
+		if folded, err := foldAlert(o, fingerprint, "", value); err != nil {
+			return err
+		} else if folded {
+			return nil
+		}
+	}
 	alert := &models.AlertList{
 		AlertRule:   nil,
 		TriggerTime: time.Now().UnixMilli(),
 		IsSend:      false,
 		Status:      string(constants.Untreated),
+		State:       string(constants.AlertTriggered),
+		Dn:          dn,
 		AlertResult: string(newPayload),
+		Fingerprint: fingerprint,
+		Occurrences: 1,
+		PeakValue:   value,
+	}
+	// 按设备所属租户归属告警，设备未注册时按网关推断
+	parts := strings.Split(topic, "/")
+	_, tenant := incidentGroupValue(o, models.IncidentGroupNone, dn)
+	if tenant == 0 && len(parts) > 3 {
+		tenant = gatewayTenant(parts[3])
+	}
+	if tenant > 0 {
+		alert.Department = &models.Department{Id: tenant}
+	}
+	alert.LastSeen = alert.TriggerTime
+	if recovered {
+		recoverEventAlerts(0, 0, dn, code)
+		alert.State = string(constants.AlertClosed)
+		alert.CloseTime = alert.TriggerTime
 	}
 
 	// 保存到数据库
@@ -308,6 +520,13 @@ func processAlertEventJob(topic string, alerts string) error {
 	if _, err = o.Insert(alert); err != nil {
 		return fmt.Errorf("保存告警记录失败: %v", err)
 	}
+	if !recovered {
+		startAlert(o, alert, out)
+		// 网关离线等故障会同时产生大量点位告警，按网关SN归并为一个事件
+		if alertGroupGateway && point != nil && len(parts) > 3 {
+			attachIncident(o, alert, models.IncidentGroupSn, parts[3], "网关 "+parts[3]+" 告警", "告警", alert.Department)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/beego/beego/v2/client/orm"
+	"iotServer/models"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	QualityColumn         = "_quality"       // 超级表中记录质量为Bad的属性code，为空表示Good
+	validateCacheTTL      = 60 * time.Second // 产品校验规则缓存有效期
+	rejectedFlushInterval = 30 * time.Second // 不合规点数落库间隔
+)
+
+var (
+	DeviceProductCache = sync.Map{} // 设备名 -> 产品ID
+	productRuleCache   = sync.Map{} // 产品ID -> *productRule
+	rejectedPoints     = sync.Map{} // 设备名 -> *int64 尚未落库的不合规点数
+)
+
+// propertySpec 单个属性的物模型约束
+type propertySpec struct {
+	Type   string
+	Min    *float64
+	Max    *float64
+	Step   float64
+	Length int
+	Enum   map[string]bool
+}
+
+// productRule 产品的校验策略及属性约束
+type productRule struct {
+	policy string
+	specs  map[string]*propertySpec
+	loaded time.Time
+}
+
+// InvalidateProductRule 物模型或校验策略变更后清除缓存
+func InvalidateProductRule(productId int64) {
+	productRuleCache.Delete(productId)
+}
+
+func getProductRule(productId int64) *productRule {
+	if v, ok := productRuleCache.Load(productId); ok {
+		rule := v.(*productRule)
+		if time.Since(rule.loaded) < validateCacheTTL {
+			return rule
+		}
+	}
+
+	o := orm.NewOrm()
+	product := models.Product{Id: productId}
+	if err := o.Read(&product); err != nil {
+		return nil
+	}
+	rule := &productRule{policy: product.ValidatePolicy, loaded: time.Now()}
+	if rule.policy != models.ValidatePolicyNone {
+		var properties []*models.Properties
+		if _, err := o.QueryTable(new(models.Properties)).Filter("product_id", productId).All(&properties); err != nil {
+			log.Printf("加载产品 %d 物模型失败: %v", productId, err)
+			return nil
+		}
+		rule.specs = make(map[string]*propertySpec, len(properties))
+		for _, prop := range properties {
+			rule.specs[prop.Code] = parsePropertySpec(prop.TypeSpec)
+		}
+	}
+	productRuleCache.Store(productId, rule)
+	return rule
+}
+
+// parsePropertySpec 解析属性的 TypeSpec，specs 既可能是对象也可能是JSON字符串
+func parsePropertySpec(typeSpec string) *propertySpec {
+	spec := &propertySpec{}
+	var ts models.TypeSpec
+	if err := json.Unmarshal([]byte(typeSpec), &ts); err != nil {
+		return spec
+	}
+	spec.Type = strings.ToLower(ts.Type)
+
+	raw := []byte(ts.Specs)
+	var specStr string
+	if err := json.Unmarshal(raw, &specStr); err == nil {
+		raw = []byte(specStr)
+	}
+	var specs map[string]interface{}
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return spec
+	}
+
+	switch spec.Type {
+	case "int", "integer", "float", "double":
+		if v, ok := toFloat(specs["min"]); ok {
+			spec.Min = &v
+		}
+		if v, ok := toFloat(specs["max"]); ok {
+			spec.Max = &v
+		}
+		if v, ok := toFloat(specs["step"]); ok && v > 0 {
+			spec.Step = v
+		}
+	case "string", "text":
+		if v, ok := toFloat(specs["length"]); ok && v > 0 {
+			spec.Length = int(v)
+		}
+	case "bool", "boolean", "enum":
+		if len(specs) > 0 {
+			spec.Enum = make(map[string]bool, len(specs))
+			for k := range specs {
+				spec.Enum[k] = true
+			}
+		}
+	}
+	return spec
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (s *propertySpec) isInt() bool {
+	return s.Type == "int" || s.Type == "integer"
+}
+
+func (s *propertySpec) isNumber() bool {
+	return s.isInt() || s.Type == "float" || s.Type == "double"
+}
+
+// normalize 按数据类型转换取值，类型不符时返回false
+func (s *propertySpec) normalize(v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	switch {
+	case s.isNumber():
+		return toFloat(v)
+	case s.Type == "bool" || s.Type == "boolean":
+		switch val := v.(type) {
+		case bool:
+			return val, true
+		case string:
+			b, err := strconv.ParseBool(val)
+			return b, err == nil
+		}
+		if f, ok := toFloat(v); ok && (f == 0 || f == 1) {
+			return f == 1, true
+		}
+		return nil, false
+	case s.Type == "string" || s.Type == "text":
+		if val, ok := v.(string); ok {
+			return val, true
+		}
+		return fmt.Sprintf("%v", v), true
+	}
+	return v, true
+}
+
+// enumKey 取值在枚举specs中对应的键
+func enumKey(v interface{}) string {
+	switch val := v.(type) {
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// conform 判断已规范化的取值是否满足约束
+func (s *propertySpec) conform(v interface{}) bool {
+	switch val := v.(type) {
+	case float64:
+		if !s.isNumber() {
+			break
+		}
+		if s.isInt() && val != math.Trunc(val) {
+			return false
+		}
+		if (s.Min != nil && val < *s.Min) || (s.Max != nil && val > *s.Max) {
+			return false
+		}
+		if s.Step > 0 {
+			base := 0.0
+			if s.Min != nil {
+				base = *s.Min
+			}
+			n := (val - base) / s.Step
+			if math.Abs(n-math.Round(n)) > 1e-6 {
+				return false
+			}
+		}
+		return true
+	case string:
+		if s.Length > 0 && len([]rune(val)) > s.Length {
+			return false
+		}
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[enumKey(v)]
+	}
+	return true
+}
+
+// clamp 尝试把越界取值修正到约束内，无法修正时返回false
+func (s *propertySpec) clamp(v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case float64:
+		if !s.isNumber() {
+			break
+		}
+		if s.Step > 0 {
+			base := 0.0
+			if s.Min != nil {
+				base = *s.Min
+			}
+			val = base + math.Round((val-base)/s.Step)*s.Step
+		}
+		if s.isInt() {
+			val = math.Round(val)
+		}
+		if s.Min != nil && val < *s.Min {
+			val = *s.Min
+		}
+		if s.Max != nil && val > *s.Max {
+			val = *s.Max
+		}
+		return val, true
+	case string:
+		if s.Length > 0 {
+			if r := []rune(val); len(r) > s.Length {
+				return string(r[:s.Length]), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// storable 不合规的取值能否按列类型原样入库
+func (s *propertySpec) storable(v interface{}) bool {
+	if f, ok := v.(float64); ok && s.isInt() {
+		return f == math.Trunc(f)
+	}
+	return true
+}
+
+// ValidateMessage 按产品物模型校验上报数据，根据产品策略丢弃、裁剪或标记不合规的点
+// 返回不合规的点数，未绑定产品或未开启校验的设备不做处理
+func ValidateMessage(msg *MqttMessage) int {
+	v, ok := DeviceProductCache.Load(msg.Dn)
+	if !ok {
+		return 0
+	}
+	rule := getProductRule(v.(int64))
+	if rule == nil || rule.policy == models.ValidatePolicyNone {
+		return 0
+	}
+
+	invalid := 0
+	var bad []string
+	for code, raw := range msg.Properties {
+		spec, ok := rule.specs[code]
+		if !ok {
+			// 物模型中不存在的属性无法入库
+			delete(msg.Properties, code)
+			invalid++
+			continue
+		}
+		val, ok := spec.normalize(raw)
+		if ok && spec.conform(val) {
+			msg.Properties[code] = val
+			continue
+		}
+		invalid++
+		if !ok {
+			delete(msg.Properties, code)
+			continue
+		}
+		switch rule.policy {
+		case models.ValidatePolicyClamp:
+			if fixed, ok := spec.clamp(val); ok {
+				msg.Properties[code] = fixed
+			} else {
+				delete(msg.Properties, code)
+			}
+		case models.ValidatePolicyMark:
+			if spec.storable(val) {
+				msg.Properties[code] = val
+				bad = append(bad, code)
+			} else {
+				delete(msg.Properties, code)
+			}
+		default:
+			delete(msg.Properties, code)
+		}
+	}
+
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		msg.Quality = strings.Join(bad, ",")
+	}
+	if invalid > 0 {
+		addRejectedPoints(msg.Dn, invalid)
+	}
+	return invalid
+}
+
+func addRejectedPoints(dn string, n int) {
+	v, _ := rejectedPoints.LoadOrStore(dn, new(int64))
+	atomic.AddInt64(v.(*int64), int64(n))
+}
+
+// PendingRejectedPoints 获取设备尚未落库的不合规点数
+func PendingRejectedPoints(dn string) int64 {
+	if v, ok := rejectedPoints.Load(dn); ok {
+		return atomic.LoadInt64(v.(*int64))
+	}
+	return 0
+}
+
+// rejectedFlushLoop 定期把不合规点数累加到设备表
+func rejectedFlushLoop() {
+	ticker := time.NewTicker(rejectedFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushRejectedPoints()
+	}
+}
+
+func flushRejectedPoints() {
+	o := orm.NewOrm()
+	rejectedPoints.Range(func(key, value interface{}) bool {
+		dn := key.(string)
+		counter := value.(*int64)
+		n := atomic.SwapInt64(counter, 0)
+		if n == 0 {
+			return true
+		}
+		_, err := o.QueryTable(new(models.Device)).Filter("name", dn).Update(orm.Params{
+			"rejected_points": orm.ColValue(orm.ColAdd, n),
+		})
+		if err != nil {
+			atomic.AddInt64(counter, n)
+			log.Printf("更新设备 %s 不合规点数失败: %v", dn, err)
+		}
+		return true
+	})
+}
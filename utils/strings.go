@@ -164,11 +164,17 @@ func FormatTimestamp(timestamp interface{}) string {
 
 // SendHttpPost 发送HTTP POST请求的通用方法
 func SendHttpPost(url string, data interface{}) error {
+	_, err := SendHttpPostBody(url, data)
+	return err
+}
+
+// SendHttpPostBody 发送HTTP POST请求并返回响应内容
+func SendHttpPostBody(url string, data interface{}) (string, error) {
 	// 将数据转换为JSON
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		logs.Error("数据序列化失败: %v", err)
-		return err
+		return "", err
 	}
 
 	// 创建一个带超时的客户端
@@ -180,7 +186,7 @@ func SendHttpPost(url string, data interface{}) error {
 	req, err := http.NewRequest("POST", strings.TrimSpace(url), bytes.NewBuffer(jsonData))
 	if err != nil {
 		logs.Error("构造请求失败: %v", err)
-		return err
+		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
@@ -188,7 +194,7 @@ func SendHttpPost(url string, data interface{}) error {
 	resp, err := client.Do(req)
 	if err != nil {
 		logs.Error("发送HTTP POST请求失败: %v", err)
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -196,17 +202,17 @@ func SendHttpPost(url string, data interface{}) error {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logs.Error("读取响应失败: %v", err)
-		return err
+		return "", err
 	}
 
 	// 检查响应状态
 	if resp.StatusCode == http.StatusOK {
 		logs.Info("HTTP POST请求发送成功: %s", string(body))
 	} else {
-		return fmt.Errorf("HTTP POST请求发送失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		return string(body), fmt.Errorf("HTTP POST请求发送失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	return string(body), nil
 }
 
 func GetResourceIds(resourceIds string) ([]int64, error) {